@@ -0,0 +1,222 @@
+//go:build go1.7
+// +build go1.7
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// DefaultTenantHeader is the header used by Cortex, Mimir and Thanos to select the tenant.
+const DefaultTenantHeader = "X-Scope-OrgID"
+
+// Authenticator adds credentials to the requests sent to the Prometheus.
+type Authenticator interface {
+	// Authenticate sets the credentials on req. It is called before every
+	// attempt of a request and must be safe for concurrent use.
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc is an adapter to use an ordinary function as Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate calls f(req).
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// Chain returns an Authenticator calling all the given authenticators in order.
+func Chain(auths ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		for _, a := range auths {
+			if err := a.Authenticate(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BasicAuth returns an Authenticator using HTTP basic auth.
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// BearerToken returns an Authenticator sending a static bearer token.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BearerTokenFile returns an Authenticator sending the bearer token stored
+// in the given file. The file is read again whenever it is modified, so that
+// rotated tokens, e.g. of Kubernetes service accounts, are picked up.
+func BearerTokenFile(path string) Authenticator {
+	return &tokenFile{path: path}
+}
+
+type tokenFile struct {
+	path string
+
+	mtx     sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+func (t *tokenFile) Authenticate(req *http.Request) error {
+	token, err := t.read()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (t *tokenFile) read() (string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read bearer token file %s: %w", t.path, err)
+	}
+	if t.token != "" && fi.ModTime().Equal(t.modTime) {
+		return t.token, nil
+	}
+
+	b, err := os.ReadFile(t.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read bearer token file %s: %w", t.path, err)
+	}
+	t.token = strings.TrimSpace(string(b))
+	t.modTime = fi.ModTime()
+	return t.token, nil
+}
+
+// StaticHeaders returns an Authenticator setting the given headers on every request.
+func StaticHeaders(headers map[string]string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return nil
+	})
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx overriding the tenant sent by the
+// Authenticator returned from TenantHeader.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// TenantHeader returns an Authenticator sending the tenant in the given
+// header, e.g. DefaultTenantHeader or "AccountID". The tenant set on the
+// request context with WithTenant takes precedence over defaultTenant. No
+// header is sent if both are empty.
+func TenantHeader(header, defaultTenant string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		tenant := defaultTenant
+		if t, ok := TenantFromContext(req.Context()); ok {
+			tenant = t
+		}
+		if tenant != "" {
+			req.Header.Set(header, tenant)
+		}
+		return nil
+	})
+}
+
+// OAuth2Config configures the OAuth2 client credentials flow.
+type OAuth2Config struct {
+	ClientID     string
+	ClientSecret string
+	// The path of a file holding the client secret. It takes precedence over ClientSecret.
+	ClientSecretFile string
+	TokenURL         string
+	Scopes           []string
+	EndpointParams   url.Values
+
+	// HTTPClient is used to request tokens. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// OAuth2ClientCredentials returns an Authenticator fetching access tokens
+// with the OAuth2 client credentials flow. Tokens are cached and fetched
+// again shortly before they expire.
+func OAuth2ClientCredentials(cfg OAuth2Config) Authenticator {
+	return &oauth2Auth{cfg: cfg}
+}
+
+type oauth2Auth struct {
+	cfg OAuth2Config
+
+	mtx   sync.Mutex
+	token *oauth2.Token
+}
+
+func (a *oauth2Auth) Authenticate(req *http.Request) error {
+	token, err := a.getToken(req.Context())
+	if err != nil {
+		return err
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+func (a *oauth2Auth) getToken(ctx context.Context) (*oauth2.Token, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.token.Valid() {
+		return a.token, nil
+	}
+
+	secret := a.cfg.ClientSecret
+	if a.cfg.ClientSecretFile != "" {
+		b, err := os.ReadFile(a.cfg.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client secret file %s: %w", a.cfg.ClientSecretFile, err)
+		}
+		secret = strings.TrimSpace(string(b))
+	}
+	cc := &clientcredentials.Config{
+		ClientID:       a.cfg.ClientID,
+		ClientSecret:   secret,
+		TokenURL:       a.cfg.TokenURL,
+		Scopes:         a.cfg.Scopes,
+		EndpointParams: a.cfg.EndpointParams,
+	}
+	if a.cfg.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, a.cfg.HTTPClient)
+	}
+
+	token, err := cc.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch OAuth2 token: %w", err)
+	}
+	a.token = token
+	return token, nil
+}
@@ -0,0 +1,197 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func authenticate(t *testing.T, ctx context.Context, a Authenticator) http.Header {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/api/v1/query", nil)
+	require.NoError(t, err)
+	require.NoError(t, a.Authenticate(req))
+	return req.Header
+}
+
+func TestBearerTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	a := BearerTokenFile(path)
+	require.Equal(t, "Bearer first", authenticate(t, context.Background(), a).Get("Authorization"))
+
+	// The token is only read again once the file is modified.
+	require.NoError(t, os.WriteFile(path, []byte("second\n"), 0o600))
+	mtime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	require.Equal(t, "Bearer second", authenticate(t, context.Background(), a).Get("Authorization"))
+	require.Equal(t, "Bearer second", authenticate(t, context.Background(), a).Get("Authorization"))
+
+	require.NoError(t, os.Remove(path))
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, a.Authenticate(req), "unable to read bearer token file")
+}
+
+// tokenServer is an OAuth2 token endpoint handing out numbered tokens.
+type tokenServer struct {
+	mtx       sync.Mutex
+	expiresIn int
+	issued    int
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+		http.Error(w, "unsupported grant type", http.StatusBadRequest)
+		return
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	s.mtx.Lock()
+	s.issued++
+	n := s.issued
+	s.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, s.expiresIn)
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	t.Run("cached", func(t *testing.T) {
+		ts := &tokenServer{expiresIn: 3600}
+		srv := httptest.NewServer(ts)
+		defer srv.Close()
+
+		a := OAuth2ClientCredentials(OAuth2Config{ClientID: "client", ClientSecret: "secret", TokenURL: srv.URL})
+		for i := 0; i < 3; i++ {
+			require.Equal(t, "Bearer token-1", authenticate(t, context.Background(), a).Get("Authorization"))
+		}
+		require.Equal(t, 1, ts.issued)
+	})
+
+	t.Run("refreshed on expiry", func(t *testing.T) {
+		// Tokens expiring within the expiry delta of the oauth2 package are
+		// already considered invalid.
+		ts := &tokenServer{expiresIn: 1}
+		srv := httptest.NewServer(ts)
+		defer srv.Close()
+
+		a := OAuth2ClientCredentials(OAuth2Config{ClientID: "client", ClientSecret: "secret", TokenURL: srv.URL})
+		require.Equal(t, "Bearer token-1", authenticate(t, context.Background(), a).Get("Authorization"))
+		require.Equal(t, "Bearer token-2", authenticate(t, context.Background(), a).Get("Authorization"))
+		require.Equal(t, 2, ts.issued)
+	})
+
+	t.Run("secret file", func(t *testing.T) {
+		ts := &tokenServer{expiresIn: 3600}
+		srv := httptest.NewServer(ts)
+		defer srv.Close()
+
+		path := filepath.Join(t.TempDir(), "secret")
+		require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+		a := OAuth2ClientCredentials(OAuth2Config{ClientID: "client", ClientSecret: "wrong", ClientSecretFile: path, TokenURL: srv.URL})
+		require.Equal(t, "Bearer token-1", authenticate(t, context.Background(), a).Get("Authorization"))
+	})
+
+	t.Run("invalid client", func(t *testing.T) {
+		ts := &tokenServer{expiresIn: 3600}
+		srv := httptest.NewServer(ts)
+		defer srv.Close()
+
+		a := OAuth2ClientCredentials(OAuth2Config{ClientID: "client", ClientSecret: "wrong", TokenURL: srv.URL})
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+		require.NoError(t, err)
+		require.ErrorContains(t, a.Authenticate(req), "unable to fetch OAuth2 token")
+		require.Empty(t, req.Header.Get("Authorization"))
+	})
+}
+
+func TestTenantHeader(t *testing.T) {
+	ctx := context.Background()
+
+	require.Equal(t, "default", authenticate(t, ctx, TenantHeader(DefaultTenantHeader, "default")).Get(DefaultTenantHeader))
+	require.Equal(t, "team-a", authenticate(t, WithTenant(ctx, "team-a"), TenantHeader(DefaultTenantHeader, "default")).Get(DefaultTenantHeader))
+	require.Equal(t, "42", authenticate(t, WithTenant(ctx, "42"), TenantHeader("AccountID", "")).Get("AccountID"))
+	_, ok := authenticate(t, ctx, TenantHeader(DefaultTenantHeader, ""))[DefaultTenantHeader]
+	require.False(t, ok)
+
+	// The tenant of the context overrides a static tenant header set before.
+	a := Chain(StaticHeaders(map[string]string{DefaultTenantHeader: "static", "X-Extra": "1"}), TenantHeader(DefaultTenantHeader, ""))
+	h := authenticate(t, WithTenant(ctx, "team-a"), a)
+	require.Equal(t, "team-a", h.Get(DefaultTenantHeader))
+	require.Equal(t, "1", h.Get("X-Extra"))
+	require.Equal(t, "static", authenticate(t, ctx, a).Get(DefaultTenantHeader))
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Authenticator {
+		return AuthenticatorFunc(func(req *http.Request) error {
+			calls = append(calls, name)
+			req.Header.Set("X-Last", name)
+			return nil
+		})
+	}
+	fail := AuthenticatorFunc(func(*http.Request) error {
+		calls = append(calls, "fail")
+		return fmt.Errorf("no credentials")
+	})
+
+	h := authenticate(t, context.Background(), Chain(record("a"), record("b"), record("c")))
+	require.Equal(t, []string{"a", "b", "c"}, calls)
+	require.Equal(t, "c", h.Get("X-Last"))
+
+	calls = nil
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+	require.NoError(t, err)
+	require.EqualError(t, Chain(record("a"), fail, record("c")).Authenticate(req), "no credentials")
+	require.Equal(t, []string{"a", "fail"}, calls)
+}
+
+func TestClientAuthenticator(t *testing.T) {
+	var got []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Clone())
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		cfg    Config
+		header string
+		value  string
+	}{
+		{cfg: Config{Username: "user", Password: "pass"}, header: "Authorization", value: "Basic dXNlcjpwYXNz"},
+		{cfg: Config{BearerToken: "token"}, header: "Authorization", value: "Bearer token"},
+		{
+			cfg:    Config{BearerToken: "token", Authenticator: StaticHeaders(map[string]string{"AccountID": "7"})},
+			header: "AccountID",
+			value:  "7",
+		},
+	} {
+		got = nil
+		tc.cfg.Address = srv.URL
+		c, err := NewClient(tc.cfg)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		_, _, err = c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, tc.value, got[0].Get(tc.header))
+		// The request passed in is not modified.
+		require.Empty(t, req.Header)
+	}
+}
@@ -19,8 +19,7 @@ package prometheus
 
 import (
 	"context"
-	"crypto/tls"
-	"fmt"
+	"errors"
 	"io"
 	"net"
 	"net/http"
@@ -28,8 +27,6 @@ import (
 	"path"
 	"strings"
 	"time"
-
-	"github.com/levigross/grequests"
 )
 
 // DefaultRoundTripper is used if no RoundTripper is set in Config.
@@ -40,7 +37,6 @@ var DefaultRoundTripper http.RoundTripper = &http.Transport{
 		KeepAlive: 30 * time.Second,
 	}).DialContext,
 	TLSHandshakeTimeout: 10 * time.Second,
-	TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
 }
 
 // Config defines configuration parameters for a new client.
@@ -57,26 +53,59 @@ type Config struct {
 	// The password of basic auth for the Prometheus to connect to.
 	Password string
 
+	// Authenticator adds credentials to every request. If not provided,
+	// basic auth or the bearer token above are used.
+	Authenticator Authenticator
+
 	// The timeout for the Prometheus to connect to.
 	Timeout int
 
 	// RoundTripper is used by the Client to drive HTTP requests. If not
 	// provided, DefaultRoundTripper will be used.
 	RoundTripper http.RoundTripper
+
+	// TLSConfig configures the TLS connection to the Prometheus.
+	// It is ignored if RoundTripper is set.
+	TLSConfig TLSConfig
+
+	// The URL of the HTTP proxy to connect through. If empty, the proxy is
+	// taken from the environment. It is ignored if RoundTripper is set.
+	ProxyURL string
+
+	// Retry defines how failed requests are retried. Retries are disabled by default.
+	Retry RetryConfig
 }
 
-func (cfg *Config) roundTripper() http.RoundTripper {
-	if cfg.RoundTripper == nil {
-		return DefaultRoundTripper
+func (cfg *Config) roundTripper() (http.RoundTripper, error) {
+	if cfg.RoundTripper != nil {
+		return cfg.RoundTripper, nil
+	}
+	if cfg.TLSConfig.isZero() && cfg.ProxyURL == "" {
+		return DefaultRoundTripper, nil
 	}
-	return cfg.RoundTripper
+	return newTransport(cfg)
 }
 
 // Client is the interface for an API client.
 type Client interface {
 	URL(ep string, args map[string]string) *url.URL
 	Do(context.Context, *http.Request) (*http.Response, []byte, error)
-	Proxy(method string, url string, params map[string]string, data map[string]string) (*grequests.Response, error)
+	DoStream(context.Context, *http.Request) (*http.Response, error)
+	Raw(ctx context.Context, r RawRequest) (*http.Response, error)
+}
+
+// RawRequest describes a request to an arbitrary endpoint of the Prometheus.
+type RawRequest struct {
+	// The HTTP method, GET if empty.
+	Method string
+	// The path of the endpoint relative to the configured address, e.g. "/api/v1/status/config".
+	Path string
+	// The query parameters, which may be repeated, e.g. match[].
+	Query url.Values
+	// Additional headers to send.
+	Header http.Header
+	// The request body. It is streamed to the server and may be nil.
+	Body io.Reader
 }
 
 // NewClient returns a new Client.
@@ -89,23 +118,54 @@ func NewClient(cfg Config) (Client, error) {
 	}
 	u.Path = strings.TrimRight(u.Path, "/")
 
+	rt, err := cfg.roundTripper()
+	if err != nil {
+		return nil, err
+	}
+
+	auth := cfg.Authenticator
+	if auth == nil {
+		if cfg.Username != "" {
+			auth = BasicAuth(cfg.Username, cfg.Password)
+		} else if cfg.BearerToken != "" {
+			auth = BearerToken(cfg.BearerToken)
+		}
+	}
+	if auth != nil {
+		rt = &authRoundTripper{auth: auth, next: rt}
+	}
+
 	return &httpClient{
-		endpoint:    u,
-		bearerToken: cfg.BearerToken,
-		username:    cfg.Username,
-		password:    cfg.Password,
-		timeout:     cfg.Timeout,
-		client:      http.Client{Transport: cfg.roundTripper()},
+		endpoint: u,
+		timeout:  cfg.Timeout,
+		retry:    cfg.Retry,
+		client:   http.Client{Transport: rt},
 	}, nil
 }
 
+// authRoundTripper authenticates every request before passing it on.
+type authRoundTripper struct {
+	auth Authenticator
+	next http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	if err := rt.auth.Authenticate(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return rt.next.RoundTrip(req)
+}
+
 type httpClient struct {
-	endpoint    *url.URL
-	username    string
-	password    string
-	bearerToken string
-	timeout     int
-	client      http.Client
+	endpoint *url.URL
+	timeout  int
+	retry    RetryConfig
+	client   http.Client
 }
 
 func (c *httpClient) URL(ep string, args map[string]string) *url.URL {
@@ -123,15 +183,27 @@ func (c *httpClient) URL(ep string, args map[string]string) *url.URL {
 }
 
 func (c *httpClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	if ctx == nil {
+		ctx = req.Context()
 	}
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
-	} else if c.bearerToken != "" {
-		req.Header.Add("Authorization", "Bearer "+c.bearerToken)
+
+	resp, body, err := c.do(ctx, req)
+	for attempt := 1; attempt < c.retry.MaxAttempts; attempt++ {
+		if !c.retry.shouldRetry(ctx, req, resp, body, err) {
+			break
+		}
+		next, ok := rewind(req)
+		if !ok || !c.retry.wait(ctx, attempt, resp) {
+			break
+		}
+		req = next
+		resp, body, err = c.do(ctx, req)
 	}
-	resp, err := c.client.Do(req)
+	return resp, body, err
+}
+
+func (c *httpClient) do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := c.send(ctx, req)
 	defer func() {
 		if resp != nil {
 			resp.Body.Close()
@@ -162,34 +234,88 @@ func (c *httpClient) Do(ctx context.Context, req *http.Request) (*http.Response,
 	return resp, body, err
 }
 
-func (c *httpClient) Proxy(method string, url string, params map[string]string, data map[string]string) (*grequests.Response, error) {
-	url = c.endpoint.String() + url
-	var err error
-	var response *grequests.Response
-	requestOptions := &grequests.RequestOptions{
-		Data:               data,
-		Params:             params,
-		RequestTimeout:     time.Duration(c.timeout) * time.Second,
-		InsecureSkipVerify: true,
-	}
-	if c.username != "" && c.password != "" {
-		requestOptions.Auth = []string{c.username, c.password}
-	} else if c.bearerToken != "" {
-		requestOptions.Headers = map[string]string{"Authorization": fmt.Sprintf("Bearer %s", c.bearerToken)}
-	}
-
-	switch method {
-	case http.MethodGet:
-		response, err = grequests.Get(url, requestOptions)
-	case http.MethodPost:
-		response, err = grequests.Post(url, requestOptions)
-	case http.MethodPut:
-		response, err = grequests.Put(url, requestOptions)
-	case http.MethodDelete:
-		response, err = grequests.Delete(url, requestOptions)
-	default:
-		return nil, fmt.Errorf("oh no, method %s has not been implemented", method)
-	}
-
-	return response, err
+// DoStream sends the request like Do, but returns as soon as the response
+// headers are read. The caller must close the response body.
+func (c *httpClient) DoStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if ctx == nil {
+		ctx = req.Context()
+	}
+
+	resp, err := c.send(ctx, req)
+	for attempt := 1; attempt < c.retry.MaxAttempts; attempt++ {
+		if !c.retry.shouldRetry(ctx, req, resp, nil, err) {
+			break
+		}
+		next, ok := rewind(req)
+		if !ok || !c.retry.wait(ctx, attempt, resp) {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		req = next
+		resp, err = c.send(ctx, req)
+	}
+	return resp, err
+}
+
+func (c *httpClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(ctx))
+}
+
+// Raw sends an arbitrary request using the authentication, TLS and retry
+// settings of the client. The response is returned as is, regardless of its
+// status code, and the caller must close its body.
+func (c *httpClient) Raw(ctx context.Context, r RawRequest) (*http.Response, error) {
+	if ctx == nil {
+		return nil, errors.New("nil context")
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	u := c.URL(r.Path, nil)
+	if len(r.Query) > 0 {
+		u.RawQuery = r.Query.Encode()
+	}
+
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.timeout)*time.Second)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r.Body)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := c.DoStream(ctx, req)
+	if cancel != nil {
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// The timeout covers reading the body, so only release it on Close.
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	}
+	return resp, err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
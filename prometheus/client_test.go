@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRaw(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, r.URL.Path+"?"+r.URL.RawQuery+" "+r.Header.Get("X-Test")+" "+string(body))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(Config{Address: srv.URL + "/prefix/"})
+	require.NoError(t, err)
+
+	resp, err := c.Raw(context.Background(), RawRequest{
+		Method: http.MethodPost,
+		Path:   "/api/v1/status/config",
+		Query:  url.Values{"match[]": {"up", "down"}},
+		Header: http.Header{"X-Test": {"1"}},
+		Body:   strings.NewReader("body"),
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+	require.Equal(t, http.MethodPost, resp.Header.Get("X-Method"))
+	require.Equal(t, "/prefix/api/v1/status/config?match%5B%5D=up&match%5B%5D=down 1 body", string(b))
+
+	//nolint:staticcheck // A nil context is rejected rather than panicking.
+	_, err = c.Raw(nil, RawRequest{Path: "/api/v1/query"})
+	require.EqualError(t, err, "nil context")
+}
@@ -20,11 +20,14 @@ import (
 	"encoding/json"
 	"reflect"
 	"strconv"
+	"strings"
 	"unsafe"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/prometheus/common/model"
 	"golang.org/x/exp/slices"
+
+	"github.com/liticer/gclients/prometheus/model/strutil"
 )
 
 // Well-known label names used by Prometheus components.
@@ -94,7 +97,7 @@ func (ls Labels) String() string {
 		var name, value string
 		name, i = decodeString(ls.data, i)
 		value, i = decodeString(ls.data, i)
-		b.WriteString(name)
+		b.WriteString(strutil.QuoteLabelName(name))
 		b.WriteByte('=')
 		b.WriteString(strconv.Quote(value))
 	}
@@ -342,13 +345,21 @@ func (ls Labels) WithoutEmpty() Labels {
 	return ls
 }
 
-// IsValid checks if the metric name or label names are valid.
+// IsValid checks if the metric name or label names are valid according to
+// the legacy validation scheme.
 func (ls Labels) IsValid() bool {
+	return ls.IsValidWithScheme(model.LegacyValidation)
+}
+
+// IsValidWithScheme checks if the metric name or label names are valid
+// according to the given validation scheme, which is either
+// model.LegacyValidation or model.UTF8Validation.
+func (ls Labels) IsValidWithScheme(validationScheme model.ValidationScheme) bool {
 	err := ls.Validate(func(l Label) error {
-		if l.Name == model.MetricNameLabel && !model.IsValidMetricName(model.LabelValue(l.Value)) {
+		if l.Name == model.MetricNameLabel && !validationScheme.IsValidMetricName(l.Value) {
 			return strconv.ErrSyntax
 		}
-		if !model.LabelName(l.Name).IsValid() || !model.LabelValue(l.Value).IsValid() {
+		if !validationScheme.IsValidLabelName(l.Name) || !model.LabelValue(l.Value).IsValid() {
 			return strconv.ErrSyntax
 		}
 		return nil
@@ -391,7 +402,7 @@ func yoloBytes(s string) (b []byte) {
 // New returns a sorted Labels from the given labels.
 // The caller has to guarantee that all label names are unique.
 func New(ls ...Label) Labels {
-	slices.SortFunc(ls, func(a, b Label) bool { return a.Name < b.Name })
+	slices.SortFunc(ls, func(a, b Label) int { return strings.Compare(a.Name, b.Name) })
 	size := labelsSize(ls)
 	buf := make([]byte, size)
 	marshalLabelsToSizedBuffer(ls, buf)
@@ -638,7 +649,7 @@ func (b *Builder) Labels() Labels {
 		return b.base
 	}
 
-	slices.SortFunc(b.add, func(a, b Label) bool { return a.Name < b.Name })
+	slices.SortFunc(b.add, func(a, b Label) int { return strings.Compare(a.Name, b.Name) })
 	slices.Sort(b.del)
 	a, d := 0, 0
 
@@ -797,7 +808,7 @@ func (b *ScratchBuilder) Add(name, value string) {
 
 // Sort the labels added so far by name.
 func (b *ScratchBuilder) Sort() {
-	slices.SortFunc(b.add, func(a, b Label) bool { return a.Name < b.Name })
+	slices.SortFunc(b.add, func(a, b Label) int { return strings.Compare(a.Name, b.Name) })
 }
 
 // Assign is for when you already have a Labels which you want this ScratchBuilder to return.
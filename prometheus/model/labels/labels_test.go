@@ -19,6 +19,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 )
@@ -36,6 +37,10 @@ func TestLabels_String(t *testing.T) {
 			lables:   Labels{},
 			expected: "{}",
 		},
+		{
+			lables:   FromStrings("service.name", "api", "t1", "t1"),
+			expected: "{\"service.name\"=\"api\", t1=\"t1\"}",
+		},
 	}
 	for _, c := range cases {
 		str := c.lables.String()
@@ -214,8 +219,9 @@ func TestLabels_WithoutEmpty(t *testing.T) {
 
 func TestLabels_IsValid(t *testing.T) {
 	for _, test := range []struct {
-		input    Labels
-		expected bool
+		input        Labels
+		expected     bool // With legacy validation.
+		utf8Expected bool // With UTF-8 validation.
 	}{
 		{
 			input: FromStrings(
@@ -223,7 +229,8 @@ func TestLabels_IsValid(t *testing.T) {
 				"hostname", "localhost",
 				"job", "check",
 			),
-			expected: true,
+			expected:     true,
+			utf8Expected: true,
 		},
 		{
 			input: FromStrings(
@@ -231,39 +238,62 @@ func TestLabels_IsValid(t *testing.T) {
 				"hostname_123", "localhost",
 				"_job", "check",
 			),
-			expected: true,
+			expected:     true,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("__name__", "test-ms"),
-			expected: false,
+			input:        FromStrings("__name__", "test-ms"),
+			expected:     false,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("__name__", "0zz"),
-			expected: false,
+			input:        FromStrings("__name__", "0zz"),
+			expected:     false,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("abc:xyz", "invalid"),
-			expected: false,
+			input:        FromStrings("abc:xyz", "invalid"),
+			expected:     false,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("123abc", "invalid"),
-			expected: false,
+			input:        FromStrings("123abc", "invalid"),
+			expected:     false,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("中文abc", "invalid"),
-			expected: false,
+			input:        FromStrings("中文abc", "invalid"),
+			expected:     false,
+			utf8Expected: true,
 		},
 		{
-			input:    FromStrings("invalid", "aa\xe2"),
-			expected: false,
+			input:        FromStrings("invalid", "aa\xe2"),
+			expected:     false,
+			utf8Expected: false,
 		},
 		{
-			input:    FromStrings("invalid", "\xF7\xBF\xBF\xBF"),
-			expected: false,
+			input:        FromStrings("invalid", "\xF7\xBF\xBF\xBF"),
+			expected:     false,
+			utf8Expected: false,
+		},
+		{
+			input: FromStrings(
+				"__name__", "http.server.duration",
+				"service.name", "api",
+			),
+			expected:     false,
+			utf8Expected: true,
+		},
+		{
+			input:        FromStrings("", "invalid"),
+			expected:     false,
+			utf8Expected: false,
 		},
 	} {
 		t.Run("", func(t *testing.T) {
 			require.Equal(t, test.expected, test.input.IsValid())
+			require.Equal(t, test.expected, test.input.IsValidWithScheme(model.LegacyValidation))
+			require.Equal(t, test.utf8Expected, test.input.IsValidWithScheme(model.UTF8Validation))
 		})
 	}
 }
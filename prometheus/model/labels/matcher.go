@@ -15,6 +15,8 @@ package labels
 
 import (
 	"fmt"
+
+	"github.com/liticer/gclients/prometheus/model/strutil"
 )
 
 // MatchType is an enum for label matching types.
@@ -78,7 +80,7 @@ func MustNewMatcher(mt MatchType, name, val string) *Matcher {
 }
 
 func (m *Matcher) String() string {
-	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+	return fmt.Sprintf("%s%s%s", strutil.QuoteLabelName(m.Name), m.Type, strutil.Quote(m.Value))
 }
 
 // Matches returns whether the matcher matches the given string value.
@@ -88,6 +88,14 @@ func TestMatcher(t *testing.T) {
 	}
 }
 
+func TestMatcherString(t *testing.T) {
+	require.Equal(t, `job="api"`, MustNewMatcher(MatchEqual, "job", "api").String())
+	require.Equal(t, `job!~"a\\.b"`, MustNewMatcher(MatchNotRegexp, "job", `a\.b`).String())
+	// Label names which are no legacy identifiers are quoted.
+	require.Equal(t, `"service.name"="api"`, MustNewMatcher(MatchEqual, "service.name", "api").String())
+	require.Equal(t, `"中文"!="a"`, MustNewMatcher(MatchNotEqual, "中文", "a").String())
+}
+
 func TestInverse(t *testing.T) {
 	tests := []struct {
 		matcher  *Matcher
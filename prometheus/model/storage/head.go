@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+// Head is an in-memory storage of float series. Samples can be appended
+// concurrently through its Appenders, and it can be queried while they are.
+type Head struct {
+	mtx     sync.RWMutex
+	hashes  map[uint64][]*memSeries // Series by the hash of their labels.
+	refs    map[SeriesRef]*memSeries
+	lastRef SeriesRef
+}
+
+// NewHead returns an empty Head.
+func NewHead() *Head {
+	return &Head{
+		hashes: map[uint64][]*memSeries{},
+		refs:   map[SeriesRef]*memSeries{},
+	}
+}
+
+// memSeries is a series of the Head. Its samples are sorted by timestamp.
+type memSeries struct {
+	ref  SeriesRef
+	lset labels.Labels
+
+	mtx     sync.Mutex
+	samples []Sample
+}
+
+// maxTime returns the timestamp of the last sample, or math.MinInt64 if
+// there is none. It must be called with s.mtx held.
+func (s *memSeries) maxTime() int64 {
+	if len(s.samples) == 0 {
+		return math.MinInt64
+	}
+	return s.samples[len(s.samples)-1].Timestamp
+}
+
+// appendable checks whether a sample with the given timestamp and value
+// can be appended. It returns false without error for a duplicate of the
+// last sample, which is dropped silently. It must be called with s.mtx held.
+func (s *memSeries) appendable(t int64, v float64) (bool, error) {
+	switch maxt := s.maxTime(); {
+	case t > maxt:
+		return true, nil
+	case t < maxt:
+		return false, ErrOutOfOrderSample
+	case math.Float64bits(v) != math.Float64bits(s.samples[len(s.samples)-1].Value):
+		return false, ErrDuplicateSampleForTimestamp
+	default:
+		return false, nil
+	}
+}
+
+// window returns the samples with mint <= t <= maxt. The returned slice
+// is not modified by later appends.
+func (s *memSeries) window(mint, maxt int64) []Sample {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp >= mint })
+	j := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp > maxt })
+	return s.samples[i:j:j]
+}
+
+// hasSamples returns whether the series has samples with mint <= t <= maxt.
+func (s *memSeries) hasSamples(mint, maxt int64) bool {
+	return len(s.window(mint, maxt)) > 0
+}
+
+// getOrCreate returns the series with the given labels, creating it if it
+// does not exist yet.
+func (h *Head) getOrCreate(lset labels.Labels) *memSeries {
+	hash := lset.Hash()
+
+	h.mtx.RLock()
+	s := h.getByHash(hash, lset)
+	h.mtx.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	// The series may have been created since the read lock was released.
+	if s := h.getByHash(hash, lset); s != nil {
+		return s
+	}
+	h.lastRef++
+	s = &memSeries{ref: h.lastRef, lset: lset}
+	h.hashes[hash] = append(h.hashes[hash], s)
+	h.refs[s.ref] = s
+	return s
+}
+
+// getByHash returns the series with the given labels and hash. It must be
+// called with h.mtx held.
+func (h *Head) getByHash(hash uint64, lset labels.Labels) *memSeries {
+	for _, s := range h.hashes[hash] {
+		if labels.Equal(s.lset, lset) {
+			return s
+		}
+	}
+	return nil
+}
+
+// getByRef returns the series with the given reference, or nil.
+func (h *Head) getByRef(ref SeriesRef) *memSeries {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.refs[ref]
+}
+
+// NumSeries returns the number of series in the Head.
+func (h *Head) NumSeries() int {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return len(h.refs)
+}
+
+// allSeries returns all series of the Head.
+func (h *Head) allSeries() []*memSeries {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	series := make([]*memSeries, 0, len(h.refs))
+	for _, s := range h.refs {
+		series = append(series, s)
+	}
+	return series
+}
+
+// Appender implements Appendable. Samples become visible to queries once
+// the Appender is committed.
+func (h *Head) Appender(_ context.Context) Appender {
+	return &headAppender{head: h}
+}
+
+type headSample struct {
+	series *memSeries
+	Sample
+}
+
+type headAppender struct {
+	head    *Head
+	samples []headSample
+}
+
+func (a *headAppender) Append(ref SeriesRef, lset labels.Labels, t int64, v float64) (SeriesRef, error) {
+	s := a.head.getByRef(ref)
+	if s == nil {
+		if lset.IsEmpty() {
+			return 0, fmt.Errorf("empty labelset: %w", ErrInvalidSample)
+		}
+		if l, dup := lset.HasDuplicateLabelNames(); dup {
+			return 0, fmt.Errorf("label name %q is not unique: %w", l, ErrInvalidSample)
+		}
+		s = a.head.getOrCreate(lset)
+	}
+
+	// Check the sample against the committed samples and the ones appended
+	// before in this batch.
+	maxt := int64(math.MinInt64)
+	for i := len(a.samples) - 1; i >= 0; i-- {
+		if a.samples[i].series == s {
+			maxt = a.samples[i].Timestamp
+			break
+		}
+	}
+	switch {
+	case maxt == math.MinInt64:
+		s.mtx.Lock()
+		_, err := s.appendable(t, v)
+		s.mtx.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	case t < maxt:
+		return 0, ErrOutOfOrderSample
+	case t == maxt:
+		return 0, ErrDuplicateSampleForTimestamp
+	}
+
+	a.samples = append(a.samples, headSample{series: s, Sample: Sample{Timestamp: t, Value: v}})
+	return s.ref, nil
+}
+
+// Commit appends the samples of the batch atomically. If any of them became
+// out of order because of a concurrent commit, none is appended.
+func (a *headAppender) Commit() error {
+	defer func() { a.samples = nil }()
+
+	// Lock the series in the order of their references to not deadlock with
+	// concurrent commits.
+	var series []*memSeries
+	seen := map[*memSeries]struct{}{}
+	for _, hs := range a.samples {
+		if _, ok := seen[hs.series]; !ok {
+			seen[hs.series] = struct{}{}
+			series = append(series, hs.series)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].ref < series[j].ref })
+	for _, s := range series {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+	}
+
+	// Samples within the batch are in order per series, so only the first
+	// sample of each series has to be checked against the committed ones.
+	appendable := make([]bool, len(a.samples))
+	checked := map[*memSeries]struct{}{}
+	for i, hs := range a.samples {
+		if _, ok := checked[hs.series]; ok {
+			appendable[i] = true
+			continue
+		}
+		checked[hs.series] = struct{}{}
+
+		ok, err := hs.series.appendable(hs.Timestamp, hs.Value)
+		if err != nil {
+			return fmt.Errorf("series %s: %w", hs.series.lset, err)
+		}
+		appendable[i] = ok
+	}
+	for i, hs := range a.samples {
+		if appendable[i] {
+			hs.series.samples = append(hs.series.samples, hs.Sample)
+		}
+	}
+	return nil
+}
+
+func (a *headAppender) Rollback() error {
+	a.samples = nil
+	return nil
+}
+
+// Querier implements Queryable.
+func (h *Head) Querier(mint, maxt int64) (Querier, error) {
+	return &headQuerier{head: h, mint: mint, maxt: maxt}, nil
+}
+
+type headQuerier struct {
+	head       *Head
+	mint, maxt int64
+}
+
+// series returns the series matching all matchers with samples in the time
+// range of the querier, sorted by labels.
+func (q *headQuerier) series(ctx context.Context, mint, maxt int64, matchers []*labels.Matcher) ([]*memSeries, error) {
+	var res []*memSeries
+	for _, s := range q.head.allSeries() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if matches(s.lset, matchers) && s.hasSamples(mint, maxt) {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return labels.Compare(res[i].lset, res[j].lset) < 0 })
+	return res, nil
+}
+
+func matches(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *headQuerier) Select(ctx context.Context, hints *SelectHints, matchers ...*labels.Matcher) SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = max(mint, hints.Start), min(maxt, hints.End)
+	}
+
+	series, err := q.series(ctx, mint, maxt, matchers)
+	if err != nil {
+		return ErrSeriesSet(err)
+	}
+	res := make([]Series, 0, len(series))
+	for _, s := range series {
+		res = append(res, NewListSeries(s.lset, s.window(mint, maxt)))
+	}
+	return NewListSeriesSet(res, nil)
+}
+
+func (q *headQuerier) LabelValues(ctx context.Context, name string, matchers ...*labels.Matcher) ([]string, Warnings, error) {
+	series, err := q.series(ctx, q.mint, q.maxt, matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := map[string]struct{}{}
+	for _, s := range series {
+		if v := s.lset.Get(name); v != "" {
+			values[v] = struct{}{}
+		}
+	}
+	return sortedKeys(values), nil, nil
+}
+
+func (q *headQuerier) LabelNames(ctx context.Context, matchers ...*labels.Matcher) ([]string, Warnings, error) {
+	series, err := q.series(ctx, q.mint, q.maxt, matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := map[string]struct{}{}
+	for _, s := range series {
+		s.lset.Range(func(l labels.Label) {
+			names[l.Name] = struct{}{}
+		})
+	}
+	return sortedKeys(names), nil, nil
+}
+
+func (q *headQuerier) Close() error { return nil }
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+type series struct {
+	lset    labels.Labels
+	samples []Sample
+}
+
+// readSeriesSet reads all series and samples of ss.
+func readSeriesSet(t *testing.T, ss SeriesSet) []series {
+	var res []series
+	for ss.Next() {
+		s := series{lset: ss.At().Labels()}
+		it := ss.At().Iterator()
+		for it.Next() == ValFloat {
+			ts, v := it.At()
+			s.samples = append(s.samples, Sample{Timestamp: ts, Value: v})
+		}
+		require.NoError(t, it.Err())
+		res = append(res, s)
+	}
+	require.NoError(t, ss.Err())
+	return res
+}
+
+func appendSamples(t *testing.T, h *Head, lset labels.Labels, samples ...Sample) {
+	app := h.Appender(context.Background())
+	for _, s := range samples {
+		_, err := app.Append(0, lset, s.Timestamp, s.Value)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+}
+
+func TestHeadSelect(t *testing.T) {
+	h := NewHead()
+	var (
+		a = labels.FromStrings("__name__", "up", "job", "a")
+		b = labels.FromStrings("__name__", "up", "job", "b", "instance", "1")
+		c = labels.FromStrings("__name__", "down", "job", "a")
+	)
+	appendSamples(t, h, b, Sample{0, 1}, Sample{10, 2}, Sample{20, 3})
+	appendSamples(t, h, a, Sample{5, 10}, Sample{15, 20})
+	appendSamples(t, h, c, Sample{100, 1})
+	require.Equal(t, 3, h.NumSeries())
+
+	q, err := h.Querier(0, 50)
+	require.NoError(t, err)
+	defer q.Close()
+
+	cases := []struct {
+		hints    *SelectHints
+		matchers []*labels.Matcher
+		exp      []series
+	}{
+		{
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")},
+			exp: []series{
+				{lset: b, samples: []Sample{{0, 1}, {10, 2}, {20, 3}}},
+				{lset: a, samples: []Sample{{5, 10}, {15, 20}}},
+			},
+		},
+		{
+			hints:    &SelectHints{Start: 10, End: 15},
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "job", "a|b")},
+			exp: []series{
+				{lset: b, samples: []Sample{{10, 2}}},
+				{lset: a, samples: []Sample{{15, 20}}},
+			},
+		},
+		{
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "instance", "")},
+			exp: []series{
+				{lset: a, samples: []Sample{{5, 10}, {15, 20}}},
+			},
+		},
+		{
+			// Series without samples in the time range are not selected.
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "down")},
+		},
+		{
+			hints:    &SelectHints{Start: 16, End: 19},
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "job", "")},
+		},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			require.Equal(t, c.exp, readSeriesSet(t, q.Select(context.Background(), c.hints, c.matchers...)))
+		})
+	}
+}
+
+func TestHeadSelectCanceled(t *testing.T) {
+	h := NewHead()
+	appendSamples(t, h, labels.FromStrings("__name__", "up"), Sample{0, 1})
+
+	q, err := h.Querier(0, 10)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ss := q.Select(ctx, nil)
+	require.False(t, ss.Next())
+	require.ErrorIs(t, ss.Err(), context.Canceled)
+
+	_, _, err = q.LabelNames(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	_, _, err = q.LabelValues(ctx, "__name__")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHeadLabels(t *testing.T) {
+	h := NewHead()
+	appendSamples(t, h, labels.FromStrings("__name__", "up", "job", "b", "instance", "1"), Sample{0, 1})
+	appendSamples(t, h, labels.FromStrings("__name__", "up", "job", "a"), Sample{10, 1})
+	appendSamples(t, h, labels.FromStrings("__name__", "down", "env", "prod"), Sample{100, 1})
+
+	q, err := h.Querier(0, 50)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	names, ws, err := q.LabelNames(ctx)
+	require.NoError(t, err)
+	require.Empty(t, ws)
+	require.Equal(t, []string{"__name__", "instance", "job"}, names)
+
+	names, _, err = q.LabelNames(ctx, labels.MustNewMatcher(labels.MatchEqual, "job", "a"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"__name__", "job"}, names)
+
+	values, _, err := q.LabelValues(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, values)
+
+	values, _, err = q.LabelValues(ctx, "instance", labels.MustNewMatcher(labels.MatchEqual, "job", "a"))
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	values, _, err = q.LabelValues(ctx, "env")
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestHeadAppend(t *testing.T) {
+	h := NewHead()
+	lset := labels.FromStrings("__name__", "up")
+	ctx := context.Background()
+
+	app := h.Appender(ctx)
+	ref, err := app.Append(0, lset, 10, 1)
+	require.NoError(t, err)
+	require.NotZero(t, ref)
+
+	// Samples must be in order within a batch.
+	_, err = app.Append(ref, labels.EmptyLabels(), 5, 1)
+	require.ErrorIs(t, err, ErrOutOfOrderSample)
+	_, err = app.Append(ref, labels.EmptyLabels(), 10, 2)
+	require.ErrorIs(t, err, ErrDuplicateSampleForTimestamp)
+
+	// The reference identifies the series.
+	ref2, err := app.Append(ref, labels.EmptyLabels(), 20, 2)
+	require.NoError(t, err)
+	require.Equal(t, ref, ref2)
+
+	_, err = app.Append(0, labels.EmptyLabels(), 30, 1)
+	require.ErrorIs(t, err, ErrInvalidSample)
+	dup := labels.NewScratchBuilder(2)
+	dup.Add("a", "1")
+	dup.Add("a", "2")
+	_, err = app.Append(0, dup.Labels(), 30, 1)
+	require.ErrorIs(t, err, ErrInvalidSample)
+
+	// Samples are not visible before the commit.
+	q, err := h.Querier(math.MinInt64, math.MaxInt64)
+	require.NoError(t, err)
+	require.Empty(t, readSeriesSet(t, q.Select(ctx, nil)))
+
+	require.NoError(t, app.Commit())
+	exp := []series{{lset: lset, samples: []Sample{{10, 1}, {20, 2}}}}
+	require.Equal(t, exp, readSeriesSet(t, q.Select(ctx, nil)))
+
+	// Samples must be in order with the committed ones. A duplicate of the
+	// last sample is dropped silently.
+	app = h.Appender(ctx)
+	_, err = app.Append(0, lset, 15, 1)
+	require.ErrorIs(t, err, ErrOutOfOrderSample)
+	_, err = app.Append(0, lset, 20, 3)
+	require.ErrorIs(t, err, ErrDuplicateSampleForTimestamp)
+	_, err = app.Append(0, lset, 20, 2)
+	require.NoError(t, err)
+	_, err = app.Append(0, lset, 30, 3)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	exp = []series{{lset: lset, samples: []Sample{{10, 1}, {20, 2}, {30, 3}}}}
+	require.Equal(t, exp, readSeriesSet(t, q.Select(ctx, nil)))
+
+	// Rolled back samples are discarded.
+	app = h.Appender(ctx)
+	_, err = app.Append(0, lset, 40, 4)
+	require.NoError(t, err)
+	require.NoError(t, app.Rollback())
+	require.Equal(t, exp, readSeriesSet(t, q.Select(ctx, nil)))
+}
+
+func TestHeadCommitConflict(t *testing.T) {
+	h := NewHead()
+	var (
+		a   = labels.FromStrings("__name__", "a")
+		b   = labels.FromStrings("__name__", "b")
+		ctx = context.Background()
+	)
+
+	app1 := h.Appender(ctx)
+	_, err := app1.Append(0, a, 10, 1)
+	require.NoError(t, err)
+	_, err = app1.Append(0, b, 10, 1)
+	require.NoError(t, err)
+
+	app2 := h.Appender(ctx)
+	_, err = app2.Append(0, b, 20, 2)
+	require.NoError(t, err)
+	require.NoError(t, app2.Commit())
+
+	// The sample of b is out of order now, so none of the batch is appended.
+	require.ErrorIs(t, app1.Commit(), ErrOutOfOrderSample)
+
+	q, err := h.Querier(0, 100)
+	require.NoError(t, err)
+	exp := []series{{lset: b, samples: []Sample{{20, 2}}}}
+	require.Equal(t, exp, readSeriesSet(t, q.Select(ctx, nil)))
+}
+
+func TestHeadConcurrentAppend(t *testing.T) {
+	const (
+		writers = 8
+		samples = 1000
+	)
+	h := NewHead()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			own := labels.FromStrings("__name__", "own", "writer", fmt.Sprint(w))
+			shared := labels.FromStrings("__name__", "shared")
+
+			var ref SeriesRef
+			for i := 0; i < samples; i++ {
+				app := h.Appender(ctx)
+				var err error
+				ref, err = app.Append(ref, own, int64(i), float64(i))
+				if err == nil {
+					err = app.Commit()
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				// Writers race on the shared series, so only some of
+				// their samples make it.
+				app = h.Appender(ctx)
+				if _, err := app.Append(0, shared, int64(i), float64(i)); err != nil {
+					_ = app.Rollback()
+					continue
+				}
+				_ = app.Commit()
+			}
+		}(w)
+	}
+
+	// Query while appending.
+	for i := 0; i < 10; i++ {
+		q, err := h.Querier(0, samples)
+		require.NoError(t, err)
+		for _, s := range readSeriesSet(t, q.Select(ctx, nil)) {
+			for j := 1; j < len(s.samples); j++ {
+				require.Less(t, s.samples[j-1].Timestamp, s.samples[j].Timestamp)
+			}
+		}
+	}
+	wg.Wait()
+
+	q, err := h.Querier(0, samples)
+	require.NoError(t, err)
+	res := readSeriesSet(t, q.Select(ctx, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "own")))
+	require.Len(t, res, writers)
+	for _, s := range res {
+		require.Len(t, s.samples, samples)
+	}
+
+	res = readSeriesSet(t, q.Select(ctx, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "shared")))
+	require.Len(t, res, 1)
+	for j := 1; j < len(res[0].samples); j++ {
+		require.Less(t, res[0].samples[j-1].Timestamp, res[0].samples[j].Timestamp)
+	}
+}
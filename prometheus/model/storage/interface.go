@@ -14,12 +14,162 @@
 package storage
 
 import (
+	"context"
+	"errors"
+
 	"github.com/liticer/gclients/prometheus/model/labels"
 )
 
+// The errors exposed.
+var (
+	ErrNotFound                    = errors.New("not found")
+	ErrOutOfOrderSample            = errors.New("out of order sample")
+	ErrDuplicateSampleForTimestamp = errors.New("duplicate sample for timestamp")
+	ErrInvalidSample               = errors.New("invalid sample")
+)
+
+// SeriesRef is a generic series reference. In the in-memory Head it is the
+// ID of the series.
+type SeriesRef uint64
+
+// Appendable allows creating appenders.
+type Appendable interface {
+	// Appender returns a new appender for the storage. The implementation
+	// can choose whether or not to use the context, for deadlines or to check
+	// for errors.
+	Appender(ctx context.Context) Appender
+}
+
+// Appender provides batched appends against a storage.
+// It must be completed with a call to Commit or Rollback and must not be reused afterwards.
+//
+// Operations on the Appender interface are not goroutine-safe.
+type Appender interface {
+	// Append adds a sample pair for the given series.
+	// An optional series reference can be provided to accelerate calls.
+	// A series reference number is returned which can be used to add further
+	// samples to the given series in the same or later transactions.
+	// Returned reference numbers are ephemeral and may be rejected in calls
+	// to Append() at any point. Adding the sample via Append() returns a new
+	// reference number.
+	// If the reference is 0 it must not be used for caching.
+	Append(ref SeriesRef, l labels.Labels, t int64, v float64) (SeriesRef, error)
+
+	// Commit submits the collected samples and purges the batch. If Commit
+	// returns a non-nil error, it also rolls back all modifications made in
+	// the appender so far, as Rollback would do. In any case, an Appender
+	// must not be used anymore after Commit has been called.
+	Commit() error
+
+	// Rollback rolls back all modifications made in the appender so far.
+	// Appender has to be discarded after rollback.
+	Rollback() error
+}
+
+// Queryable handles queries against a storage.
+// Use it when you need to have access to all samples without chunk encoding abstraction e.g promQL.
+type Queryable interface {
+	// Querier returns a new Querier on the storage.
+	Querier(mint, maxt int64) (Querier, error)
+}
+
+// QueryableFunc is an adapter to allow the use of ordinary functions as
+// Queryables. It follows the idea of http.HandlerFunc.
+type QueryableFunc func(mint, maxt int64) (Querier, error)
+
+// Querier calls f() with the given parameters.
+func (f QueryableFunc) Querier(mint, maxt int64) (Querier, error) {
+	return f(mint, maxt)
+}
+
+// Querier provides querying access over time series data of a fixed time range.
+type Querier interface {
+	LabelQuerier
+
+	// Select returns a set of series that matches the given label matchers,
+	// sorted by their labels.
+	// hints can be nil, in which case the querier's time range applies.
+	Select(ctx context.Context, hints *SelectHints, matchers ...*labels.Matcher) SeriesSet
+}
+
+// LabelQuerier provides querying access over labels.
+type LabelQuerier interface {
+	// LabelValues returns all potential values for a label name in sorted order.
+	// If matchers are specified the returned result set is reduced
+	// to label values of metrics matching the matchers.
+	LabelValues(ctx context.Context, name string, matchers ...*labels.Matcher) ([]string, Warnings, error)
+
+	// LabelNames returns all the unique label names present in sorted order.
+	// If matchers are specified the returned result set is reduced
+	// to label names of metrics matching the matchers.
+	LabelNames(ctx context.Context, matchers ...*labels.Matcher) ([]string, Warnings, error)
+
+	// Close releases the resources of the Querier.
+	Close() error
+}
+
+// SelectHints specifies hints passed for data selections.
+// This is used only as an option for implementation to use.
+type SelectHints struct {
+	Start int64 // Start time in milliseconds for this select.
+	End   int64 // End time in milliseconds for this select.
+
+	Step  int64 // Query step size in milliseconds.
+	Range int64 // Range vector selector range in milliseconds.
+}
+
 // Series exposes a single time series and allows iterating over samples.
 type Series interface {
 	Labels
+	SampleIterable
+}
+
+// SampleIterable allows to iterate over the samples of a time series.
+type SampleIterable interface {
+	// Iterator returns a new iterator over the samples of the series.
+	Iterator() Iterator
+}
+
+// ValueType defines the type of the value an Iterator points to. Iterators
+// only return ValFloat for now; other sample types such as native histograms
+// get their own ValueType and accessor, so callers must skip values of types
+// they do not handle.
+type ValueType uint8
+
+// Possible values for ValueType.
+const (
+	ValNone  ValueType = iota // No value at the current position.
+	ValFloat                  // A simple float, retrieved with At.
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValNone:
+		return "none"
+	case ValFloat:
+		return "float"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Iterator iterates over the samples of a time series, in timestamp-increasing order.
+type Iterator interface {
+	// Next advances the iterator by one and returns the type of the value
+	// at the new position, or ValNone if the iterator is exhausted.
+	Next() ValueType
+	// SeekTo advances the iterator forward to the first sample with a timestamp
+	// equal or greater than t. If the current sample satisfies this, the
+	// iterator is not advanced. It returns the type of the value at the new
+	// position, or ValNone if the iterator is exhausted.
+	SeekTo(t int64) ValueType
+	// At returns the current timestamp/value pair if the value is a float.
+	At() (int64, float64)
+	// AtT returns the current timestamp.
+	AtT() int64
+	// Err returns the current error. It should be used only after the
+	// iterator is exhausted, i.e. Next or SeekTo returned ValNone.
+	Err() error
 }
 
 // Labels represents an item that has labels e.g. time series.
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+// Sample is a single float sample of a series.
+type Sample struct {
+	// Timestamp in milliseconds.
+	Timestamp int64
+	Value     float64
+}
+
+type listSeries struct {
+	labels  labels.Labels
+	samples []Sample
+}
+
+// NewListSeries returns a series holding the given samples, which must be
+// sorted by timestamp.
+func NewListSeries(lset labels.Labels, samples []Sample) Series {
+	return &listSeries{labels: lset, samples: samples}
+}
+
+func (s *listSeries) Labels() labels.Labels { return s.labels }
+
+func (s *listSeries) Iterator() Iterator { return NewListSeriesIterator(s.samples) }
+
+type listSeriesIterator struct {
+	samples []Sample
+	idx     int
+}
+
+// NewListSeriesIterator returns an iterator over the given samples, which
+// must be sorted by timestamp.
+func NewListSeriesIterator(samples []Sample) Iterator {
+	return &listSeriesIterator{samples: samples, idx: -1}
+}
+
+func (it *listSeriesIterator) At() (int64, float64) {
+	s := it.samples[it.idx]
+	return s.Timestamp, s.Value
+}
+
+func (it *listSeriesIterator) AtT() int64 {
+	return it.samples[it.idx].Timestamp
+}
+
+func (it *listSeriesIterator) Next() ValueType {
+	it.idx++
+	if it.idx >= len(it.samples) {
+		return ValNone
+	}
+	return ValFloat
+}
+
+func (it *listSeriesIterator) SeekTo(t int64) ValueType {
+	if it.idx == -1 {
+		it.idx = 0
+	}
+	if it.idx >= len(it.samples) {
+		return ValNone
+	}
+	// No-op check.
+	if it.samples[it.idx].Timestamp >= t {
+		return ValFloat
+	}
+	// Do binary search between current position and end.
+	it.idx += sort.Search(len(it.samples)-it.idx, func(i int) bool {
+		return it.samples[i+it.idx].Timestamp >= t
+	})
+	if it.idx >= len(it.samples) {
+		return ValNone
+	}
+	return ValFloat
+}
+
+func (it *listSeriesIterator) Err() error { return nil }
+
+type listSeriesSet struct {
+	series   []Series
+	idx      int
+	warnings Warnings
+}
+
+// NewListSeriesSet returns a SeriesSet over the given series.
+func NewListSeriesSet(series []Series, warnings Warnings) SeriesSet {
+	return &listSeriesSet{series: series, idx: -1, warnings: warnings}
+}
+
+func (s *listSeriesSet) Next() bool {
+	s.idx++
+	return s.idx < len(s.series)
+}
+
+func (s *listSeriesSet) At() Series { return s.series[s.idx] }
+
+func (s *listSeriesSet) Err() error { return nil }
+
+func (s *listSeriesSet) Warnings() Warnings { return s.warnings }
+
+type errSeriesSet struct {
+	err error
+}
+
+// ErrSeriesSet returns a SeriesSet failing with the given error.
+func ErrSeriesSet(err error) SeriesSet {
+	return errSeriesSet{err: err}
+}
+
+func (s errSeriesSet) Next() bool         { return false }
+func (s errSeriesSet) At() Series         { return nil }
+func (s errSeriesSet) Err() error         { return s.err }
+func (s errSeriesSet) Warnings() Warnings { return nil }
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+func TestListSeriesIterator(t *testing.T) {
+	it := NewListSeriesIterator([]Sample{{0, 0}, {1, 1}, {1, 1.5}, {2, 2}, {3, 3}})
+
+	// Seek to the first sample.
+	require.Equal(t, ValFloat, it.SeekTo(0))
+	ts, v := it.At()
+	require.Equal(t, int64(0), ts)
+	require.Equal(t, float64(0), v)
+
+	// Seek one further, next sample still within the range.
+	require.Equal(t, ValFloat, it.SeekTo(1))
+	require.Equal(t, int64(1), it.AtT())
+
+	// Seek to a sample that is already passed does not move the iterator.
+	require.Equal(t, ValFloat, it.SeekTo(0))
+	require.Equal(t, int64(1), it.AtT())
+
+	require.Equal(t, ValFloat, it.Next())
+	ts, v = it.At()
+	require.Equal(t, int64(1), ts)
+	require.Equal(t, 1.5, v)
+
+	// Seek beyond the end.
+	require.Equal(t, ValNone, it.SeekTo(5))
+	// And we don't go back.
+	require.Equal(t, ValNone, it.SeekTo(2))
+	require.Equal(t, ValNone, it.Next())
+	require.NoError(t, it.Err())
+
+	// Seek on an empty iterator.
+	require.Equal(t, ValNone, NewListSeriesIterator(nil).SeekTo(0))
+}
+
+func TestListSeriesSet(t *testing.T) {
+	var (
+		a = NewListSeries(labels.FromStrings("a", "1"), []Sample{{1, 1}})
+		b = NewListSeries(labels.FromStrings("b", "2"), nil)
+	)
+	ss := NewListSeriesSet([]Series{a, b}, Warnings{errors.New("warning")})
+
+	require.True(t, ss.Next())
+	require.Equal(t, a, ss.At())
+	require.True(t, ss.Next())
+	require.Equal(t, b, ss.At())
+	require.Equal(t, ValNone, ss.At().Iterator().Next())
+	require.False(t, ss.Next())
+	require.NoError(t, ss.Err())
+	require.Equal(t, Warnings{errors.New("warning")}, ss.Warnings())
+}
+
+func TestErrSeriesSet(t *testing.T) {
+	err := errors.New("failed")
+	ss := ErrSeriesSet(err)
+
+	require.False(t, ss.Next())
+	require.Nil(t, ss.At())
+	require.Equal(t, err, ss.Err())
+	require.Empty(t, ss.Warnings())
+}
+
+func TestValueTypeString(t *testing.T) {
+	require.Equal(t, "none", ValNone.String())
+	require.Equal(t, "float", ValFloat.String())
+	require.Equal(t, "<unknown>", ValueType(42).String())
+}
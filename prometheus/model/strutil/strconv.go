@@ -16,9 +16,11 @@ package strutil
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/grafana/regexp"
+	"github.com/prometheus/common/model"
 )
 
 var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
@@ -37,6 +39,22 @@ func GraphLinkForExpression(expr string) string {
 	return fmt.Sprintf("/graph?g0.expr=%s&g0.tab=0", escapedExpression)
 }
 
+// Quote returns a double-quoted PromQL string literal representing s, which
+// Unquote turns back into s. Quotes, backslashes and non-printable characters
+// are escaped, so the result is safe to embed into a query.
+func Quote(s string) string {
+	return strconv.Quote(s)
+}
+
+// QuoteLabelName returns the label name as is if it is a valid legacy label
+// name, and quoted with Quote otherwise, as PromQL requires for UTF-8 names.
+func QuoteLabelName(name string) string {
+	if model.LegacyValidation.IsValidLabelName(name) {
+		return name
+	}
+	return Quote(name)
+}
+
 // SanitizeLabelName replaces anything that doesn't match
 // client_label.LabelNameRE with an underscore.
 // Note: this does not handle all Prometheus label name restrictions (such as
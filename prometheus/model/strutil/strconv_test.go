@@ -77,3 +77,22 @@ func TestSanitizeFullLabelName(t *testing.T) {
 	expected = "_"
 	require.Equal(t, expected, actual, "SanitizeFullLabelName failed for the empty label")
 }
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"", "foo", `a"b`, `a\b`, "new\nline", "tab\t\x00", "😀 ü", "\xff"} {
+		quoted := Quote(s)
+		unquoted, err := Unquote(quoted)
+		require.NoError(t, err, "Unquote failed for %s", quoted)
+		require.Equal(t, s, unquoted)
+	}
+	require.Equal(t, `"a\"b\\c"`, Quote(`a"b\c`))
+}
+
+func TestQuoteLabelName(t *testing.T) {
+	require.Equal(t, "job", QuoteLabelName("job"))
+	require.Equal(t, "__name__", QuoteLabelName("__name__"))
+	require.Equal(t, `"service.name"`, QuoteLabelName("service.name"))
+	require.Equal(t, `"a:b"`, QuoteLabelName("a:b"))
+	require.Equal(t, `"0a"`, QuoteLabelName("0a"))
+	require.Equal(t, `"ü"`, QuoteLabelName("ü"))
+}
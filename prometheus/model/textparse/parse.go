@@ -0,0 +1,508 @@
+// Package textparse parses the Prometheus text exposition format and
+// OpenMetrics, as served by /metrics endpoints and by /federate.
+package textparse
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/value"
+)
+
+// MetricType is the type of a metric family.
+type MetricType string
+
+// Possible values for MetricType.
+const (
+	MetricTypeCounter        MetricType = "counter"
+	MetricTypeGauge          MetricType = "gauge"
+	MetricTypeHistogram      MetricType = "histogram"
+	MetricTypeGaugeHistogram MetricType = "gaugehistogram"
+	MetricTypeSummary        MetricType = "summary"
+	MetricTypeInfo           MetricType = "info"
+	MetricTypeStateset       MetricType = "stateset"
+	MetricTypeUnknown        MetricType = "unknown"
+)
+
+// Metadata is the metadata of a metric family.
+type Metadata struct {
+	Type MetricType
+	Help string
+	// Unit is only set for OpenMetrics.
+	Unit string
+}
+
+// Exemplar is an exemplar attached to a sample in OpenMetrics.
+type Exemplar struct {
+	Labels labels.Labels
+	Value  float64
+	// Timestamp in milliseconds, only valid if HasTimestamp is set.
+	Timestamp    int64
+	HasTimestamp bool
+}
+
+// Sample is a single sample of the exposition.
+type Sample struct {
+	Labels labels.Labels
+	Value  float64
+	// Timestamp in milliseconds, only valid if HasTimestamp is set.
+	Timestamp    int64
+	HasTimestamp bool
+	// Exemplar is the exemplar of the sample, if any.
+	Exemplar *Exemplar
+}
+
+// Result is a parsed exposition.
+type Result struct {
+	// The samples in the order of the exposition.
+	Samples []Sample
+	// The metadata of the metric families, by family name.
+	Metadata map[string]Metadata
+}
+
+// familySuffixes are the suffixes of the sample names of the metric families.
+var familySuffixes = []string{"_total", "_created", "_count", "_sum", "_bucket", "_gcount", "_gsum", "_info"}
+
+// Lookup returns the name and the metadata of the family of the given
+// metric name, e.g. of "http_requests" for "http_requests_total".
+func (r *Result) Lookup(metricName string) (string, Metadata, bool) {
+	if md, ok := r.Metadata[metricName]; ok {
+		return metricName, md, true
+	}
+	for _, suffix := range familySuffixes {
+		family := strings.TrimSuffix(metricName, suffix)
+		if family == metricName {
+			continue
+		}
+		if md, ok := r.Metadata[family]; ok {
+			return family, md, true
+		}
+	}
+	return "", Metadata{}, false
+}
+
+// IsOpenMetrics returns whether the given Content-Type header denotes OpenMetrics.
+func IsOpenMetrics(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/openmetrics-text"
+}
+
+// Parse parses the exposition b. It is parsed as OpenMetrics if
+// contentType denotes it, and in the text format otherwise.
+func Parse(b []byte, contentType string) (*Result, error) {
+	if IsOpenMetrics(contentType) {
+		return ParseOpenMetrics(b)
+	}
+	return ParseText(b)
+}
+
+// ParseText parses b in the Prometheus text exposition format.
+func ParseText(b []byte) (*Result, error) {
+	p := &parser{openMetrics: false}
+	return p.parse(b)
+}
+
+// ParseOpenMetrics parses b as OpenMetrics.
+func ParseOpenMetrics(b []byte) (*Result, error) {
+	p := &parser{openMetrics: true}
+	return p.parse(b)
+}
+
+type parser struct {
+	openMetrics bool
+
+	res  *Result
+	lb   labels.ScratchBuilder
+	line int
+}
+
+// ParseError is returned for invalid expositions.
+type ParseError struct {
+	Line int
+	Err  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Line: p.line, Err: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parse(b []byte) (*Result, error) {
+	p.res = &Result{Metadata: map[string]Metadata{}}
+	p.lb = labels.NewScratchBuilder(8)
+
+	eof := false
+	for len(b) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			line, b = b, nil
+		}
+		p.line++
+
+		if eof {
+			return nil, p.errorf("unexpected data after # EOF")
+		}
+		if !p.openMetrics {
+			line = bytes.TrimLeft(line, " \t")
+			line = bytes.TrimRight(line, " \t\r")
+		}
+		if len(line) == 0 {
+			if p.openMetrics {
+				return nil, p.errorf("unexpected empty line")
+			}
+			continue
+		}
+
+		var err error
+		if line[0] == '#' {
+			eof, err = p.parseComment(string(line))
+		} else {
+			err = p.parseSample(string(line))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.openMetrics && !eof {
+		return nil, p.errorf("missing # EOF")
+	}
+	return p.res, nil
+}
+
+// parseComment parses a comment line and reports whether it was # EOF.
+func (p *parser) parseComment(line string) (bool, error) {
+	if p.openMetrics && line == "# EOF" {
+		return true, nil
+	}
+
+	var keyword, name, text string
+	if p.openMetrics {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 || fields[0] != "#" {
+			return false, p.errorf("invalid comment %q", line)
+		}
+		keyword, name = fields[1], fields[2]
+		if len(fields) == 4 {
+			text = fields[3]
+		}
+	} else {
+		// Any other comments are allowed in the text format.
+		keyword, text = cutField(line[1:])
+		if keyword != "HELP" && keyword != "TYPE" {
+			return false, nil
+		}
+		name, text = cutField(text)
+	}
+	if !isValidMetricName(name) {
+		return false, p.errorf("invalid metric name %q", name)
+	}
+
+	md := p.res.Metadata[name]
+	switch keyword {
+	case "HELP":
+		help, err := unescape(text, p.openMetrics)
+		if err != nil {
+			return false, p.errorf("invalid help text: %s", err)
+		}
+		md.Help = help
+	case "TYPE":
+		switch t := MetricType(text); t {
+		case MetricTypeCounter, MetricTypeGauge, MetricTypeHistogram, MetricTypeSummary, MetricTypeUnknown:
+			md.Type = t
+		case MetricTypeGaugeHistogram, MetricTypeInfo, MetricTypeStateset:
+			if !p.openMetrics {
+				return false, p.errorf("invalid metric type %q", text)
+			}
+			md.Type = t
+		case "untyped":
+			if p.openMetrics {
+				return false, p.errorf("invalid metric type %q", text)
+			}
+			md.Type = MetricTypeUnknown
+		default:
+			return false, p.errorf("invalid metric type %q", text)
+		}
+	case "UNIT":
+		md.Unit = text
+	default:
+		return false, p.errorf("invalid comment %q", line)
+	}
+	p.res.Metadata[name] = md
+	return false, nil
+}
+
+func (p *parser) parseSample(line string) error {
+	name, rest := splitName(line)
+	if name == "" {
+		return p.errorf("expected metric name, got %q", line)
+	}
+
+	p.lb.Reset()
+	p.lb.Add(labels.MetricName, name)
+	rest, err := p.parseLabels(rest)
+	if err != nil {
+		return err
+	}
+	p.lb.Sort()
+	s := Sample{Labels: p.lb.Labels()}
+	if dup, ok := s.Labels.HasDuplicateLabelNames(); ok {
+		return p.errorf("duplicate label name %q", dup)
+	}
+
+	// The exemplar is separated by " # ".
+	var exemplar string
+	if p.openMetrics {
+		if i := strings.Index(rest, " # "); i >= 0 {
+			rest, exemplar = rest[:i], rest[i+3:]
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if p.openMetrics && rest != " "+strings.Join(fields, " ") {
+		return p.errorf("invalid whitespace in %q", line)
+	}
+	switch len(fields) {
+	case 2:
+		if s.Timestamp, err = p.parseTimestamp(fields[1]); err != nil {
+			return err
+		}
+		s.HasTimestamp = true
+		fallthrough
+	case 1:
+		if s.Value, err = p.parseValue(fields[0]); err != nil {
+			return err
+		}
+	default:
+		return p.errorf("expected value and optional timestamp, got %q", strings.TrimSpace(rest))
+	}
+
+	if exemplar != "" {
+		if s.Exemplar, err = p.parseExemplar(exemplar); err != nil {
+			return err
+		}
+	}
+	p.res.Samples = append(p.res.Samples, s)
+	return nil
+}
+
+func (p *parser) parseExemplar(s string) (*Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, p.errorf("expected exemplar labels, got %q", s)
+	}
+	p.lb.Reset()
+	rest, err := p.parseLabels(s)
+	if err != nil {
+		return nil, err
+	}
+	p.lb.Sort()
+	e := &Exemplar{Labels: p.lb.Labels()}
+
+	fields := strings.Fields(rest)
+	switch len(fields) {
+	case 2:
+		if e.Timestamp, err = p.parseTimestamp(fields[1]); err != nil {
+			return nil, err
+		}
+		e.HasTimestamp = true
+		fallthrough
+	case 1:
+		if e.Value, err = p.parseValue(fields[0]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected exemplar value and optional timestamp, got %q", strings.TrimSpace(rest))
+	}
+	return e, nil
+}
+
+// parseLabels adds the labels in braces at the start of s, if any, to the
+// scratch builder and returns the remainder of s.
+func (p *parser) parseLabels(s string) (string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return s, nil
+	}
+	s = s[1:]
+	for {
+		s = p.skipSpace(s)
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+
+		i := 0
+		for i < len(s) && isLabelNameChar(s[i], i == 0) {
+			i++
+		}
+		if i == 0 {
+			return "", p.errorf("expected label name in %q", s)
+		}
+		name := s[:i]
+		s = p.skipSpace(s[i:])
+		if !strings.HasPrefix(s, "=") {
+			return "", p.errorf("expected = after label name %q", name)
+		}
+		s = p.skipSpace(s[1:])
+		if !strings.HasPrefix(s, `"`) {
+			return "", p.errorf("expected quoted value for label %q", name)
+		}
+
+		value, rest, err := p.parseQuoted(s)
+		if err != nil {
+			return "", err
+		}
+		p.lb.Add(name, value)
+		s = p.skipSpace(rest)
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "}"):
+		default:
+			return "", p.errorf("expected , or } after value of label %q", name)
+		}
+	}
+}
+
+// skipSpace trims leading whitespace, which is only allowed in the text format.
+func (p *parser) skipSpace(s string) string {
+	if p.openMetrics {
+		return s
+	}
+	return strings.TrimLeft(s, " \t")
+}
+
+// parseQuoted parses the double-quoted string at the start of s.
+func (p *parser) parseQuoted(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return sb.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			switch s[i] {
+			case '\\':
+				sb.WriteByte('\\')
+			case '"':
+				sb.WriteByte('"')
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				return "", "", p.errorf("invalid escape sequence \\%c", s[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", p.errorf("unterminated label value")
+}
+
+func (p *parser) parseValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, p.errorf("invalid value %q", s)
+	}
+	if math.IsNaN(v) {
+		// Make sure a NaN in the exposition is never taken for a stale marker.
+		v = math.Float64frombits(value.NormalNaN)
+	}
+	return v, nil
+}
+
+// parseTimestamp parses a timestamp in milliseconds for the text format
+// and in seconds for OpenMetrics, and returns it in milliseconds.
+func (p *parser) parseTimestamp(s string) (int64, error) {
+	if !p.openMetrics {
+		ts, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, p.errorf("invalid timestamp %q", s)
+		}
+		return ts, nil
+	}
+	ts, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return 0, p.errorf("invalid timestamp %q", s)
+	}
+	return int64(math.Round(ts * 1000)), nil
+}
+
+// cutField splits the first whitespace-separated field off s.
+func cutField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " \t")
+}
+
+// splitName splits the metric name off the start of s.
+func splitName(s string) (string, string) {
+	i := 0
+	for i < len(s) && isMetricNameChar(s[i], i == 0) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isValidMetricName(s string) bool {
+	name, rest := splitName(s)
+	return name != "" && rest == ""
+}
+
+func isMetricNameChar(c byte, first bool) bool {
+	return c == ':' || isLabelNameChar(c, first)
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !first && c >= '0' && c <= '9'
+}
+
+// unescape unescapes a help text. Double quotes are only escaped in OpenMetrics.
+func unescape(s string, openMetrics bool) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			sb.WriteByte('\\')
+			break
+		}
+		switch s[i] {
+		case '\\':
+			sb.WriteByte('\\')
+		case 'n':
+			sb.WriteByte('\n')
+		case '"':
+			if !openMetrics {
+				sb.WriteString(`\"`)
+				continue
+			}
+			sb.WriteByte('"')
+		default:
+			if openMetrics {
+				return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,135 @@
+package textparse
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/value"
+)
+
+func TestParseText(t *testing.T) {
+	input := `# HELP go_gc_duration_seconds A summary of the GC invocation durations.
+# 	TYPE go_gc_duration_seconds summary
+go_gc_duration_seconds{quantile="0"} 4.9351e-05
+go_gc_duration_seconds{ quantile = "0.25" ,} 7.424100000000001e-05
+go_gc_duration_seconds_count 99
+# Hello, this is a comment.
+
+# HELP nohelp
+# TYPE go_goroutines gauge
+go_goroutines 33  123123
+# HELP escaped Some \\ escaped \n help with \"quotes\".
+# TYPE escaped untyped
+escaped{a="\"\\\n",b="x # y"} NaN
+escaped{a="inf"} +Inf
+`
+	res, err := ParseText([]byte(input))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]Metadata{
+		"go_gc_duration_seconds": {Type: MetricTypeSummary, Help: "A summary of the GC invocation durations."},
+		"nohelp":                 {},
+		"go_goroutines":          {Type: MetricTypeGauge},
+		"escaped":                {Type: MetricTypeUnknown, Help: "Some \\ escaped \n help with \\\"quotes\\\"."},
+	}, res.Metadata)
+
+	require.Len(t, res.Samples, 6)
+	require.Equal(t, Sample{
+		Labels: labels.FromStrings("__name__", "go_gc_duration_seconds", "quantile", "0.25"),
+		Value:  7.424100000000001e-05,
+	}, res.Samples[1])
+	require.Equal(t, Sample{
+		Labels:       labels.FromStrings("__name__", "go_goroutines"),
+		Value:        33,
+		Timestamp:    123123,
+		HasTimestamp: true,
+	}, res.Samples[3])
+	require.Equal(t, labels.FromStrings("__name__", "escaped", "a", "\"\\\n", "b", "x # y"), res.Samples[4].Labels)
+	require.Equal(t, value.NormalNaN, math.Float64bits(res.Samples[4].Value))
+	require.Equal(t, math.Inf(1), res.Samples[5].Value)
+
+	family, md, ok := res.Lookup("go_gc_duration_seconds_count")
+	require.True(t, ok)
+	require.Equal(t, "go_gc_duration_seconds", family)
+	require.Equal(t, MetricTypeSummary, md.Type)
+}
+
+func TestParseOpenMetrics(t *testing.T) {
+	input := `# HELP http_requests Requests served.
+# TYPE http_requests counter
+# UNIT http_requests requests
+http_requests_total{code="200"} 1027 1520879607.789 # {trace_id="KOO5S4vxi0o"} 0.67 1520879607.7
+http_requests_created{code="200"} 1520430000.123
+# TYPE build info
+build_info{version="1.0"} 1
+# EOF
+`
+	res, err := ParseOpenMetrics([]byte(input))
+	require.NoError(t, err)
+
+	require.Equal(t, Metadata{Type: MetricTypeCounter, Help: "Requests served.", Unit: "requests"}, res.Metadata["http_requests"])
+	require.Equal(t, Metadata{Type: MetricTypeInfo}, res.Metadata["build"])
+	require.Equal(t, []Sample{
+		{
+			Labels:       labels.FromStrings("__name__", "http_requests_total", "code", "200"),
+			Value:        1027,
+			Timestamp:    1520879607789,
+			HasTimestamp: true,
+			Exemplar: &Exemplar{
+				Labels:       labels.FromStrings("trace_id", "KOO5S4vxi0o"),
+				Value:        0.67,
+				Timestamp:    1520879607700,
+				HasTimestamp: true,
+			},
+		},
+		{
+			Labels: labels.FromStrings("__name__", "http_requests_created", "code", "200"),
+			Value:  1520430000.123,
+		},
+		{
+			Labels: labels.FromStrings("__name__", "build_info", "version", "1.0"),
+			Value:  1,
+		},
+	}, res.Samples)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		input       string
+		openMetrics bool
+		err         string
+	}{
+		{input: "a{b=c} 1", err: `line 1: expected quoted value for label "b"`},
+		{input: "a 1 2 3", err: `line 1: expected value and optional timestamp, got "1 2 3"`},
+		{input: "a one", err: `line 1: invalid value "one"`},
+		{input: "a 1 1.5", err: `line 1: invalid timestamp "1.5"`},
+		{input: "a{b=\"\\x\"} 1", err: `line 1: invalid escape sequence \x`},
+		{input: "a{b=\"1\",b=\"2\"} 1", err: `line 1: duplicate label name "b"`},
+		{input: "# TYPE a info", err: `line 1: invalid metric type "info"`},
+		{input: "\n\n{} 1", err: `line 3: expected metric name, got "{} 1"`},
+		{input: "a 1\n", openMetrics: true, err: `line 1: missing # EOF`},
+		{input: "a 1\n# EOF\na 2\n", openMetrics: true, err: `line 3: unexpected data after # EOF`},
+		{input: "a  1\n# EOF", openMetrics: true, err: `line 1: invalid whitespace in "a  1"`},
+		{input: "# comment\n# EOF", openMetrics: true, err: `line 1: invalid comment "# comment"`},
+		{input: "\n# EOF", openMetrics: true, err: `line 1: unexpected empty line`},
+	} {
+		t.Run(c.input, func(t *testing.T) {
+			var err error
+			if c.openMetrics {
+				_, err = ParseOpenMetrics([]byte(c.input))
+			} else {
+				_, err = ParseText([]byte(c.input))
+			}
+			require.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestIsOpenMetrics(t *testing.T) {
+	require.True(t, IsOpenMetrics("application/openmetrics-text; version=1.0.0; charset=utf-8"))
+	require.False(t, IsOpenMetrics("text/plain; version=0.0.4"))
+	require.False(t, IsOpenMetrics(""))
+}
@@ -0,0 +1,486 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+// Builder constructs an expression programmatically instead of concatenating
+// query strings. Label values and string literals are kept as they are and
+// only quoted when the expression is rendered with String(), so they cannot
+// alter the structure of the query.
+//
+// Builders are immutable values and are checked as they are combined. The
+// first error, e.g. a call of rate on an instant vector, is kept and returned
+// by Build.
+//
+//	expr, err := parser.Aggregate(parser.SUM,
+//		parser.Func("rate", parser.Selector("http_requests_total").Eq("tenant", tenant).Range(5*time.Minute)),
+//	).By("job").Build()
+type Builder struct {
+	expr Expr
+	err  error
+}
+
+// Build returns the built expression or the first error that occurred while
+// building it.
+func (b Builder) Build() (Expr, error) {
+	return b.arg()
+}
+
+func (b Builder) withErr(format string, args ...interface{}) Builder {
+	if b.err != nil {
+		return b
+	}
+	return Builder{err: fmt.Errorf(format, args...)}
+}
+
+// Selector returns a builder for a vector selector of the given metric name.
+// The name may be empty if label matchers are added.
+func Selector(name string) Builder {
+	vs := &VectorSelector{}
+	if name == "" {
+		return Builder{expr: vs}
+	}
+	if !model.IsValidLegacyMetricName(name) {
+		return Builder{err: fmt.Errorf("invalid metric name %q", name)}
+	}
+	m, err := labels.NewMatcher(labels.MatchEqual, labels.MetricName, name)
+	if err != nil {
+		return Builder{err: err}
+	}
+	// Names that are lexed as keywords or numbers can only be selected by the
+	// __name__ label.
+	if _, ok := key[strings.ToLower(name)]; !ok {
+		vs.Name = name
+	}
+	vs.LabelMatchers = []*labels.Matcher{m}
+	return Builder{expr: vs}
+}
+
+// Eq adds a label matcher selecting series with the label equal to value.
+func (b Builder) Eq(name, value string) Builder {
+	return b.match(labels.MatchEqual, name, value)
+}
+
+// Neq adds a label matcher selecting series with the label not equal to value.
+func (b Builder) Neq(name, value string) Builder {
+	return b.match(labels.MatchNotEqual, name, value)
+}
+
+// Re adds a label matcher selecting series with the label matching the regular
+// expression re.
+func (b Builder) Re(name, re string) Builder {
+	return b.match(labels.MatchRegexp, name, re)
+}
+
+// Nre adds a label matcher selecting series with the label not matching the
+// regular expression re.
+func (b Builder) Nre(name, re string) Builder {
+	return b.match(labels.MatchNotRegexp, name, re)
+}
+
+func (b Builder) match(t labels.MatchType, name, value string) Builder {
+	if b.err != nil {
+		return b
+	}
+	vs, ok := b.expr.(*VectorSelector)
+	if !ok {
+		return b.withErr("label matchers can only be added to a vector selector, got %s", b.expr)
+	}
+	if !model.LabelName(name).IsValidLegacy() {
+		return b.withErr("invalid label name %q", name)
+	}
+	if name == labels.MetricName && vs.Name != "" {
+		return b.withErr("metric name must not be set twice: %q or %q", vs.Name, value)
+	}
+	m, err := labels.NewMatcher(t, name, value)
+	if err != nil {
+		return b.withErr("invalid label matcher %s: %w", name, err)
+	}
+	// Copy the selector so that builders derived from b are independent.
+	res := *vs
+	res.LabelMatchers = append(vs.LabelMatchers[:len(vs.LabelMatchers):len(vs.LabelMatchers)], m)
+	return Builder{expr: &res}
+}
+
+// Offset sets the offset modifier of a vector or matrix selector.
+func (b Builder) Offset(d time.Duration) Builder {
+	return b.modifySelector("offset", func(vs *VectorSelector) {
+		vs.OriginalOffset = d
+	})
+}
+
+// At sets the @ modifier of a vector or matrix selector.
+func (b Builder) At(t time.Time) Builder {
+	return b.modifySelector("@", func(vs *VectorSelector) {
+		ts := t.UnixMilli()
+		vs.Timestamp = &ts
+		vs.StartOrEnd = 0
+	})
+}
+
+func (b Builder) modifySelector(modifier string, f func(vs *VectorSelector)) Builder {
+	if b.err != nil {
+		return b
+	}
+	switch e := b.expr.(type) {
+	case *VectorSelector:
+		vs := *e
+		f(&vs)
+		return Builder{expr: &vs}
+	case *MatrixSelector:
+		vs := *e.VectorSelector.(*VectorSelector)
+		f(&vs)
+		return Builder{expr: &MatrixSelector{VectorSelector: &vs, Range: e.Range}}
+	default:
+		return b.withErr("%s modifier can only be applied to a selector, got %s", modifier, b.expr)
+	}
+}
+
+// Range turns a vector selector into a matrix selector over the given range.
+func (b Builder) Range(d time.Duration) Builder {
+	if b.err != nil {
+		return b
+	}
+	vs, ok := b.expr.(*VectorSelector)
+	if !ok {
+		return b.withErr("ranges can only be applied to a vector selector, got %s", b.expr)
+	}
+	if d <= 0 {
+		return b.withErr("range must be positive, got %s", d)
+	}
+	if err := checkSelector(vs); err != nil {
+		return Builder{err: err}
+	}
+	return Builder{expr: &MatrixSelector{VectorSelector: vs, Range: d}}
+}
+
+// checkSelector checks that a vector selector cannot match all series.
+func checkSelector(vs *VectorSelector) error {
+	for _, m := range vs.LabelMatchers {
+		if !m.Matches("") {
+			return nil
+		}
+	}
+	return fmt.Errorf("vector selector must contain at least one non-empty matcher")
+}
+
+// Number returns a builder for a number literal.
+func Number(v float64) Builder {
+	return Builder{expr: &NumberLiteral{Val: v}}
+}
+
+// String returns a builder for a string literal.
+func String(s string) Builder {
+	return Builder{expr: &StringLiteral{Val: s}}
+}
+
+// arg returns the expression of b, which is complete once it is used as an
+// argument of another expression.
+func (b Builder) arg() (Expr, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.expr == nil {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if err := checkComplete(b.expr); err != nil {
+		return nil, err
+	}
+	return b.expr, nil
+}
+
+// checkComplete checks the constraints that can only be checked once no
+// further modifiers are applied to the expression.
+func checkComplete(e Expr) error {
+	switch n := e.(type) {
+	case *VectorSelector:
+		return checkSelector(n)
+	case *BinaryExpr:
+		if n.Op.IsComparisonOperator() && !n.ReturnBool && n.LHS.Type() == ValueTypeScalar && n.RHS.Type() == ValueTypeScalar {
+			return fmt.Errorf("comparisons between scalars must use BOOL modifier")
+		}
+	}
+	return nil
+}
+
+func expectType(e Expr, want ValueType, context string) error {
+	if t := e.Type(); t != want {
+		return fmt.Errorf("expected type %s in %s, got %s", DocumentedType(want), context, DocumentedType(t))
+	}
+	return nil
+}
+
+// Func returns a builder for a call of the named function. The function must
+// be in Functions and the arguments must match its argument types.
+func Func(name string, args ...Builder) Builder {
+	f, ok := getFunction(name)
+	if !ok {
+		return Builder{err: fmt.Errorf("unknown function with name %q", name)}
+	}
+
+	nargs := len(f.ArgTypes)
+	if f.Variadic == 0 {
+		if nargs != len(args) {
+			return Builder{err: fmt.Errorf("expected %d argument(s) in call to %q, got %d", nargs, name, len(args))}
+		}
+	} else {
+		na := nargs - 1
+		if na > len(args) {
+			return Builder{err: fmt.Errorf("expected at least %d argument(s) in call to %q, got %d", na, name, len(args))}
+		} else if nargsmax := na + f.Variadic; f.Variadic > 0 && nargsmax < len(args) {
+			return Builder{err: fmt.Errorf("expected at most %d argument(s) in call to %q, got %d", nargsmax, name, len(args))}
+		}
+	}
+
+	call := &Call{Func: f}
+	for i, a := range args {
+		e, err := a.arg()
+		if err != nil {
+			return Builder{err: err}
+		}
+		if i >= nargs {
+			i = nargs - 1
+		}
+		if err := expectType(e, f.ArgTypes[i], fmt.Sprintf("call to function %q", name)); err != nil {
+			return Builder{err: err}
+		}
+		call.Args = append(call.Args, e)
+	}
+	return Builder{expr: call}
+}
+
+// Aggregate returns a builder for the aggregation op, e.g. SUM, over expr.
+// Aggregations taking a parameter are built with AggregateParam.
+func Aggregate(op ItemType, expr Builder) Builder {
+	if op.IsAggregatorWithParam() {
+		return Builder{err: fmt.Errorf("aggregation %q requires a parameter", op)}
+	}
+	return aggregate(op, Builder{}, expr)
+}
+
+// AggregateParam returns a builder for the aggregation op, e.g. TOPK, that
+// takes the parameter param, over expr.
+func AggregateParam(op ItemType, param, expr Builder) Builder {
+	if !op.IsAggregatorWithParam() {
+		return Builder{err: fmt.Errorf("aggregation %q does not take a parameter", op)}
+	}
+	return aggregate(op, param, expr)
+}
+
+func aggregate(op ItemType, param, expr Builder) Builder {
+	if !op.IsAggregator() {
+		return Builder{err: fmt.Errorf("aggregation operator expected in aggregation expression but got %q", op)}
+	}
+	agg := &AggregateExpr{Op: op}
+
+	e, err := expr.arg()
+	if err != nil {
+		return Builder{err: err}
+	}
+	if err := expectType(e, ValueTypeVector, "aggregation expression"); err != nil {
+		return Builder{err: err}
+	}
+	agg.Expr = e
+
+	if op.IsAggregatorWithParam() {
+		p, err := param.arg()
+		if err != nil {
+			return Builder{err: err}
+		}
+		want := ValueTypeScalar
+		if op == COUNT_VALUES {
+			want = ValueTypeString
+		}
+		if err := expectType(p, want, "aggregation parameter"); err != nil {
+			return Builder{err: err}
+		}
+		agg.Param = p
+	}
+	return Builder{expr: agg}
+}
+
+// By sets the labels an aggregation groups by.
+func (b Builder) By(grouping ...string) Builder {
+	return b.group(false, grouping)
+}
+
+// Without sets the labels an aggregation removes from the result.
+func (b Builder) Without(grouping ...string) Builder {
+	return b.group(true, grouping)
+}
+
+func (b Builder) group(without bool, grouping []string) Builder {
+	if b.err != nil {
+		return b
+	}
+	agg, ok := b.expr.(*AggregateExpr)
+	if !ok {
+		return b.withErr("grouping can only be applied to an aggregation, got %s", b.expr)
+	}
+	if err := checkLabelNames(grouping); err != nil {
+		return Builder{err: err}
+	}
+	res := *agg
+	res.Grouping = append([]string(nil), grouping...)
+	res.Without = without
+	return Builder{expr: &res}
+}
+
+func checkLabelNames(names []string) error {
+	for _, n := range names {
+		if !model.LabelName(n).IsValidLegacy() {
+			return fmt.Errorf("invalid label name %q", n)
+		}
+	}
+	return nil
+}
+
+// Binary returns a builder for the binary operation op, e.g. ADD or LAND,
+// between lhs and rhs. Operands that are binary expressions themselves are
+// parenthesized, so the result does not depend on operator precedence.
+func Binary(op ItemType, lhs, rhs Builder) Builder {
+	if !op.IsOperator() {
+		return Builder{err: fmt.Errorf("binary expression does not support operator %q", op)}
+	}
+	l, err := lhs.arg()
+	if err != nil {
+		return Builder{err: err}
+	}
+	r, err := rhs.arg()
+	if err != nil {
+		return Builder{err: err}
+	}
+
+	lt, rt := l.Type(), r.Type()
+	if lt != ValueTypeScalar && lt != ValueTypeVector || rt != ValueTypeScalar && rt != ValueTypeVector {
+		return Builder{err: fmt.Errorf("binary expression must contain only scalar and instant vector types")}
+	}
+	if (lt == ValueTypeScalar || rt == ValueTypeScalar) && op.IsSetOperator() {
+		return Builder{err: fmt.Errorf("set operator %q not allowed in binary scalar expression", op)}
+	}
+
+	// A negative number on the left is parenthesized, as -1 ^ 2 parses as -(1 ^ 2).
+	if n, ok := l.(*NumberLiteral); ok && n.Val < 0 {
+		l = &ParenExpr{Expr: l}
+	}
+	be := &BinaryExpr{Op: op, LHS: parenBinary(l), RHS: parenBinary(r)}
+	if lt == ValueTypeVector && rt == ValueTypeVector {
+		be.VectorMatching = &VectorMatching{Card: CardOneToOne}
+		if op.IsSetOperator() {
+			be.VectorMatching.Card = CardManyToMany
+		}
+	}
+	return Builder{expr: be}
+}
+
+func parenBinary(e Expr) Expr {
+	if _, ok := e.(*BinaryExpr); ok {
+		return &ParenExpr{Expr: e}
+	}
+	return e
+}
+
+// Bool sets the bool modifier of a comparison.
+func (b Builder) Bool() Builder {
+	return b.modifyBinary("bool modifier", func(be *BinaryExpr) error {
+		if !be.Op.IsComparisonOperator() {
+			return fmt.Errorf("bool modifier can only be used on comparison operators")
+		}
+		be.ReturnBool = true
+		return nil
+	})
+}
+
+// On matches the series of both operands of a binary operation on the given
+// labels only.
+func (b Builder) On(matching ...string) Builder {
+	return b.matching(true, matching)
+}
+
+// Ignoring matches the series of both operands of a binary operation on all
+// but the given labels.
+func (b Builder) Ignoring(matching ...string) Builder {
+	return b.matching(false, matching)
+}
+
+func (b Builder) matching(on bool, matching []string) Builder {
+	return b.modifyVectorMatching(func(vm *VectorMatching) error {
+		if err := checkLabelNames(matching); err != nil {
+			return err
+		}
+		vm.On = on
+		vm.MatchingLabels = append([]string(nil), matching...)
+		return nil
+	})
+}
+
+// GroupLeft makes a binary operation many-to-one, copying the given labels
+// from the right operand to the result.
+func (b Builder) GroupLeft(include ...string) Builder {
+	return b.groupSide(CardManyToOne, include)
+}
+
+// GroupRight makes a binary operation one-to-many, copying the given labels
+// from the left operand to the result.
+func (b Builder) GroupRight(include ...string) Builder {
+	return b.groupSide(CardOneToMany, include)
+}
+
+func (b Builder) groupSide(card VectorMatchCardinality, include []string) Builder {
+	return b.modifyVectorMatching(func(vm *VectorMatching) error {
+		if vm.Card == CardManyToMany {
+			return fmt.Errorf("no grouping allowed for set operations")
+		}
+		if err := checkLabelNames(include); err != nil {
+			return err
+		}
+		vm.Card = card
+		vm.Include = append([]string(nil), include...)
+		return nil
+	})
+}
+
+func (b Builder) modifyVectorMatching(f func(vm *VectorMatching) error) Builder {
+	return b.modifyBinary("vector matching", func(be *BinaryExpr) error {
+		if be.VectorMatching == nil {
+			return fmt.Errorf("vector matching only allowed between instant vectors")
+		}
+		vm := *be.VectorMatching
+		if err := f(&vm); err != nil {
+			return err
+		}
+		if vm.On {
+			for _, l1 := range vm.MatchingLabels {
+				for _, l2 := range vm.Include {
+					if l1 == l2 {
+						return fmt.Errorf("label %q must not occur in ON and GROUP clause at once", l1)
+					}
+				}
+			}
+		}
+		be.VectorMatching = &vm
+		return nil
+	})
+}
+
+func (b Builder) modifyBinary(modifier string, f func(be *BinaryExpr) error) Builder {
+	if b.err != nil {
+		return b
+	}
+	be, ok := b.expr.(*BinaryExpr)
+	if !ok {
+		return b.withErr("%s can only be applied to a binary expression, got %s", modifier, b.expr)
+	}
+	res := *be
+	if err := f(&res); err != nil {
+		return Builder{err: err}
+	}
+	return Builder{expr: &res}
+}
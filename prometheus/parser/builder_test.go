@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+
+	cases := []struct {
+		b   Builder
+		out string
+	}{
+		{
+			b:   Selector("up"),
+			out: `up`,
+		},
+		{
+			b:   Selector("up").Eq("tenant", `a"} or vector(1) or up{x="`),
+			out: `up{tenant="a\"} or vector(1) or up{x=\""}`,
+		},
+		{
+			b:   Selector("").Re("job", `api|db\d`).Neq("env", "dev\n"),
+			out: `{env!="dev\n",job=~"api|db\\d"}`,
+		},
+		{
+			b:   Selector("sum").Nre("job", "x"),
+			out: `{__name__="sum",job!~"x"}`,
+		},
+		{
+			b:   Selector("up").Range(5 * time.Minute).Offset(time.Hour).At(at),
+			out: `up[5m] @ 1700000000.000 offset 1h`,
+		},
+		{
+			b: Aggregate(SUM,
+				Func("rate", Selector("http_requests_total").Eq("code", "500").Range(5*time.Minute)),
+			).By("job", "instance"),
+			out: `sum by (job, instance) (rate(http_requests_total{code="500"}[5m]))`,
+		},
+		{
+			b:   AggregateParam(TOPK, Number(3), Selector("up")).Without("instance"),
+			out: `topk without (instance) (3, up)`,
+		},
+		{
+			b:   AggregateParam(COUNT_VALUES, String(`va"l`), Selector("up")),
+			out: `count_values("va\"l", up)`,
+		},
+		{
+			b:   Func("label_replace", Selector("up"), String("dst"), String("$1"), String("src"), String("(.*)")),
+			out: `label_replace(up, "dst", "$1", "src", "(.*)")`,
+		},
+		{
+			b:   Func("round", Selector("up")),
+			out: `round(up)`,
+		},
+		{
+			b:   Binary(MUL, Binary(ADD, Selector("a"), Selector("b")), Number(2)),
+			out: `(a + b) * 2`,
+		},
+		{
+			b:   Binary(POW, Number(-1), Number(2)),
+			out: `(-1) ^ 2`,
+		},
+		{
+			b:   Binary(GTR, Number(1), Number(2)).Bool(),
+			out: `1 > bool 2`,
+		},
+		{
+			b:   Binary(DIV, Selector("a"), Selector("b")).On("job").GroupLeft("team"),
+			out: `a / on (job) group_left (team) b`,
+		},
+		{
+			b:   Binary(LAND, Selector("a"), Selector("b")).Ignoring("instance"),
+			out: `a and ignoring (instance) b`,
+		},
+	}
+	for _, c := range cases {
+		expr, err := c.b.Build()
+		require.NoError(t, err)
+		require.Equal(t, c.out, expr.String())
+
+		// The rendered expression parses to the same expression.
+		parsed, err := ParseExpr(expr.String())
+		require.NoError(t, err)
+		require.Equal(t, c.out, parsed.String())
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	cases := []struct {
+		b   Builder
+		err string
+	}{
+		{
+			b:   Func("rate", Selector("up")),
+			err: `expected type range vector in call to function "rate", got instant vector`,
+		},
+		{
+			b:   Func("nope", Selector("up")),
+			err: `unknown function with name "nope"`,
+		},
+		{
+			b:   Func("label_join", Selector("up")),
+			err: `expected at least 3 argument(s) in call to "label_join", got 1`,
+		},
+		{
+			b:   Func("abs", Selector("up"), Selector("up")),
+			err: `expected 1 argument(s) in call to "abs", got 2`,
+		},
+		{
+			b:   Aggregate(SUM, Selector("up").Range(time.Minute)),
+			err: `expected type instant vector in aggregation expression, got range vector`,
+		},
+		{
+			b:   Aggregate(TOPK, Selector("up")),
+			err: `aggregation "topk" requires a parameter`,
+		},
+		{
+			b:   AggregateParam(QUANTILE, String("0.9"), Selector("up")),
+			err: `expected type scalar in aggregation parameter, got string`,
+		},
+		{
+			b:   Selector("up").By("job"),
+			err: `grouping can only be applied to an aggregation, got up`,
+		},
+		{
+			b:   Aggregate(SUM, Selector("up")).By("not-a-label"),
+			err: `invalid label name "not-a-label"`,
+		},
+		{
+			b:   Selector("not-a-metric"),
+			err: `invalid metric name "not-a-metric"`,
+		},
+		{
+			b:   Selector("").Eq("job", ""),
+			err: `vector selector must contain at least one non-empty matcher`,
+		},
+		{
+			b:   Selector("up").Eq("__name__", "down"),
+			err: `metric name must not be set twice: "up" or "down"`,
+		},
+		{
+			b:   Selector("up").Re("job", "("),
+			err: "invalid label matcher job: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+		{
+			b:   Selector("up").Range(0),
+			err: `range must be positive, got 0s`,
+		},
+		{
+			b:   Binary(ADD, Selector("up").Range(time.Minute), Number(1)),
+			err: `binary expression must contain only scalar and instant vector types`,
+		},
+		{
+			b:   Binary(LOR, Selector("up"), Number(1)),
+			err: `set operator "or" not allowed in binary scalar expression`,
+		},
+		{
+			b:   Binary(LSS, Number(1), Number(2)),
+			err: `comparisons between scalars must use BOOL modifier`,
+		},
+		{
+			b:   Binary(ADD, Selector("a"), Selector("b")).Bool(),
+			err: `bool modifier can only be used on comparison operators`,
+		},
+		{
+			b:   Binary(ADD, Selector("a"), Number(1)).On("job"),
+			err: `vector matching only allowed between instant vectors`,
+		},
+		{
+			b:   Binary(LUNLESS, Selector("a"), Selector("b")).GroupRight(),
+			err: `no grouping allowed for set operations`,
+		},
+		{
+			b:   Binary(ADD, Selector("a"), Selector("b")).On("job").GroupLeft("job"),
+			err: `label "job" must not occur in ON and GROUP clause at once`,
+		},
+		{
+			b:   Binary(SUM, Selector("a"), Selector("b")),
+			err: `binary expression does not support operator "sum"`,
+		},
+	}
+	for _, c := range cases {
+		_, err := c.b.Build()
+		require.EqualError(t, err, c.err)
+	}
+}
+
+func TestBuilderImmutable(t *testing.T) {
+	base := Selector("up").Eq("job", "api")
+	a := base.Eq("instance", "a")
+	b := base.Eq("instance", "b")
+
+	for _, c := range []struct {
+		b   Builder
+		out string
+	}{
+		{base, `up{job="api"}`},
+		{a, `up{instance="a",job="api"}`},
+		{b, `up{instance="b",job="api"}`},
+	} {
+		expr, err := c.b.Build()
+		require.NoError(t, err)
+		require.Equal(t, c.out, expr.String())
+	}
+}
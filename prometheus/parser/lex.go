@@ -19,6 +19,11 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/strutil"
 )
 
 // Item represents a token or text string returned from the scanner.
@@ -64,7 +69,7 @@ func (i ItemType) IsAggregator() bool { return i > aggregatorsStart && i < aggre
 // IsAggregatorWithParam returns true if the Item is an aggregator that takes a parameter.
 // Returns false otherwise
 func (i ItemType) IsAggregatorWithParam() bool {
-	return i == TOPK || i == BOTTOMK || i == COUNT_VALUES || i == QUANTILE
+	return i == TOPK || i == BOTTOMK || i == COUNT_VALUES || i == QUANTILE || i == LIMITK || i == LIMIT_RATIO
 }
 
 // IsKeyword returns true if the Item corresponds to a keyword.
@@ -117,6 +122,8 @@ var key = map[string]ItemType{
 	"bottomk":      BOTTOMK,
 	"count_values": COUNT_VALUES,
 	"quantile":     QUANTILE,
+	"limitk":       LIMITK,
+	"limit_ratio":  LIMIT_RATIO,
 
 	// Keywords.
 	"offset":      OFFSET,
@@ -241,6 +248,13 @@ type Lexer struct {
 	gotColon    bool // Whether we got a ':' after [ was opened.
 	stringOpen  rune // Quote rune of the string currently being read.
 
+	// The type of the Item returned last by NextItem.
+	lastType ItemType
+	// Whether a ( of grouping labels, e.g. after by, is opened.
+	groupingOpen bool
+	// Items scanned ahead, which NextItem returns before scanning further.
+	pending []Item
+
 	// seriesDesc is set when a series description for the testing
 	// language is lexed.
 	seriesDesc bool
@@ -313,15 +327,21 @@ func (l *Lexer) NextItem(itemp *Item) {
 	l.scannedItem = false
 	l.itemp = itemp
 
-	if l.state != nil {
+	switch {
+	case len(l.pending) > 0:
+		*l.itemp, l.pending = l.pending[0], l.pending[1:]
+	case l.state != nil:
 		for !l.scannedItem {
 			l.state = l.state(l)
 		}
-	} else {
+	default:
 		l.emit(EOF)
 	}
 
 	l.lastPos = l.itemp.Pos
+	if l.itemp.Typ != COMMENT {
+		l.lastType = l.itemp.Typ
+	}
 }
 
 // Lex creates a new scanner for the input string.
@@ -421,10 +441,15 @@ func lexStatements(l *Lexer) stateFn {
 		l.emit(COLON)
 		l.gotColon = true
 	case r == '(':
+		switch l.lastType {
+		case BY, WITHOUT, ON, IGNORING, GROUP_LEFT, GROUP_RIGHT:
+			l.groupingOpen = true
+		}
 		l.emit(LEFT_PAREN)
 		l.parenDepth++
 		return lexStatements
 	case r == ')':
+		l.groupingOpen = false
 		l.emit(RIGHT_PAREN)
 		l.parenDepth--
 		if l.parenDepth < 0 {
@@ -643,7 +668,7 @@ Loop:
 			break Loop
 		}
 	}
-	l.emit(STRING)
+	l.emitString()
 	return lexStatements
 }
 
@@ -662,10 +687,41 @@ Loop:
 			break Loop
 		}
 	}
-	l.emit(STRING)
+	l.emitString()
 	return lexStatements
 }
 
+// emitString emits a quoted string. Quoted strings which are label names,
+// i.e. grouping labels and strings inside braces followed by a matching
+// operator, are emitted as IDENTIFIER with the quotes kept in its value.
+// Other strings inside braces which are no label values are metric names,
+// which are emitted as the items of __name__="<metric name>".
+func (l *Lexer) emitString() {
+	if l.groupingOpen {
+		l.emit(IDENTIFIER)
+		return
+	}
+	switch l.lastType {
+	case EQL, NEQ, EQL_REGEX, NEQ_REGEX:
+		l.emit(STRING)
+		return
+	}
+	if !l.braceOpen {
+		l.emit(STRING)
+		return
+	}
+
+	switch rest := strings.TrimLeft(l.input[l.pos:], " \t\n\r"); {
+	case strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, "!"):
+		l.emit(IDENTIFIER)
+	default:
+		l.emit(STRING)
+		name := *l.itemp
+		*l.itemp = Item{IDENTIFIER, name.Pos, labels.MetricName}
+		l.pending = append(l.pending, Item{EQL, name.Pos, "="}, name)
+	}
+}
+
 // lexSpace scans a run of space characters. One space has already been seen.
 func lexSpace(l *Lexer) stateFn {
 	for isSpace(l.peek()) {
@@ -836,8 +892,13 @@ func isAlpha(r rune) bool {
 	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
 }
 
-// isLabel reports whether the string can be used as label.
+// isLabel reports whether the string can be used as label. Quoted label
+// names may be any valid UTF-8 string.
 func isLabel(s string) bool {
+	if isQuoted(s) {
+		name, err := strutil.Unquote(s)
+		return err == nil && model.UTF8Validation.IsValidLabelName(name)
+	}
 	if len(s) == 0 || !isAlpha(rune(s[0])) {
 		return false
 	}
@@ -848,3 +909,9 @@ func isLabel(s string) bool {
 	}
 	return true
 }
+
+// isQuoted reports whether the string is quoted, like label names which are
+// no valid legacy identifiers.
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'' || s[0] == '`')
+}
@@ -303,6 +303,12 @@ var tests = []struct {
 			}, {
 				input:    `count`,
 				expected: []Item{{COUNT, 0, `count`}},
+			}, {
+				input:    `limitk`,
+				expected: []Item{{LIMITK, 0, `limitk`}},
+			}, {
+				input:    `LIMIT_RATIO`,
+				expected: []Item{{LIMIT_RATIO, 0, `LIMIT_RATIO`}},
 			}, {
 				input:    `stdvar`,
 				expected: []Item{{STDVAR, 0, `stdvar`}},
@@ -405,6 +411,24 @@ var tests = []struct {
 					{STRING, 5, `"bar\"bar"`},
 					{RIGHT_BRACE, 15, `}`},
 				},
+			}, {
+				input: `{"a.b"="c"}`,
+				expected: []Item{
+					{LEFT_BRACE, 0, `{`},
+					{IDENTIFIER, 1, `"a.b"`},
+					{EQL, 6, `=`},
+					{STRING, 7, `"c"`},
+					{RIGHT_BRACE, 10, `}`},
+				},
+			}, {
+				input: `{"a.b"}`,
+				expected: []Item{
+					{LEFT_BRACE, 0, `{`},
+					{IDENTIFIER, 1, `__name__`},
+					{EQL, 1, `=`},
+					{STRING, 1, `"a.b"`},
+					{RIGHT_BRACE, 6, `}`},
+				},
 			}, {
 				input: `{NaN	!= "bar" }`,
 				expected: []Item{
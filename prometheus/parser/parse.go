@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/prometheus/common/model"
+	"golang.org/x/exp/slices"
 
 	"github.com/liticer/gclients/prometheus/model/labels"
 	"github.com/liticer/gclients/prometheus/model/strutil"
@@ -38,7 +39,8 @@ var parserPool = sync.Pool{
 }
 
 type parser struct {
-	lex Lexer
+	lex  Lexer
+	opts Options
 
 	inject    ItemType
 	injecting bool
@@ -51,6 +53,10 @@ type parser struct {
 
 	generatedParserResult interface{}
 	parseErrors           ParseErrors
+
+	// The matchers of the metric names set with a string in braces, e.g.
+	// {"foo"}.
+	metricNameMatchers []*labels.Matcher
 }
 
 // ParseErr wraps a parsing error with line and position context.
@@ -103,11 +109,27 @@ func (errs ParseErrors) Error() string {
 	return "error contains no error message"
 }
 
-// ParseExpr returns the expression parsed from the input.
+// Options configures the parsing of expressions.
+type Options struct {
+	// EnableExperimentalFunctions enables the experimental functions and
+	// aggregators of PromQL, which may still change or be removed in future
+	// versions of Prometheus.
+	EnableExperimentalFunctions bool
+}
+
+// ParseExpr returns the expression parsed from the input, without the
+// experimental functions.
 func ParseExpr(input string) (expr Expr, err error) {
+	return ParseExprWithOptions(input, Options{})
+}
+
+// ParseExprWithOptions returns the expression parsed from the input with the
+// given options.
+func ParseExprWithOptions(input string, opts Options) (expr Expr, err error) {
 	p := newParser(input)
 	defer parserPool.Put(p)
 	defer p.recover(&err)
+	p.opts = opts
 
 	parseResult := p.parseGenerated(START_EXPRESSION)
 
@@ -135,7 +157,7 @@ func ParseMetric(input string) (m labels.Labels, err error) {
 
 	parseResult := p.parseGenerated(START_METRIC)
 	if parseResult != nil {
-		m = parseResult.(labels.Labels)
+		m = p.unquoteLabels(parseResult.(labels.Labels))
 	}
 
 	if len(p.parseErrors) != 0 {
@@ -154,7 +176,9 @@ func ParseMetricSelector(input string) (m []*labels.Matcher, err error) {
 
 	parseResult := p.parseGenerated(START_METRIC_SELECTOR)
 	if parseResult != nil {
-		m = parseResult.(*VectorSelector).LabelMatchers
+		vs := parseResult.(*VectorSelector)
+		p.checkMetricName(vs)
+		m = vs.LabelMatchers
 	}
 
 	if len(p.parseErrors) != 0 {
@@ -168,8 +192,10 @@ func ParseMetricSelector(input string) (m []*labels.Matcher, err error) {
 func newParser(input string) *parser {
 	p := parserPool.Get().(*parser)
 
+	p.opts = Options{}
 	p.injecting = false
 	p.parseErrors = nil
+	p.metricNameMatchers = nil
 	p.generatedParserResult = nil
 
 	// Clear lexer struct before reusing.
@@ -210,7 +236,7 @@ func ParseSeriesDesc(input string) (labels labels.Labels, values []SequenceValue
 	if parseResult != nil {
 		result := parseResult.(*seriesDescription)
 
-		labels = result.labels
+		labels = p.unquoteLabels(result.labels)
 		values = result.values
 
 	}
@@ -363,10 +389,27 @@ func (p *parser) newBinaryExpression(lhs Node, op Item, modifiers, rhs Node) *Bi
 	ret.RHS = rhs.(Expr)
 	ret.Op = op.Typ
 
+	if ret.VectorMatching != nil {
+		p.unquoteLabelNames(ret.VectorMatching.MatchingLabels)
+		p.unquoteLabelNames(ret.VectorMatching.Include)
+	}
+
 	return ret
 }
 
 func (p *parser) assembleVectorSelector(vs *VectorSelector) {
+	if vs.Name == "" {
+		// A metric name set with a string in braces, e.g. {"foo"}, names the
+		// selector as if it was set outside of the braces, so its matcher
+		// moves to the end.
+		for i, m := range vs.LabelMatchers {
+			if slices.Contains(p.metricNameMatchers, m) {
+				vs.Name = m.Value
+				vs.LabelMatchers = append(append(vs.LabelMatchers[:i:i], vs.LabelMatchers[i+1:]...), m)
+				return
+			}
+		}
+	}
 	if vs.Name != "" {
 		nameMatcher, err := labels.NewMatcher(labels.MatchEqual, labels.MetricName, vs.Name)
 		if err != nil {
@@ -386,6 +429,12 @@ func (p *parser) newAggregateExpr(op Item, modifier, args Node) (ret *AggregateE
 	}
 
 	ret.Op = op.Typ
+	p.unquoteLabelNames(ret.Grouping)
+
+	if (ret.Op == LIMITK || ret.Op == LIMIT_RATIO) && !p.opts.EnableExperimentalFunctions {
+		p.addParseErrf(ret.PositionRange(), "%s() is experimental and must be enabled with EnableExperimentalFunctions", ret.Op)
+		return
+	}
 
 	if len(arguments) == 0 {
 		p.addParseErrf(ret.PositionRange(), "no arguments for aggregate expression provided")
@@ -467,7 +516,7 @@ func (p *parser) checkAST(node Node) (typ ValueType) {
 			p.addParseErrf(n.PositionRange(), "aggregation operator expected in aggregation expression but got %q", n.Op)
 		}
 		p.expectType(n.Expr, ValueTypeVector, "aggregation expression")
-		if n.Op == TOPK || n.Op == BOTTOMK || n.Op == QUANTILE {
+		if n.Op == TOPK || n.Op == BOTTOMK || n.Op == QUANTILE || n.Op == LIMITK || n.Op == LIMIT_RATIO {
 			p.expectType(n.Param, ValueTypeScalar, "aggregation parameter")
 		}
 		if n.Op == COUNT_VALUES {
@@ -539,6 +588,10 @@ func (p *parser) checkAST(node Node) (typ ValueType) {
 		}
 
 	case *Call:
+		if n.Func.Experimental && !p.opts.EnableExperimentalFunctions {
+			p.addParseErrf(n.PositionRange(), "function %q is experimental and must be enabled with EnableExperimentalFunctions", n.Func.Name)
+		}
+
 		nargs := len(n.Func.ArgTypes)
 		if n.Func.Variadic == 0 {
 			if nargs != len(n.Args) {
@@ -565,6 +618,14 @@ func (p *parser) checkAST(node Node) (typ ValueType) {
 			p.expectType(arg, n.Func.ArgTypes[i], fmt.Sprintf("call to function %q", n.Func.Name))
 		}
 
+		// The second argument of info selects the info series by their
+		// labels, so it has to be a vector selector.
+		if n.Func.Name == "info" && len(n.Args) > 1 {
+			if _, ok := n.Args[1].(*VectorSelector); !ok {
+				p.addParseErrf(n.Args[1].PositionRange(), "expected label selectors as the second argument to \"info\" function, got %s", n.Args[1].Type())
+			}
+		}
+
 	case *ParenExpr:
 		p.checkAST(n.Expr)
 
@@ -586,14 +647,7 @@ func (p *parser) checkAST(node Node) (typ ValueType) {
 
 	case *VectorSelector:
 		if n.Name != "" {
-			// In this case the last LabelMatcher is checking for the metric name
-			// set outside the braces. This checks if the name has already been set
-			// previously.
-			for _, m := range n.LabelMatchers[0 : len(n.LabelMatchers)-1] {
-				if m != nil && m.Name == labels.MetricName {
-					p.addParseErrf(n.PositionRange(), "metric name must not be set twice: %q or %q", n.Name, m.Value)
-				}
-			}
+			p.checkMetricName(n)
 
 			// Skip the check for non-empty matchers because an explicit
 			// metric name is a non-empty matcher.
@@ -673,14 +727,64 @@ func (p *parser) newLabelMatcher(label, operator, value Item) *labels.Matcher {
 		panic("invalid operator")
 	}
 
-	m, err := labels.NewMatcher(matchType, label.Val, val)
+	name := label.Val
+	if isQuoted(name) {
+		name = p.unquoteString(name)
+		if !model.UTF8Validation.IsValidLabelName(name) {
+			p.addParseErrf(label.PositionRange(), "invalid label name %q", name)
+		}
+	}
+
+	m, err := labels.NewMatcher(matchType, name, val)
 	if err != nil {
 		p.addParseErr(mergeRanges(&label, &value), err)
 	}
+	// The lexer emits the label name and the operator of a metric name in
+	// braces at the position of the string.
+	if label.Pos == value.Pos {
+		p.metricNameMatchers = append(p.metricNameMatchers, m)
+	}
 
 	return m
 }
 
+// checkMetricName checks that the metric name of vs is not set twice. In
+// this case the last LabelMatcher is checking for the metric name set
+// outside the braces, or with a string inside them, e.g. {"foo"}.
+func (p *parser) checkMetricName(vs *VectorSelector) {
+	if vs.Name == "" {
+		return
+	}
+	for _, m := range vs.LabelMatchers[0 : len(vs.LabelMatchers)-1] {
+		if m != nil && m.Name == labels.MetricName {
+			p.addParseErrf(vs.PositionRange(), "metric name must not be set twice: %q or %q", vs.Name, m.Value)
+		}
+	}
+}
+
+// unquoteLabelNames unquotes the quoted label names, which the lexer scans
+// as identifiers, in place.
+func (p *parser) unquoteLabelNames(names []string) {
+	for i, name := range names {
+		if isQuoted(name) {
+			names[i] = p.unquoteString(name)
+		}
+	}
+}
+
+// unquoteLabels returns ls with its quoted label names unquoted.
+func (p *parser) unquoteLabels(ls labels.Labels) labels.Labels {
+	b := labels.NewScratchBuilder(ls.Len())
+	ls.Range(func(l labels.Label) {
+		if isQuoted(l.Name) {
+			l.Name = p.unquoteString(l.Name)
+		}
+		b.Add(l.Name, l.Value)
+	})
+	b.Sort()
+	return b.Labels()
+}
+
 // addOffset is used to set the offset in the generated parser.
 func (p *parser) addOffset(e Node, offset time.Duration) {
 	var orgoffsetp *time.Duration
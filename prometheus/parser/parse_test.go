@@ -1712,6 +1712,40 @@ var testExpr = []struct {
 			},
 		},
 	},
+	{
+		input: `{"http.server.duration", "service.name"="api"}`,
+		expected: &VectorSelector{
+			Name: "http.server.duration",
+			LabelMatchers: []*labels.Matcher{
+				MustLabelMatcher(labels.MatchEqual, "service.name", "api"),
+				MustLabelMatcher(labels.MatchEqual, model.MetricNameLabel, "http.server.duration"),
+			},
+			PosRange: PositionRange{
+				Start: 0,
+				End:   46,
+			},
+		},
+	},
+	{
+		input:  `{""="b"}`,
+		fail:   true,
+		errMsg: "invalid label name",
+	},
+	{
+		input:  `{__name__="foo", "bar"}`,
+		fail:   true,
+		errMsg: `metric name must not be set twice: "bar" or "foo"`,
+	},
+	{
+		input:  `{"foo", "bar"}`,
+		fail:   true,
+		errMsg: `metric name must not be set twice: "foo" or "bar"`,
+	},
+	{
+		input:  `foo{"bar"}`,
+		fail:   true,
+		errMsg: `metric name must not be set twice: "foo" or "bar"`,
+	},
 	{
 		input: `foo{bar='}'}`,
 		expected: &VectorSelector{
@@ -2339,6 +2373,75 @@ var testExpr = []struct {
 			},
 		},
 	},
+	{
+		input: "limitk(5, some_metric)",
+		expected: &AggregateExpr{
+			Op: LIMITK,
+			Expr: &VectorSelector{
+				Name: "some_metric",
+				LabelMatchers: []*labels.Matcher{
+					MustLabelMatcher(labels.MatchEqual, model.MetricNameLabel, "some_metric"),
+				},
+				PosRange: PositionRange{
+					Start: 10,
+					End:   21,
+				},
+			},
+			Param: &NumberLiteral{
+				Val: 5,
+				PosRange: PositionRange{
+					Start: 7,
+					End:   8,
+				},
+			},
+			PosRange: PositionRange{
+				Start: 0,
+				End:   22,
+			},
+		},
+	},
+	{
+		input: "limit_ratio by (limitk) (0.5, some_metric)",
+		expected: &AggregateExpr{
+			Op: LIMIT_RATIO,
+			Expr: &VectorSelector{
+				Name: "some_metric",
+				LabelMatchers: []*labels.Matcher{
+					MustLabelMatcher(labels.MatchEqual, model.MetricNameLabel, "some_metric"),
+				},
+				PosRange: PositionRange{
+					Start: 30,
+					End:   41,
+				},
+			},
+			Param: &NumberLiteral{
+				Val: 0.5,
+				PosRange: PositionRange{
+					Start: 25,
+					End:   28,
+				},
+			},
+			Grouping: []string{"limitk"},
+			PosRange: PositionRange{
+				Start: 0,
+				End:   42,
+			},
+		},
+	},
+	{
+		input: `limit_ratio{job="a"}`,
+		expected: &VectorSelector{
+			Name: "limit_ratio",
+			LabelMatchers: []*labels.Matcher{
+				MustLabelMatcher(labels.MatchEqual, "job", "a"),
+				MustLabelMatcher(labels.MatchEqual, model.MetricNameLabel, "limit_ratio"),
+			},
+			PosRange: PositionRange{
+				Start: 0,
+				End:   20,
+			},
+		},
+	},
 	{
 		input: `count_values("value", some_metric)`,
 		expected: &AggregateExpr{
@@ -2616,6 +2719,36 @@ var testExpr = []struct {
 		fail:   true,
 		errMsg: "unknown function with name \"non_existent_function_far_bar\"",
 	},
+	{
+		input:  `limitk("5", some_metric)`,
+		fail:   true,
+		errMsg: "expected type scalar in aggregation parameter, got string",
+	},
+	{
+		input:  "limit_ratio(some_metric)",
+		fail:   true,
+		errMsg: "wrong number of arguments for aggregate expression provided, expected 2, got 1",
+	},
+	{
+		input:  "sort_by_label(some_metric, 1)",
+		fail:   true,
+		errMsg: "expected type string in call to function \"sort_by_label\", got scalar",
+	},
+	{
+		input:  "double_exponential_smoothing(some_metric[5m], 0.5)",
+		fail:   true,
+		errMsg: "expected 3 argument(s) in call to \"double_exponential_smoothing\", got 2",
+	},
+	{
+		input:  "info(some_metric, rate(target_info[5m]))",
+		fail:   true,
+		errMsg: "expected label selectors as the second argument to \"info\" function, got vector",
+	},
+	{
+		input:  "info(some_metric, target_info, build_info)",
+		fail:   true,
+		errMsg: "expected at most 2 argument(s) in call to \"info\", got 3",
+	},
 	{
 		input:  "rate(some_metric)",
 		fail:   true,
@@ -3558,7 +3691,7 @@ func makeInt64Pointer(val int64) *int64 {
 func TestParseExpressions(t *testing.T) {
 	for _, test := range testExpr {
 		t.Run(test.input, func(t *testing.T) {
-			expr, err := ParseExpr(test.input)
+			expr, err := ParseExprWithOptions(test.input, Options{EnableExperimentalFunctions: true})
 
 			// Unexpected errors are always caused by a bug.
 			require.NotEqual(t, err, errUnexpected, "unexpected error occurred")
@@ -3585,6 +3718,36 @@ func TestParseExpressions(t *testing.T) {
 	}
 }
 
+func TestParseExperimentalFunctions(t *testing.T) {
+	for _, input := range []string{
+		"limitk(5, some_metric)",
+		"limit_ratio(0.5, some_metric)",
+		"mad_over_time(some_metric[5m])",
+		`sort_by_label(some_metric, "job")`,
+		`sort_by_label_desc(some_metric, "job")`,
+		"double_exponential_smoothing(some_metric[5m], 0.5, 0.5)",
+		"info(some_metric)",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseExpr(input)
+			require.ErrorContains(t, err, "experimental")
+
+			_, err = ParseExprWithOptions(input, Options{EnableExperimentalFunctions: true})
+			require.NoError(t, err)
+
+			// The parser is reused, the option must not leak into the next parse.
+			_, err = ParseExpr(input)
+			require.ErrorContains(t, err, "experimental")
+		})
+	}
+
+	// Histogram functions are stable.
+	for _, input := range []string{"histogram_avg(some_metric)", "histogram_stddev(some_metric)", "histogram_stdvar(some_metric)"} {
+		_, err := ParseExpr(input)
+		require.NoError(t, err, input)
+	}
+}
+
 // NaN has no equality. Thus, we need a separate test for it.
 func TestNaNExpression(t *testing.T) {
 	expr, err := ParseExpr("NaN")
@@ -3776,3 +3939,14 @@ func TestExtractSelectors(t *testing.T) {
 		require.Equal(t, expected, ExtractSelectors(expr))
 	}
 }
+
+func TestParseMetricSelector(t *testing.T) {
+	m, err := ParseMetricSelector(`{"http.server.duration", __name__!="x"}`)
+	require.ErrorContains(t, err, `metric name must not be set twice: "http.server.duration" or "x"`)
+	require.Len(t, m, 2)
+
+	// Several matchers of the metric name are fine without a string in braces.
+	m, err = ParseMetricSelector(`{__name__=~"http_.+", __name__!="http_requests_total"}`)
+	require.NoError(t, err)
+	require.Len(t, m, 2)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/common/model"
 
 	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/strutil"
 )
 
 // Tree returns a string of the tree structure of the given node.
@@ -77,14 +78,24 @@ func (node *AggregateExpr) getAggOpStr() string {
 
 	switch {
 	case node.Without:
-		aggrString += fmt.Sprintf(" without (%s) ", strings.Join(node.Grouping, ", "))
+		aggrString += fmt.Sprintf(" without (%s) ", joinLabels(node.Grouping))
 	case len(node.Grouping) > 0:
-		aggrString += fmt.Sprintf(" by (%s) ", strings.Join(node.Grouping, ", "))
+		aggrString += fmt.Sprintf(" by (%s) ", joinLabels(node.Grouping))
 	}
 
 	return aggrString
 }
 
+// joinLabels joins the label names of a grouping, quoting the names which
+// are no legacy identifiers.
+func joinLabels(names []string) string {
+	strs := make([]string, 0, len(names))
+	for _, name := range names {
+		strs = append(strs, strutil.QuoteLabelName(name))
+	}
+	return strings.Join(strs, ", ")
+}
+
 func (node *BinaryExpr) String() string {
 	returnBool := ""
 	if node.ReturnBool {
@@ -103,14 +114,14 @@ func (node *BinaryExpr) getMatchingStr() string {
 		if vm.On {
 			vmTag = "on"
 		}
-		matching = fmt.Sprintf(" %s (%s)", vmTag, strings.Join(vm.MatchingLabels, ", "))
+		matching = fmt.Sprintf(" %s (%s)", vmTag, joinLabels(vm.MatchingLabels))
 
 		if vm.Card == CardManyToOne || vm.Card == CardOneToMany {
 			vmCard := "right"
 			if vm.Card == CardManyToOne {
 				vmCard = "left"
 			}
-			matching += fmt.Sprintf(" group_%s (%s)", vmCard, strings.Join(vm.Include, ", "))
+			matching += fmt.Sprintf(" group_%s (%s)", vmCard, joinLabels(vm.Include))
 		}
 	}
 	return matching
@@ -191,7 +202,7 @@ func (node *ParenExpr) String() string {
 }
 
 func (node *StringLiteral) String() string {
-	return fmt.Sprintf("%q", node.Val)
+	return strutil.Quote(node.Val)
 }
 
 func (node *UnaryExpr) String() string {
@@ -227,9 +238,16 @@ func (node *VectorSelector) String() string {
 		at = " @ end()"
 	}
 
+	name := node.Name
+	sort.Strings(labelStrings)
+	// Metric names which are no legacy identifiers are quoted inside the
+	// braces.
+	if name != "" && !model.LegacyValidation.IsValidMetricName(name) {
+		labelStrings = append([]string{strutil.Quote(name)}, labelStrings...)
+		name = ""
+	}
 	if len(labelStrings) == 0 {
-		return fmt.Sprintf("%s%s%s", node.Name, at, offset)
+		return fmt.Sprintf("%s%s%s", name, at, offset)
 	}
-	sort.Strings(labelStrings)
-	return fmt.Sprintf("%s{%s}%s%s", node.Name, strings.Join(labelStrings, ","), at, offset)
+	return fmt.Sprintf("%s{%s}%s%s", name, strings.Join(labelStrings, ","), at, offset)
 }
@@ -47,6 +47,25 @@ func TestExprString(t *testing.T) {
 		{
 			in: `topk(5, task:errors:rate10s{job="s"})`,
 		},
+		{
+			in: `{"http.server.duration","service.name"="api"}`,
+		},
+		{
+			in:  `{'http.server.duration'}`,
+			out: `{"http.server.duration"}`,
+		},
+		{
+			in:  `sum by ("service.name", job) (rate({"http.server.duration"}[5m]))`,
+			out: `sum by ("service.name", job) (rate({"http.server.duration"}[5m]))`,
+		},
+		{
+			in:  `a * on ("k8s.pod") group_left ("x.y") b`,
+			out: `a * on ("k8s.pod") group_left ("x.y") b`,
+		},
+		{
+			in:  `{"foo"}`,
+			out: `foo`,
+		},
 		{
 			in: `count_values("value", task:errors:rate10s{job="s"})`,
 		},
@@ -150,6 +169,78 @@ func TestExprString(t *testing.T) {
 	}
 }
 
+func TestQuotedNamesPretty(t *testing.T) {
+	maxCharactersPerLine = 10
+	inputs := []struct {
+		in, out string
+	}{
+		{
+			in:  `{"http.server.duration", "service.name"="api"}`,
+			out: `{"http.server.duration","service.name"="api"}`,
+		},
+		{
+			in: `sum by ("service.name", job) (rate({"http.server.duration"}[5m]))`,
+			out: `sum by ("service.name", job) (
+  rate(
+    {"http.server.duration"}[5m]
+  )
+)`,
+		},
+		{
+			in: `a * on ("k8s.pod") group_left ("x.y") b`,
+			out: `  a
+* on ("k8s.pod") group_left ("x.y")
+  b`,
+		},
+		{
+			in: `sum without ("k8s.pod") ({"my.metric", "k8s.pod"=~"a.*"})`,
+			out: `sum without ("k8s.pod") (
+  {"my.metric","k8s.pod"=~"a.*"}
+)`,
+		},
+	}
+	for _, test := range inputs {
+		expr, err := ParseExpr(test.in)
+		require.NoError(t, err)
+		require.Equal(t, test.out, Prettify(expr))
+
+		// The output parses to the same expression.
+		reparsed, err := ParseExpr(test.out)
+		require.NoError(t, err)
+		require.Equal(t, expr.String(), reparsed.String())
+	}
+}
+
+func TestQuotedNamesRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{in: `{"foo"}`, out: `foo`},
+		{in: `{'foo:bar', a="b"}`, out: `foo:bar{a="b"}`},
+		{in: `{"foo", "a.b"="c"}[5m] offset 1m`, out: `foo{"a.b"="c"}[5m] offset 1m`},
+		{in: `{"foo.bar"}`, out: `{"foo.bar"}`},
+		{in: `{"foo.bar", a=~"b"} @ 10`, out: `{"foo.bar",a=~"b"} @ 10.000`},
+		{in: `{"ü", "ä"!="ö"}`, out: `{"ü","ä"!="ö"}`},
+		{in: `{"0foo"}`, out: `{"0foo"}`},
+		{in: `sum by ("a.b", c) ({"x.y"} / on ("a.b") group_left ("d:e") {"z"})`, out: `sum by ("a.b", c) ({"x.y"} / on ("a.b") group_left ("d:e") z)`},
+		{in: `{__name__="foo"}`, out: `{__name__="foo"}`},
+		{in: `{__name__="foo.bar"}`, out: `{__name__="foo.bar"}`},
+	} {
+		t.Run(test.in, func(t *testing.T) {
+			expr, err := ParseExpr(test.in)
+			require.NoError(t, err)
+			require.Equal(t, test.out, expr.String())
+
+			// The output parses to an expression with the same selectors,
+			// which is printed the same way.
+			reparsed, err := ParseExpr(test.out)
+			require.NoError(t, err)
+			require.Equal(t, test.out, reparsed.String())
+			require.Equal(t, ExtractSelectors(expr), ExtractSelectors(reparsed))
+		})
+	}
+}
+
 func TestVectorSelector_String(t *testing.T) {
 	for _, tc := range []struct {
 		name     string
@@ -216,6 +307,17 @@ func TestVectorSelector_String(t *testing.T) {
 			},
 			expected: `{__name__="foobar"}`,
 		},
+		{
+			name: "UTF-8 name matcher and name",
+			vs: VectorSelector{
+				Name: "foo.bar",
+				LabelMatchers: []*labels.Matcher{
+					labels.MustNewMatcher(labels.MatchEqual, "a", "x"),
+					labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "foo.bar"),
+				},
+			},
+			expected: `{"foo.bar",a="x"}`,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			require.Equal(t, tc.expected, tc.vs.String())
@@ -0,0 +1,152 @@
+package prometheustest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/model/value"
+	"github.com/liticer/gclients/prometheus/parser"
+)
+
+// evaluator evaluates the expressions supported without a canned response:
+// number and string literals, vector selectors and matrix selectors.
+type evaluator struct {
+	expr   parser.Expr
+	series []series
+}
+
+func unsupported(expr parser.Expr) error {
+	return fmt.Errorf("unsupported expression %q, set a response with SetResponse", expr.String())
+}
+
+func (ev evaluator) instant(ts time.Time) (model.Value, error) {
+	t := model.TimeFromUnixNano(ts.UnixNano())
+
+	switch e := unwrap(ev.expr).(type) {
+	case *parser.NumberLiteral:
+		return &model.Scalar{Value: model.SampleValue(e.Val), Timestamp: t}, nil
+	case *parser.StringLiteral:
+		return &model.String{Value: e.Val, Timestamp: t}, nil
+	case *parser.VectorSelector:
+		vec := model.Vector{}
+		for _, ser := range ev.selectSeries(e) {
+			if s, ok := latest(ser.samples, int64(evalTime(e, t))); ok {
+				vec = append(vec, &model.Sample{Metric: metric(ser.labels), Value: model.SampleValue(s.Value), Timestamp: t})
+			}
+		}
+		return vec, nil
+	case *parser.MatrixSelector:
+		vs, ok := e.VectorSelector.(*parser.VectorSelector)
+		if !ok {
+			return nil, unsupported(ev.expr)
+		}
+		maxt := int64(evalTime(vs, t))
+		mint := maxt - e.Range.Milliseconds()
+
+		mat := model.Matrix{}
+		for _, ser := range ev.selectSeries(vs) {
+			ss := &model.SampleStream{Metric: metric(ser.labels)}
+			for _, s := range ser.samples {
+				if s.Timestamp > mint && s.Timestamp <= maxt && !value.IsStaleNaN(s.Value) {
+					ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.Time(s.Timestamp), Value: model.SampleValue(s.Value)})
+				}
+			}
+			if len(ss.Values) > 0 {
+				mat = append(mat, ss)
+			}
+		}
+		return mat, nil
+	default:
+		return nil, unsupported(ev.expr)
+	}
+}
+
+func (ev evaluator) rangeQuery(start, end time.Time, step time.Duration) (model.Value, error) {
+	var steps []model.Time
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		steps = append(steps, model.TimeFromUnixNano(ts.UnixNano()))
+	}
+
+	mat := model.Matrix{}
+	switch e := unwrap(ev.expr).(type) {
+	case *parser.NumberLiteral:
+		ss := &model.SampleStream{Metric: model.Metric{}}
+		for _, t := range steps {
+			ss.Values = append(ss.Values, model.SamplePair{Timestamp: t, Value: model.SampleValue(e.Val)})
+		}
+		mat = append(mat, ss)
+	case *parser.VectorSelector:
+		for _, ser := range ev.selectSeries(e) {
+			ss := &model.SampleStream{Metric: metric(ser.labels)}
+			for _, t := range steps {
+				if s, ok := latest(ser.samples, int64(evalTime(e, t))); ok {
+					ss.Values = append(ss.Values, model.SamplePair{Timestamp: t, Value: model.SampleValue(s.Value)})
+				}
+			}
+			if len(ss.Values) > 0 {
+				mat = append(mat, ss)
+			}
+		}
+	case *parser.MatrixSelector, *parser.StringLiteral:
+		return nil, fmt.Errorf("invalid expression type %q for range query, must be Scalar or instant Vector", parser.DocumentedType(e.Type()))
+	default:
+		return nil, unsupported(ev.expr)
+	}
+	return mat, nil
+}
+
+func unwrap(expr parser.Expr) parser.Expr {
+	for {
+		p, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.Expr
+	}
+}
+
+// evalTime returns the time the selector is evaluated at for the query time t,
+// taking the offset and @ modifiers into account.
+func evalTime(vs *parser.VectorSelector, t model.Time) model.Time {
+	if vs.Timestamp != nil {
+		t = model.Time(*vs.Timestamp)
+	}
+	return t.Add(-vs.OriginalOffset)
+}
+
+func (ev evaluator) selectSeries(vs *parser.VectorSelector) []series {
+	var res []series
+	for _, ser := range ev.series {
+		if matches(ser.labels, vs.LabelMatchers) {
+			res = append(res, ser)
+		}
+	}
+	return res
+}
+
+// latest returns the latest sample at or before t within the lookback
+// delta. Series ending with a stale marker have no sample.
+func latest(samples []storage.Sample, t int64) (storage.Sample, bool) {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > t })
+	if i == 0 {
+		return storage.Sample{}, false
+	}
+	s := samples[i-1]
+	if s.Timestamp <= t-LookbackDelta.Milliseconds() || value.IsStaleNaN(s.Value) {
+		return storage.Sample{}, false
+	}
+	return s, true
+}
+
+func metric(lset labels.Labels) model.Metric {
+	m := make(model.Metric, lset.Len())
+	lset.Range(func(l labels.Label) {
+		m[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	})
+	return m
+}
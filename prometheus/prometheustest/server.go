@@ -0,0 +1,467 @@
+// Package prometheustest provides an in-process fake of the Prometheus HTTP
+// API for tests of code using v1.API.
+//
+// The server holds series loaded in the series description notation of
+// the PromQL test language, e.g. `up{job="api"} 1 1 0 _ 1` or
+// `http_requests_total 0+10x100`. Plain selectors are evaluated against
+// them, responses for all other expressions are set with SetResponse.
+package prometheustest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/parser"
+	v1 "github.com/liticer/gclients/prometheus/v1"
+)
+
+// The endpoints served by the Server, to be used with SetError and SetWarnings.
+const (
+	EndpointQuery       = "/api/v1/query"
+	EndpointQueryRange  = "/api/v1/query_range"
+	EndpointSeries      = "/api/v1/series"
+	EndpointLabels      = "/api/v1/labels"
+	EndpointLabelValues = "/api/v1/label/:name/values"
+)
+
+// LookbackDelta is how far back selectors look for the latest sample of a series.
+const LookbackDelta = 5 * time.Minute
+
+// Error is an error returned by the Server for an endpoint.
+type Error struct {
+	// The HTTP status code. Defaults to http.StatusUnprocessableEntity.
+	Status int
+	// The error type, e.g. v1.ErrExec.
+	Type v1.ErrorType
+	Msg  string
+}
+
+// Server is a fake Prometheus serving the query, query_range, series,
+// labels and label values endpoints of the v1 API.
+//
+// It is safe to use a Server from multiple goroutines.
+type Server struct {
+	// URL of the server, e.g. http://127.0.0.1:1234.
+	URL string
+	srv *httptest.Server
+
+	mtx       sync.RWMutex
+	series    []series
+	responses map[string]model.Value
+	errors    map[string]*Error
+	warnings  map[string][]string
+}
+
+type series struct {
+	labels  labels.Labels
+	samples []storage.Sample
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		responses: map[string]model.Value{},
+		errors:    map[string]*Error{},
+		warnings:  map[string][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(EndpointQuery, s.handle(EndpointQuery, s.query))
+	mux.HandleFunc(EndpointQueryRange, s.handle(EndpointQueryRange, s.queryRange))
+	mux.HandleFunc(EndpointSeries, s.handle(EndpointSeries, s.seriesHandler))
+	mux.HandleFunc(EndpointLabels, s.handle(EndpointLabels, s.labelNames))
+	mux.HandleFunc("/api/v1/label/", s.handle(EndpointLabelValues, s.labelValues))
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client for the server.
+func (s *Server) Client() prometheus.Client {
+	client, err := prometheus.NewClient(prometheus.Config{Address: s.URL})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// API returns a v1.API for the server.
+func (s *Server) API() v1.API {
+	return v1.NewAPI(s.Client())
+}
+
+// Load adds series in the series description notation. Their samples
+// start at start and are interval apart, omitted values ("_") are skipped.
+func (s *Server) Load(start time.Time, interval time.Duration, descs ...string) error {
+	loaded := make([]series, 0, len(descs))
+	for _, desc := range descs {
+		lset, vals, err := parser.ParseSeriesDesc(desc)
+		if err != nil {
+			return fmt.Errorf("invalid series description %q: %w", desc, err)
+		}
+		ser := series{labels: lset}
+		for i, v := range vals {
+			if v.Omitted {
+				continue
+			}
+			ts := start.Add(time.Duration(i) * interval)
+			ser.samples = append(ser.samples, storage.Sample{Timestamp: ts.UnixMilli(), Value: v.Value})
+		}
+		loaded = append(loaded, ser)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, ser := range loaded {
+		i := sort.Search(len(s.series), func(i int) bool {
+			return labels.Compare(s.series[i].labels, ser.labels) >= 0
+		})
+		if i < len(s.series) && labels.Equal(s.series[i].labels, ser.labels) {
+			return fmt.Errorf("series %s loaded twice", ser.labels)
+		}
+		s.series = append(s.series, series{})
+		copy(s.series[i+1:], s.series[i:])
+		s.series[i] = ser
+	}
+	return nil
+}
+
+// MustLoad is like Load but panics on invalid descriptions.
+func (s *Server) MustLoad(start time.Time, interval time.Duration, descs ...string) {
+	if err := s.Load(start, interval, descs...); err != nil {
+		panic(err)
+	}
+}
+
+// SetResponse sets the result of instant and range queries for the given
+// expression, which is returned regardless of the series loaded. The
+// expression is matched after normalization, i.e. formatting and
+// whitespace don't matter. A nil value removes the response.
+func (s *Server) SetResponse(query string, v model.Value) {
+	key := normalize(query)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if v == nil {
+		delete(s.responses, key)
+		return
+	}
+	s.responses[key] = v
+}
+
+// SetError makes the given endpoint fail with err. A nil error removes it.
+func (s *Server) SetError(endpoint string, err *Error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err == nil {
+		delete(s.errors, endpoint)
+		return
+	}
+	s.errors[endpoint] = err
+}
+
+// SetWarnings makes the given endpoint return the given warnings with
+// successful responses.
+func (s *Server) SetWarnings(endpoint string, warnings ...string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.warnings[endpoint] = warnings
+}
+
+func normalize(query string) string {
+	if expr, err := parser.ParseExpr(query); err == nil {
+		return expr.String()
+	}
+	return strings.TrimSpace(query)
+}
+
+type response struct {
+	Status    string       `json:"status"`
+	Data      interface{}  `json:"data,omitempty"`
+	ErrorType v1.ErrorType `json:"errorType,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Warnings  []string     `json:"warnings,omitempty"`
+}
+
+type queryData struct {
+	ResultType model.ValueType `json:"resultType"`
+	Result     model.Value     `json:"result"`
+}
+
+// handle wraps the handler of an endpoint, applying the injected errors and warnings.
+func (s *Server) handle(endpoint string, h func(r *http.Request) (interface{}, *Error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mtx.RLock()
+		apiErr := s.errors[endpoint]
+		warnings := s.warnings[endpoint]
+		s.mtx.RUnlock()
+
+		var data interface{}
+		if apiErr == nil {
+			if err := r.ParseForm(); err != nil {
+				apiErr = badData(err)
+			} else {
+				data, apiErr = h(r)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if apiErr != nil {
+			status := apiErr.Status
+			if status == 0 {
+				status = http.StatusUnprocessableEntity
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(response{Status: "error", ErrorType: apiErr.Type, Error: apiErr.Msg})
+			return
+		}
+		json.NewEncoder(w).Encode(response{Status: "success", Data: data, Warnings: warnings})
+	}
+}
+
+func badData(err error) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: v1.ErrBadData, Msg: err.Error()}
+}
+
+func (s *Server) query(r *http.Request) (interface{}, *Error) {
+	ts := time.Now()
+	if t := r.Form.Get("time"); t != "" {
+		var err error
+		if ts, err = parseTime(t); err != nil {
+			return nil, badData(fmt.Errorf("invalid parameter \"time\": %w", err))
+		}
+	}
+
+	v, apiErr := s.eval(r.Form.Get("query"), func(sel evaluator) (model.Value, error) {
+		return sel.instant(ts)
+	})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return queryData{ResultType: v.Type(), Result: v}, nil
+}
+
+func (s *Server) queryRange(r *http.Request) (interface{}, *Error) {
+	start, err := parseTime(r.Form.Get("start"))
+	if err != nil {
+		return nil, badData(fmt.Errorf("invalid parameter \"start\": %w", err))
+	}
+	end, err := parseTime(r.Form.Get("end"))
+	if err != nil {
+		return nil, badData(fmt.Errorf("invalid parameter \"end\": %w", err))
+	}
+	step, err := parseDuration(r.Form.Get("step"))
+	if err != nil {
+		return nil, badData(fmt.Errorf("invalid parameter \"step\": %w", err))
+	}
+	if end.Before(start) {
+		return nil, badData(fmt.Errorf("end timestamp must not be before start time"))
+	}
+	if step <= 0 {
+		return nil, badData(fmt.Errorf("zero or negative query resolution step widths are not accepted. Try a positive integer"))
+	}
+
+	v, apiErr := s.eval(r.Form.Get("query"), func(sel evaluator) (model.Value, error) {
+		return sel.rangeQuery(start, end, step)
+	})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return queryData{ResultType: v.Type(), Result: v}, nil
+}
+
+// eval returns the canned response for query or evaluates it with f.
+func (s *Server) eval(query string, f func(evaluator) (model.Value, error)) (model.Value, *Error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, badData(err)
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if v, ok := s.responses[expr.String()]; ok {
+		return v, nil
+	}
+	v, err := f(evaluator{expr: expr, series: s.series})
+	if err != nil {
+		return nil, &Error{Status: http.StatusUnprocessableEntity, Type: v1.ErrExec, Msg: err.Error()}
+	}
+	return v, nil
+}
+
+func (s *Server) seriesHandler(r *http.Request) (interface{}, *Error) {
+	if len(r.Form["match[]"]) == 0 {
+		return nil, badData(fmt.Errorf("no match[] parameter provided"))
+	}
+	matched, apiErr := s.match(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	res := make([]model.Metric, 0, len(matched))
+	for _, ser := range matched {
+		res = append(res, metric(ser.labels))
+	}
+	return res, nil
+}
+
+func (s *Server) labelNames(r *http.Request) (interface{}, *Error) {
+	matched, apiErr := s.match(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	set := map[string]struct{}{}
+	for _, ser := range matched {
+		ser.labels.Range(func(l labels.Label) {
+			set[l.Name] = struct{}{}
+		})
+	}
+	return sortedKeys(set), nil
+}
+
+func (s *Server) labelValues(r *http.Request) (interface{}, *Error) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/label/")
+	name = strings.TrimSuffix(name, "/values")
+	if strings.Contains(name, "/") {
+		return nil, &Error{Status: http.StatusNotFound, Type: v1.ErrBadData, Msg: "not found"}
+	}
+
+	matched, apiErr := s.match(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	set := map[string]struct{}{}
+	for _, ser := range matched {
+		if v := ser.labels.Get(name); v != "" {
+			set[v] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil
+}
+
+// match returns the series matching any of the match[] selectors, or all
+// series if there are none, which have samples between start and end.
+func (s *Server) match(r *http.Request) ([]series, *Error) {
+	var matcherSets [][]*labels.Matcher
+	for _, m := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(m)
+		if err != nil {
+			return nil, badData(err)
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+	if t := r.Form.Get("start"); t != "" {
+		start, err := parseTime(t)
+		if err != nil {
+			return nil, badData(fmt.Errorf("invalid parameter \"start\": %w", err))
+		}
+		mint = start.UnixMilli()
+	}
+	if t := r.Form.Get("end"); t != "" {
+		end, err := parseTime(t)
+		if err != nil {
+			return nil, badData(fmt.Errorf("invalid parameter \"end\": %w", err))
+		}
+		maxt = end.UnixMilli()
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var res []series
+	for _, ser := range s.series {
+		if !hasSamplesBetween(ser.samples, mint, maxt) {
+			continue
+		}
+		if len(matcherSets) == 0 {
+			res = append(res, ser)
+			continue
+		}
+		for _, matchers := range matcherSets {
+			if matches(ser.labels, matchers) {
+				res = append(res, ser)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func hasSamplesBetween(samples []storage.Sample, mint, maxt int64) bool {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp >= mint })
+	return i < len(samples) && samples[i].Timestamp <= maxt
+}
+
+func matches(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	res := make([]string, 0, len(set))
+	for k := range set {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// parseTime parses a timestamp as RFC 3339 or as Unix time in seconds.
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration parses a duration in seconds or in the Prometheus duration format.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
@@ -0,0 +1,144 @@
+package prometheustest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/liticer/gclients/prometheus/v1"
+)
+
+var start = time.Unix(1700000000, 0).UTC()
+
+func newTestServer(t *testing.T) *Server {
+	s := NewServer()
+	t.Cleanup(s.Close)
+
+	s.MustLoad(start, time.Minute,
+		`up{job="api", instance="a"} 1 1 0 _ 1`,
+		`up{job="api", instance="b"} 1 1 1 1 stale`,
+		`up{job="db", instance="c"} 1x4`,
+		`http_requests_total{job="api"} 0+10x4`,
+	)
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	s := newTestServer(t)
+	api := s.API()
+	ctx := context.Background()
+
+	v, err := api.Query(ctx, `up{job="api"}`, start.Add(3*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, model.Vector{
+		{Metric: model.Metric{"__name__": "up", "instance": "a", "job": "api"}, Value: 0, Timestamp: model.TimeFromUnix(start.Add(3 * time.Minute).Unix())},
+		{Metric: model.Metric{"__name__": "up", "instance": "b", "job": "api"}, Value: 1, Timestamp: model.TimeFromUnix(start.Add(3 * time.Minute).Unix())},
+	}, v)
+
+	// The stale marker ends series b.
+	v, err = api.Query(ctx, `up{job="api"}`, start.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, v, 1)
+	require.Equal(t, model.SampleValue(1), v.(model.Vector)[0].Value)
+
+	v, err = api.Query(ctx, `http_requests_total[2m]`, start.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []model.SamplePair{
+		{Timestamp: model.TimeFromUnix(start.Add(3 * time.Minute).Unix()), Value: 30},
+		{Timestamp: model.TimeFromUnix(start.Add(4 * time.Minute).Unix()), Value: 40},
+	}, v.(model.Matrix)[0].Values)
+
+	_, err = api.Query(ctx, `sum(up)`, start)
+	require.ErrorContains(t, err, "unsupported expression")
+
+	s.SetResponse("sum  by (job) (up)", model.Vector{{Metric: model.Metric{"job": "api"}, Value: 2}})
+	v, err = api.Query(ctx, `sum by(job)(up)`, start)
+	require.NoError(t, err)
+	require.Equal(t, model.Vector{{Metric: model.Metric{"job": "api"}, Value: 2}}, v)
+}
+
+func TestQueryRange(t *testing.T) {
+	s := newTestServer(t)
+
+	v, err := s.API().QueryRange(context.Background(), `up{instance="a"}`, v1.Range{
+		Start: start,
+		End:   start.Add(4 * time.Minute),
+		Step:  time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, model.Matrix{{
+		Metric: model.Metric{"__name__": "up", "instance": "a", "job": "api"},
+		Values: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(start.Unix()), Value: 1},
+			{Timestamp: model.TimeFromUnix(start.Add(time.Minute).Unix()), Value: 1},
+			{Timestamp: model.TimeFromUnix(start.Add(2 * time.Minute).Unix()), Value: 0},
+			// The omitted sample is filled from the lookback delta.
+			{Timestamp: model.TimeFromUnix(start.Add(3 * time.Minute).Unix()), Value: 0},
+			{Timestamp: model.TimeFromUnix(start.Add(4 * time.Minute).Unix()), Value: 1},
+		},
+	}}, v)
+}
+
+func TestSeriesAndLabels(t *testing.T) {
+	s := newTestServer(t)
+	api := s.API()
+	ctx := context.Background()
+
+	series, err := api.Series(ctx, []string{`up{job="db"}`, `http_requests_total`}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []model.Metric{
+		{"__name__": "http_requests_total", "job": "api"},
+		{"__name__": "up", "instance": "c", "job": "db"},
+	}, series)
+
+	names, err := api.Labels(ctx, nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelValues{"__name__", "instance", "job"}, names)
+
+	values, err := api.LabelValues(ctx, "instance", []string{`up{job="api"}`}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelValues{"a", "b"}, values)
+
+	// No series has samples after the loaded ones.
+	values, err = api.LabelValues(ctx, "job", nil, start.Add(time.Hour), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestInjection(t *testing.T) {
+	s := newTestServer(t)
+	api := s.API()
+	ctx := context.Background()
+
+	s.SetWarnings(EndpointQuery, "results truncated")
+	res, err := api.QueryDetailed(ctx, "up", start)
+	require.NoError(t, err)
+	require.Equal(t, v1.Warnings{"results truncated"}, res.Warnings)
+
+	s.SetError(EndpointQuery, &Error{Status: http.StatusUnprocessableEntity, Type: v1.ErrTimeout, Msg: "query timed out"})
+	_, err = api.Query(ctx, "up", start)
+	var apiErr *v1.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, v1.ErrorType(v1.ErrTimeout), apiErr.Type)
+	require.Equal(t, "query timed out", apiErr.Msg)
+
+	// The status code defaults to 422.
+	s.SetError(EndpointQuery, &Error{Type: v1.ErrExec, Msg: "division by zero"})
+	_, err = api.Query(ctx, "up", start)
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, v1.ErrorType(v1.ErrExec), apiErr.Type)
+	require.Equal(t, "division by zero", apiErr.Msg)
+
+	s.SetError(EndpointQuery, &Error{Status: http.StatusServiceUnavailable, Type: v1.ErrExec, Msg: "overloaded"})
+	_, err = api.Query(ctx, "up", start)
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, v1.ErrorType(v1.ErrBadResponse), apiErr.Type)
+
+	s.SetError(EndpointQuery, nil)
+	_, err = api.Query(ctx, "up", start)
+	require.NoError(t, err)
+}
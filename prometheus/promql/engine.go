@@ -0,0 +1,1717 @@
+// Package promql evaluates PromQL expressions parsed by the parser package
+// against the series of a storage.Queryable.
+package promql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/model/timestamp"
+	"github.com/liticer/gclients/prometheus/model/value"
+	"github.com/liticer/gclients/prometheus/parser"
+)
+
+type (
+	// ErrQueryTimeout is returned if a query timed out during processing.
+	ErrQueryTimeout string
+	// ErrQueryCanceled is returned if a query was canceled during processing.
+	ErrQueryCanceled string
+	// ErrTooManySamples is returned if a query would load more than the maximum allowed samples into memory.
+	ErrTooManySamples string
+	// ErrStorage is returned if an error was encountered in the storage layer
+	// during query handling.
+	ErrStorage struct{ Err error }
+)
+
+func (e ErrQueryTimeout) Error() string {
+	return fmt.Sprintf("query timed out in %s", string(e))
+}
+
+func (e ErrQueryCanceled) Error() string {
+	return fmt.Sprintf("query was canceled in %s", string(e))
+}
+
+func (e ErrTooManySamples) Error() string {
+	return fmt.Sprintf("query processing would load too many samples into memory in %s", string(e))
+}
+
+func (e ErrStorage) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrStorage) Unwrap() error {
+	return e.Err
+}
+
+// EngineOpts contains configuration options used when creating a new Engine.
+type EngineOpts struct {
+	// The maximum duration of a query. Queries are not limited if zero.
+	Timeout time.Duration
+
+	// The maximum number of samples a single query may load from the
+	// Queryable. Queries are not limited if zero.
+	MaxSamples int
+
+	// How far back an instant vector selector looks for the latest sample.
+	// Defaults to 5m.
+	LookbackDelta time.Duration
+
+	// The step of subqueries which do not specify one. Defaults to 1m.
+	NoStepSubqueryInterval time.Duration
+
+	// EnableExperimentalFunctions enables the experimental functions and
+	// aggregators in queries.
+	EnableExperimentalFunctions bool
+}
+
+// Engine evaluates PromQL queries.
+type Engine struct {
+	opts EngineOpts
+}
+
+// NewEngine returns a new engine.
+func NewEngine(opts EngineOpts) *Engine {
+	if opts.LookbackDelta <= 0 {
+		opts.LookbackDelta = 5 * time.Minute
+	}
+	if opts.NoStepSubqueryInterval <= 0 {
+		opts.NoStepSubqueryInterval = time.Minute
+	}
+	return &Engine{opts: opts}
+}
+
+// Query is a query prepared for execution by an Engine.
+type Query interface {
+	// Exec evaluates the query.
+	Exec(ctx context.Context) *Result
+	// Statement returns the parsed statement of the query.
+	Statement() parser.Statement
+	// String returns the original query string.
+	String() string
+}
+
+type query struct {
+	engine    *Engine
+	queryable storage.Queryable
+	q         string
+	stmt      *parser.EvalStmt
+}
+
+func (q *query) Statement() parser.Statement { return q.stmt }
+
+func (q *query) String() string { return q.q }
+
+// NewInstantQuery returns an evaluation query for the given expression at the given time.
+func (ng *Engine) NewInstantQuery(q storage.Queryable, qs string, ts time.Time) (Query, error) {
+	expr, err := ng.parse(qs)
+	if err != nil {
+		return nil, err
+	}
+	return ng.newQuery(q, qs, expr, ts, ts, 0), nil
+}
+
+// NewRangeQuery returns an evaluation query for the given time range and with
+// the resolution set by the interval.
+func (ng *Engine) NewRangeQuery(q storage.Queryable, qs string, start, end time.Time, interval time.Duration) (Query, error) {
+	expr, err := ng.parse(qs)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Type() != parser.ValueTypeVector && expr.Type() != parser.ValueTypeScalar {
+		return nil, fmt.Errorf("invalid expression type %q for range query, must be Scalar or instant Vector", parser.DocumentedType(expr.Type()))
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("zero or negative query resolution step widths are not accepted")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end timestamp must not be before start time")
+	}
+	return ng.newQuery(q, qs, expr, start, end, interval), nil
+}
+
+func (ng *Engine) parse(qs string) (parser.Expr, error) {
+	return parser.ParseExprWithOptions(qs, parser.Options{EnableExperimentalFunctions: ng.opts.EnableExperimentalFunctions})
+}
+
+func (ng *Engine) newQuery(q storage.Queryable, qs string, expr parser.Expr, start, end time.Time, interval time.Duration) *query {
+	return &query{
+		engine:    ng,
+		queryable: q,
+		q:         qs,
+		stmt: &parser.EvalStmt{
+			Expr:          PreprocessExpr(expandInfoCalls(expr), start, end),
+			Start:         start,
+			End:           end,
+			Interval:      interval,
+			LookbackDelta: ng.opts.LookbackDelta,
+		},
+	}
+}
+
+// Exec implements the Query interface.
+func (q *query) Exec(ctx context.Context) *Result {
+	if q.engine.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.engine.opts.Timeout)
+		defer cancel()
+	}
+
+	s := q.stmt
+	mint, maxt := FindMinMaxTimes(s)
+	querier, err := q.queryable.Querier(mint, maxt)
+	if err != nil {
+		return &Result{Err: ErrStorage{Err: err}}
+	}
+	defer querier.Close()
+
+	ev := &evaluator{
+		ctx:                    ctx,
+		querier:                querier,
+		startTimestamp:         timestamp.FromTime(s.Start),
+		endTimestamp:           timestamp.FromTime(s.End),
+		interval:               durationMilliseconds(s.Interval),
+		lookbackDelta:          durationMilliseconds(s.LookbackDelta),
+		noStepSubqueryInterval: durationMilliseconds(q.engine.opts.NoStepSubqueryInterval),
+		maxSamples:             q.engine.opts.MaxSamples,
+		state:                  &evalState{},
+	}
+	instant := s.Interval == 0
+	if instant {
+		// Instant evaluation is a range evaluation with a single step.
+		ev.interval = 1
+	}
+
+	val, ws, err := ev.Eval(s.Expr)
+	if err != nil {
+		return &Result{Err: err, Warnings: ws}
+	}
+
+	mat, ok := val.(Matrix)
+	if !ok {
+		// A string.
+		return &Result{Value: val, Warnings: ws}
+	}
+	if !instant {
+		sort.Sort(mat)
+		return &Result{Value: mat, Warnings: ws}
+	}
+
+	switch s.Expr.Type() {
+	case parser.ValueTypeMatrix:
+		return &Result{Value: mat, Warnings: ws}
+	case parser.ValueTypeScalar:
+		v := math.NaN()
+		if len(mat) > 0 {
+			v = mat[0].Floats[0].F
+		}
+		return &Result{Value: Scalar{T: ev.startTimestamp, V: v}, Warnings: ws}
+	default:
+		vec := make(Vector, 0, len(mat))
+		for _, ss := range mat {
+			vec = append(vec, Sample{Metric: ss.Metric, T: ss.Floats[0].T, F: ss.Floats[0].F})
+		}
+		return &Result{Value: vec, Warnings: ws}
+	}
+}
+
+func contextDone(ctx context.Context, env string) error {
+	if err := ctx.Err(); err != nil {
+		return contextErr(err, env)
+	}
+	return nil
+}
+
+func contextErr(err error, env string) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrQueryCanceled(env)
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrQueryTimeout(env)
+	default:
+		return err
+	}
+}
+
+// evaluator evaluates an expression at the steps from startTimestamp to
+// endTimestamp. Values of type instant vector or scalar are evaluated into a
+// Matrix holding the points of all steps.
+type evaluator struct {
+	ctx     context.Context
+	querier storage.Querier
+
+	startTimestamp int64 // Start time in milliseconds.
+	endTimestamp   int64 // End time in milliseconds.
+	interval       int64 // Interval in milliseconds.
+
+	lookbackDelta          int64
+	noStepSubqueryInterval int64
+	maxSamples             int
+
+	state *evalState
+}
+
+// evalState is shared by the evaluators of a query and its subqueries.
+type evalState struct {
+	samples  int
+	warnings storage.Warnings
+}
+
+// with returns an evaluator for the given steps sharing the state of ev.
+func (ev *evaluator) with(start, end, interval int64) *evaluator {
+	newEv := *ev
+	newEv.startTimestamp, newEv.endTimestamp, newEv.interval = start, end, interval
+	return &newEv
+}
+
+// errorf causes a panic with the input formatted into an error.
+func (ev *evaluator) errorf(format string, args ...interface{}) {
+	ev.error(fmt.Errorf(format, args...))
+}
+
+// error causes a panic with the given error.
+func (ev *evaluator) error(err error) {
+	panic(err)
+}
+
+// recover is the handler that turns panics into returns from the top level of evaluation.
+func (ev *evaluator) recover(errp *error) {
+	e := recover()
+	if e == nil {
+		return
+	}
+
+	switch err := e.(type) {
+	case runtime.Error:
+		buf := make([]byte, 64<<10)
+		buf = buf[:runtime.Stack(buf, false)]
+		*errp = fmt.Errorf("unexpected error: %w\n%s", err, buf)
+	case error:
+		*errp = err
+	default:
+		*errp = fmt.Errorf("%v", err)
+	}
+}
+
+// Eval evaluates the given expression and returns the resulting value
+// together with the warnings of the Queryable.
+func (ev *evaluator) Eval(expr parser.Expr) (v parser.Value, ws storage.Warnings, err error) {
+	defer func() { ws = ev.state.warnings }()
+	defer ev.recover(&err)
+
+	return ev.eval(expr), nil, nil
+}
+
+func (ev *evaluator) numSteps() int {
+	return int((ev.endTimestamp-ev.startTimestamp)/ev.interval) + 1
+}
+
+// addSamples accounts for n samples loaded from the Queryable.
+func (ev *evaluator) addSamples(n int) {
+	ev.state.samples += n
+	if ev.maxSamples > 0 && ev.state.samples > ev.maxSamples {
+		ev.error(ErrTooManySamples("query execution"))
+	}
+}
+
+// EvalNodeHelper stores extra information and caches for evaluating a single
+// node across steps.
+type EvalNodeHelper struct {
+	// Evaluation timestamp.
+	Ts int64
+	// Vector that can be used for output.
+	Out Vector
+
+	// The range of the range vector argument of a function, which holds the
+	// samples with rangeStart < t <= rangeEnd.
+	rangeStart, rangeEnd int64
+
+	lb     *labels.Builder
+	lblBuf []byte
+}
+
+func (enh *EvalNodeHelper) resetBuilder(lbls labels.Labels) {
+	if enh.lb == nil {
+		enh.lb = labels.NewBuilder(lbls)
+	} else {
+		enh.lb.Reset(lbls)
+	}
+}
+
+// rangeEval evaluates the given expressions, and then for each step calls
+// the given funcCall with the values computed for each expression at that
+// step. The return value is the combination into time series of all the
+// function call results.
+// String arguments are not evaluated, functions take them from the
+// expressions.
+func (ev *evaluator) rangeEval(funcCall func([]parser.Value, *EvalNodeHelper) Vector, exprs ...parser.Expr) Matrix {
+	var (
+		matrixes = make([]Matrix, len(exprs))
+		cursors  = make([][]int, len(exprs))
+		vectors  = make([]Vector, len(exprs))
+		args     = make([]parser.Value, len(exprs))
+	)
+	for i, e := range exprs {
+		if e.Type() == parser.ValueTypeString {
+			continue
+		}
+		matrixes[i] = ev.eval(e).(Matrix)
+		cursors[i] = make([]int, len(matrixes[i]))
+	}
+
+	var (
+		enh     = &EvalNodeHelper{}
+		seriess = map[uint64]*Series{}
+		order   []uint64
+	)
+	for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+		if err := contextDone(ev.ctx, "expression evaluation"); err != nil {
+			ev.error(err)
+		}
+
+		// Gather input vectors for this timestamp.
+		for i, m := range matrixes {
+			if m == nil {
+				continue
+			}
+			vectors[i] = vectors[i][:0]
+			for si, series := range m {
+				c := cursors[i][si]
+				for c < len(series.Floats) && series.Floats[c].T < ts {
+					c++
+				}
+				if c < len(series.Floats) && series.Floats[c].T == ts {
+					vectors[i] = append(vectors[i], Sample{Metric: series.Metric, T: ts, F: series.Floats[c].F})
+				}
+				cursors[i][si] = c
+			}
+			args[i] = vectors[i]
+		}
+
+		enh.Ts = ts
+		result := funcCall(args, enh)
+		if result.ContainsSameLabelset() {
+			ev.errorf("vector cannot contain metrics with the same labelset")
+		}
+
+		if ev.startTimestamp == ev.endTimestamp {
+			// Keep the order of the result for instant queries, which
+			// matters for sort and sort_desc.
+			mat := make(Matrix, len(result))
+			for i, s := range result {
+				mat[i] = Series{Metric: s.Metric, Floats: []FPoint{{T: ts, F: s.F}}}
+			}
+			return mat
+		}
+
+		for _, s := range result {
+			h := s.Metric.Hash()
+			ss, ok := seriess[h]
+			if !ok {
+				ss = &Series{Metric: s.Metric}
+				seriess[h] = ss
+				order = append(order, h)
+			}
+			ss.Floats = append(ss.Floats, FPoint{T: ts, F: s.F})
+		}
+		enh.Out = result[:0] // Reuse result vector.
+	}
+
+	mat := make(Matrix, 0, len(seriess))
+	for _, h := range order {
+		mat = append(mat, *seriess[h])
+	}
+	return mat
+}
+
+// eval evaluates the given expression as the given AST expression node requires.
+func (ev *evaluator) eval(expr parser.Expr) parser.Value {
+	if err := contextDone(ev.ctx, "expression evaluation"); err != nil {
+		ev.error(err)
+	}
+
+	switch e := expr.(type) {
+	case *parser.AggregateExpr:
+		return ev.evalAggregation(e)
+
+	case *parser.Call:
+		return ev.evalCall(e)
+
+	case *parser.ParenExpr:
+		return ev.eval(e.Expr)
+
+	case *parser.UnaryExpr:
+		mat := ev.eval(e.Expr).(Matrix)
+		if e.Op == parser.SUB {
+			for i := range mat {
+				mat[i].Metric = dropMetricName(mat[i].Metric)
+				for j := range mat[i].Floats {
+					mat[i].Floats[j].F = -mat[i].Floats[j].F
+				}
+			}
+			if mat.ContainsSameLabelset() {
+				ev.errorf("vector cannot contain metrics with the same labelset")
+			}
+		}
+		return mat
+
+	case *parser.BinaryExpr:
+		return ev.evalBinary(e)
+
+	case *parser.NumberLiteral:
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return append(enh.Out, Sample{F: e.Val})
+		})
+
+	case *parser.StringLiteral:
+		return String{V: e.Val, T: ev.startTimestamp}
+
+	case *parser.VectorSelector:
+		return ev.evalVectorSelector(e)
+
+	case *parser.MatrixSelector:
+		if ev.startTimestamp != ev.endTimestamp {
+			ev.errorf("cannot do range evaluation of matrix selector")
+		}
+		vs := e.VectorSelector.(*parser.VectorSelector)
+		rng := durationMilliseconds(e.Range)
+		end := refTime(vs.Timestamp, vs.OriginalOffset, ev.startTimestamp)
+		return windowMatrix(ev.selectSeries(vs, rng), end-rng, end)
+
+	case *parser.SubqueryExpr:
+		if ev.startTimestamp != ev.endTimestamp {
+			ev.errorf("cannot do range evaluation of subquery")
+		}
+		rng := durationMilliseconds(e.Range)
+		end := refTime(e.Timestamp, e.OriginalOffset, ev.startTimestamp)
+		return windowMatrix(ev.evalSubquery(e), end-rng, end)
+
+	case *parser.StepInvariantExpr:
+		switch e.Expr.(type) {
+		case *parser.StringLiteral, *parser.NumberLiteral:
+			return ev.eval(e.Expr)
+		}
+		if ev.startTimestamp == ev.endTimestamp || e.Expr.Type() == parser.ValueTypeMatrix {
+			return ev.eval(e.Expr)
+		}
+
+		// Evaluate the expression once and repeat its result for all steps.
+		res := ev.with(ev.startTimestamp, ev.startTimestamp, 1).eval(e.Expr)
+		mat, ok := res.(Matrix)
+		if !ok {
+			return res
+		}
+		for i := range mat {
+			f := mat[i].Floats[0].F
+			floats := make([]FPoint, 0, ev.numSteps())
+			for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+				floats = append(floats, FPoint{T: ts, F: f})
+			}
+			mat[i].Floats = floats
+		}
+		return mat
+	}
+
+	panic(fmt.Errorf("unhandled expression of type: %T", expr))
+}
+
+// refTime returns the time a selector or subquery with the given @ modifier
+// and offset refers to at the evaluation time ts.
+func refTime(at *int64, offset time.Duration, ts int64) int64 {
+	if at != nil {
+		ts = *at
+	}
+	return ts - durationMilliseconds(offset)
+}
+
+// selectSeries returns the series selected by vs with their samples needed
+// for all steps, including rng milliseconds before the referred time.
+func (ev *evaluator) selectSeries(vs *parser.VectorSelector, rng int64) []Series {
+	mint := refTime(vs.Timestamp, vs.OriginalOffset, ev.startTimestamp) - rng
+	maxt := refTime(vs.Timestamp, vs.OriginalOffset, ev.endTimestamp)
+
+	hints := &storage.SelectHints{Start: mint + 1, End: maxt, Step: ev.interval, Range: rng}
+	set := ev.querier.Select(ev.ctx, hints, vs.LabelMatchers...)
+	var res []Series
+	for set.Next() {
+		s := set.At()
+		ss := Series{Metric: s.Labels()}
+
+		it := s.Iterator()
+		for typ := it.SeekTo(mint + 1); typ != storage.ValNone; typ = it.Next() {
+			if typ != storage.ValFloat {
+				continue
+			}
+			t, f := it.At()
+			if t > maxt {
+				break
+			}
+			ss.Floats = append(ss.Floats, FPoint{T: t, F: f})
+		}
+		if err := it.Err(); err != nil {
+			ev.error(ErrStorage{Err: err})
+		}
+		ev.addSamples(len(ss.Floats))
+		res = append(res, ss)
+	}
+	if err := set.Err(); err != nil {
+		ev.error(ErrStorage{Err: err})
+	}
+	ev.state.warnings = append(ev.state.warnings, set.Warnings()...)
+	return res
+}
+
+// lookback returns the latest sample at or before t within the lookback
+// delta. There is none if it is a stale marker.
+func (ev *evaluator) lookback(floats []FPoint, t int64) (FPoint, bool) {
+	i := sort.Search(len(floats), func(i int) bool { return floats[i].T > t })
+	if i == 0 {
+		return FPoint{}, false
+	}
+	p := floats[i-1]
+	if p.T <= t-ev.lookbackDelta || value.IsStaleNaN(p.F) {
+		return FPoint{}, false
+	}
+	return p, true
+}
+
+func (ev *evaluator) evalVectorSelector(vs *parser.VectorSelector) Matrix {
+	series := ev.selectSeries(vs, ev.lookbackDelta)
+	mat := make(Matrix, 0, len(series))
+	for _, s := range series {
+		ss := Series{Metric: s.Metric}
+		for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+			if p, ok := ev.lookback(s.Floats, refTime(vs.Timestamp, vs.OriginalOffset, ts)); ok {
+				ss.Floats = append(ss.Floats, FPoint{T: ts, F: p.F})
+			}
+		}
+		if len(ss.Floats) > 0 {
+			mat = append(mat, ss)
+		}
+	}
+	return mat
+}
+
+// window returns the points with start < t <= end, without stale markers.
+func window(floats []FPoint, start, end int64) []FPoint {
+	i := sort.Search(len(floats), func(i int) bool { return floats[i].T > start })
+	j := sort.Search(len(floats), func(i int) bool { return floats[i].T > end })
+	return floats[i:j]
+}
+
+// windowMatrix returns the series of mat with their points in (start, end].
+func windowMatrix(mat []Series, start, end int64) Matrix {
+	res := Matrix{}
+	for _, s := range mat {
+		if floats := window(dropStaleNaNs(s.Floats), start, end); len(floats) > 0 {
+			res = append(res, Series{Metric: s.Metric, Floats: floats})
+		}
+	}
+	return res
+}
+
+// dropStaleNaNs returns the points which are no stale markers. Range vectors
+// never contain stale markers.
+func dropStaleNaNs(floats []FPoint) []FPoint {
+	for i, p := range floats {
+		if !value.IsStaleNaN(p.F) {
+			continue
+		}
+		res := append(make([]FPoint, 0, len(floats)), floats[:i]...)
+		for _, p := range floats[i+1:] {
+			if !value.IsStaleNaN(p.F) {
+				res = append(res, p)
+			}
+		}
+		return res
+	}
+	return floats
+}
+
+// evalSubquery evaluates the inner expression of subq at the steps needed
+// for all evaluation times of ev. The steps are aligned to multiples of the
+// step of the subquery.
+func (ev *evaluator) evalSubquery(subq *parser.SubqueryExpr) Matrix {
+	step := durationMilliseconds(subq.Step)
+	if step == 0 {
+		step = ev.noStepSubqueryInterval
+	}
+	start := refTime(subq.Timestamp, subq.OriginalOffset, ev.startTimestamp) - durationMilliseconds(subq.Range)
+	end := refTime(subq.Timestamp, subq.OriginalOffset, ev.endTimestamp)
+
+	// Start with the first timestamp after start that is aligned with the step.
+	newStart := step * (start / step)
+	if newStart <= start {
+		newStart += step
+	}
+	if newStart > end {
+		return Matrix{}
+	}
+	return ev.with(newStart, end, step).eval(subq.Expr).(Matrix)
+}
+
+// unwrapExpr returns the expression wrapped by parentheses and step
+// invariant expressions.
+func unwrapExpr(e parser.Expr) parser.Expr {
+	for {
+		switch n := e.(type) {
+		case *parser.ParenExpr:
+			e = n.Expr
+		case *parser.StepInvariantExpr:
+			e = n.Expr
+		default:
+			return e
+		}
+	}
+}
+
+func (ev *evaluator) evalCall(e *parser.Call) parser.Value {
+	call, ok := FunctionCalls[e.Func.Name]
+	if !ok {
+		ev.errorf("function %q is not supported", e.Func.Name)
+	}
+
+	if e.Func.Name == "timestamp" {
+		// Vector evaluation always returns the evaluation time,
+		// so this function needs special handling when given
+		// a vector selector.
+		if vs, ok := unwrapExpr(e.Args[0]).(*parser.VectorSelector); ok {
+			return ev.evalTimestampOfVectorSelector(vs)
+		}
+	}
+
+	for i, a := range e.Args {
+		switch unwrapExpr(a).(type) {
+		case *parser.MatrixSelector, *parser.SubqueryExpr:
+			return ev.evalRangeFunction(e, call, i)
+		}
+	}
+	return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+		return call(v, e.Args, enh)
+	}, e.Args...)
+}
+
+// expandInfoCalls sets the second argument of all info calls in expr to the
+// selector of their info series, so that it is evaluated like any other
+// argument and FindMinMaxTimes accounts for the samples it reads.
+func expandInfoCalls(expr parser.Expr) parser.Expr {
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.Call); ok && n.Func.Name == "info" {
+			n.Args = parser.Expressions{n.Args[0], infoSelector(n)}
+		}
+		return nil
+	})
+	return expr
+}
+
+// infoSelector returns the selector of the info series of an info call,
+// which selects target_info unless the call selects another metric name.
+// Unless it has its own, the selector takes the offset and @ modifiers of
+// the first selector of the first argument, to select the info series at
+// the time of its samples.
+func infoSelector(e *parser.Call) *parser.VectorSelector {
+	vs := &parser.VectorSelector{PosRange: e.PositionRange()}
+	if len(e.Args) > 1 {
+		sel := *unwrapExpr(e.Args[1]).(*parser.VectorSelector)
+		vs = &sel
+	}
+	if vs.OriginalOffset == 0 && vs.Timestamp == nil && vs.StartOrEnd == 0 {
+		if base := firstVectorSelector(e.Args[0]); base != nil {
+			vs.OriginalOffset, vs.Timestamp, vs.StartOrEnd = base.OriginalOffset, base.Timestamp, base.StartOrEnd
+		}
+	}
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName {
+			return vs
+		}
+	}
+	vs.LabelMatchers = append([]*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "target_info"),
+	}, vs.LabelMatchers...)
+	return vs
+}
+
+// firstVectorSelector returns the first vector selector in expr, nil if
+// there is none.
+func firstVectorSelector(expr parser.Expr) *parser.VectorSelector {
+	var vs *parser.VectorSelector
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.VectorSelector); ok && vs == nil {
+			vs = n
+		}
+		return nil
+	})
+	return vs
+}
+
+func (ev *evaluator) evalTimestampOfVectorSelector(vs *parser.VectorSelector) Matrix {
+	series := ev.selectSeries(vs, ev.lookbackDelta)
+	mat := make(Matrix, 0, len(series))
+	for _, s := range series {
+		ss := Series{Metric: dropMetricName(s.Metric)}
+		for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+			if p, ok := ev.lookback(s.Floats, refTime(vs.Timestamp, vs.OriginalOffset, ts)); ok {
+				ss.Floats = append(ss.Floats, FPoint{T: ts, F: float64(p.T) / 1000})
+			}
+		}
+		if len(ss.Floats) > 0 {
+			mat = append(mat, ss)
+		}
+	}
+	if mat.ContainsSameLabelset() {
+		ev.errorf("vector cannot contain metrics with the same labelset")
+	}
+	return mat
+}
+
+// evalRangeFunction evaluates a call of a function taking the range vector
+// at matrixArgIndex, series by series.
+func (ev *evaluator) evalRangeFunction(e *parser.Call, call FunctionCall, matrixArgIndex int) Matrix {
+	var (
+		series []Series
+		rng    int64
+		at     *int64
+		offset time.Duration
+	)
+	switch a := unwrapExpr(e.Args[matrixArgIndex]).(type) {
+	case *parser.MatrixSelector:
+		vs := a.VectorSelector.(*parser.VectorSelector)
+		rng, at, offset = durationMilliseconds(a.Range), vs.Timestamp, vs.OriginalOffset
+		series = ev.selectSeries(vs, rng)
+	case *parser.SubqueryExpr:
+		rng, at, offset = durationMilliseconds(a.Range), a.Timestamp, a.OriginalOffset
+		series = ev.evalSubquery(a)
+	}
+
+	// Evaluate the scalar arguments. String arguments are taken from the
+	// expressions.
+	var (
+		otherArgs = make([]Matrix, len(e.Args))
+		otherVecs = make([]Vector, len(e.Args))
+		inArgs    = make([]parser.Value, len(e.Args))
+		inMatrix  = make(Matrix, 1)
+	)
+	for i, a := range e.Args {
+		if i != matrixArgIndex && a.Type() != parser.ValueTypeString {
+			otherArgs[i] = ev.eval(a).(Matrix)
+			otherVecs[i] = make(Vector, 1)
+			inArgs[i] = otherVecs[i]
+		}
+	}
+	inArgs[matrixArgIndex] = inMatrix
+
+	var (
+		enh     = &EvalNodeHelper{Out: make(Vector, 0, 1)}
+		mat     = make(Matrix, 0, len(series))
+		absent  = e.Func.Name == "absent_over_time"
+		present []bool
+	)
+	if absent {
+		present = make([]bool, ev.numSteps())
+	}
+	for _, s := range series {
+		if err := contextDone(ev.ctx, "expression evaluation"); err != nil {
+			ev.error(err)
+		}
+
+		floats := dropStaleNaNs(s.Floats)
+		ss := Series{Metric: s.Metric}
+		if e.Func.Name != "last_over_time" {
+			ss.Metric = dropMetricName(ss.Metric)
+		}
+		inMatrix[0].Metric = s.Metric
+
+		for step, ts := 0, ev.startTimestamp; ts <= ev.endTimestamp; step, ts = step+1, ts+ev.interval {
+			end := refTime(at, offset, ts)
+			points := window(floats, end-rng, end)
+			if len(points) == 0 {
+				continue
+			}
+			if absent {
+				present[step] = true
+				continue
+			}
+
+			inMatrix[0].Floats = points
+			for i, m := range otherArgs {
+				if m == nil {
+					continue
+				}
+				otherVecs[i][0] = Sample{T: ts, F: math.NaN()}
+				if len(m) > 0 && step < len(m[0].Floats) {
+					otherVecs[i][0].F = m[0].Floats[step].F
+				}
+			}
+			enh.Ts, enh.rangeStart, enh.rangeEnd = ts, end-rng, end
+			outVec := call(inArgs, e.Args, enh)
+			enh.Out = outVec[:0]
+			if len(outVec) > 0 {
+				ss.Floats = append(ss.Floats, FPoint{T: ts, F: outVec[0].F})
+			}
+		}
+		if len(ss.Floats) > 0 {
+			mat = append(mat, ss)
+		}
+	}
+
+	if absent {
+		ss := Series{Metric: createLabelsForAbsentFunction(e.Args[0])}
+		for step, ts := 0, ev.startTimestamp; ts <= ev.endTimestamp; step, ts = step+1, ts+ev.interval {
+			if !present[step] {
+				ss.Floats = append(ss.Floats, FPoint{T: ts, F: 1})
+			}
+		}
+		if len(ss.Floats) == 0 {
+			return Matrix{}
+		}
+		return Matrix{ss}
+	}
+
+	if mat.ContainsSameLabelset() {
+		ev.errorf("vector cannot contain metrics with the same labelset")
+	}
+	return mat
+}
+
+func (ev *evaluator) evalBinary(e *parser.BinaryExpr) Matrix {
+	switch lt, rt := e.LHS.Type(), e.RHS.Type(); {
+	case lt == parser.ValueTypeScalar && rt == parser.ValueTypeScalar:
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			val := scalarBinop(e.Op, v[0].(Vector)[0].F, v[1].(Vector)[0].F)
+			return append(enh.Out, Sample{F: val})
+		}, e.LHS, e.RHS)
+
+	case lt == parser.ValueTypeVector && rt == parser.ValueTypeVector:
+		var f func(lhs, rhs Vector, matching *parser.VectorMatching, enh *EvalNodeHelper) Vector
+		switch e.Op {
+		case parser.LAND:
+			f = ev.VectorAnd
+		case parser.LOR:
+			f = ev.VectorOr
+		case parser.LUNLESS:
+			f = ev.VectorUnless
+		default:
+			f = func(lhs, rhs Vector, matching *parser.VectorMatching, enh *EvalNodeHelper) Vector {
+				return ev.VectorBinop(e.Op, lhs, rhs, matching, e.ReturnBool, enh)
+			}
+		}
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return f(v[0].(Vector), v[1].(Vector), e.VectorMatching, enh)
+		}, e.LHS, e.RHS)
+
+	case lt == parser.ValueTypeVector && rt == parser.ValueTypeScalar:
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return ev.VectorscalarBinop(e.Op, v[0].(Vector), Scalar{V: v[1].(Vector)[0].F}, false, e.ReturnBool, enh)
+		}, e.LHS, e.RHS)
+
+	default: // Scalar on the left, vector on the right.
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return ev.VectorscalarBinop(e.Op, v[1].(Vector), Scalar{V: v[0].(Vector)[0].F}, true, e.ReturnBool, enh)
+		}, e.LHS, e.RHS)
+	}
+}
+
+// VectorAnd returns the samples of lhs with a match in rhs.
+func (ev *evaluator) VectorAnd(lhs, rhs Vector, matching *parser.VectorMatching, enh *EvalNodeHelper) Vector {
+	if matching.Card != parser.CardManyToMany {
+		panic("set operations must only use many-to-many matching")
+	}
+	if len(lhs) == 0 || len(rhs) == 0 {
+		return nil // Short-circuit: AND with nothing is nothing.
+	}
+
+	sigf := signatureFunc(matching.On, enh.lblBuf, matching.MatchingLabels...)
+	// The set of signatures for the right-hand side Vector.
+	rightSigs := map[string]struct{}{}
+	// Add all rhs samples to a map so we can easily find matches later.
+	for _, rs := range rhs {
+		rightSigs[sigf(rs.Metric)] = struct{}{}
+	}
+
+	for _, ls := range lhs {
+		// If there's a matching entry in the right-hand side Vector, add the sample.
+		if _, ok := rightSigs[sigf(ls.Metric)]; ok {
+			enh.Out = append(enh.Out, ls)
+		}
+	}
+	return enh.Out
+}
+
+// VectorOr returns the samples of lhs and the samples of rhs without a match
+// in lhs.
+func (ev *evaluator) VectorOr(lhs, rhs Vector, matching *parser.VectorMatching, enh *EvalNodeHelper) Vector {
+	switch {
+	case matching.Card != parser.CardManyToMany:
+		panic("set operations must only use many-to-many matching")
+	case len(lhs) == 0: // Short-circuit.
+		enh.Out = append(enh.Out, rhs...)
+		return enh.Out
+	case len(rhs) == 0:
+		enh.Out = append(enh.Out, lhs...)
+		return enh.Out
+	}
+
+	sigf := signatureFunc(matching.On, enh.lblBuf, matching.MatchingLabels...)
+	leftSigs := map[string]struct{}{}
+	// Add everything from the left-hand-side Vector.
+	for _, ls := range lhs {
+		leftSigs[sigf(ls.Metric)] = struct{}{}
+		enh.Out = append(enh.Out, ls)
+	}
+	// Add all right-hand side elements which have not been added from the left-hand side.
+	for _, rs := range rhs {
+		if _, ok := leftSigs[sigf(rs.Metric)]; !ok {
+			enh.Out = append(enh.Out, rs)
+		}
+	}
+	return enh.Out
+}
+
+// VectorUnless returns the samples of lhs without a match in rhs.
+func (ev *evaluator) VectorUnless(lhs, rhs Vector, matching *parser.VectorMatching, enh *EvalNodeHelper) Vector {
+	if matching.Card != parser.CardManyToMany {
+		panic("set operations must only use many-to-many matching")
+	}
+	// Short-circuit: empty rhs means we will return everything in lhs;
+	// empty lhs means we will return empty - don't need to build a map.
+	if len(lhs) == 0 || len(rhs) == 0 {
+		enh.Out = append(enh.Out, lhs...)
+		return enh.Out
+	}
+
+	sigf := signatureFunc(matching.On, enh.lblBuf, matching.MatchingLabels...)
+	rightSigs := map[string]struct{}{}
+	for _, rs := range rhs {
+		rightSigs[sigf(rs.Metric)] = struct{}{}
+	}
+
+	for _, ls := range lhs {
+		if _, ok := rightSigs[sigf(ls.Metric)]; !ok {
+			enh.Out = append(enh.Out, ls)
+		}
+	}
+	return enh.Out
+}
+
+// VectorBinop evaluates a binary operation between two Vectors, excluding set operators.
+func (ev *evaluator) VectorBinop(op parser.ItemType, lhs, rhs Vector, matching *parser.VectorMatching, returnBool bool, enh *EvalNodeHelper) Vector {
+	if matching.Card == parser.CardManyToMany {
+		panic("many-to-many only allowed for set operators")
+	}
+	if len(lhs) == 0 || len(rhs) == 0 {
+		return nil // Short-circuit: nothing is going to match.
+	}
+
+	sigf := signatureFunc(matching.On, enh.lblBuf, matching.MatchingLabels...)
+
+	// The control flow below handles one-to-one or many-to-one matching.
+	// For one-to-many, swap sidedness and account for the swap when calculating
+	// values.
+	if matching.Card == parser.CardOneToMany {
+		lhs, rhs = rhs, lhs
+	}
+
+	// All samples from the rhs hashed by the matching label/values.
+	rightSigs := map[string]Sample{}
+	for _, rs := range rhs {
+		sig := sigf(rs.Metric)
+		// The rhs is guaranteed to be the 'one' side. Having multiple samples
+		// with the same signature means that the matching is many-to-many.
+		if duplSample, found := rightSigs[sig]; found {
+			// oneSide represents which side of the vector represents the 'one' in the many-to-one relationship.
+			oneSide := "right"
+			if matching.Card == parser.CardOneToMany {
+				oneSide = "left"
+			}
+			matchedLabels := rs.Metric.MatchLabels(matching.On, matching.MatchingLabels...)
+			// Many-to-many matching not allowed.
+			ev.errorf("found duplicate series for the match group %s on the %s hand-side of the operation: [%s, %s]"+
+				";many-to-many matching not allowed: matching labels must be unique on one side", matchedLabels.String(), oneSide, rs.Metric.String(), duplSample.Metric.String())
+		}
+		rightSigs[sig] = rs
+	}
+
+	// Tracks the match-signature. For one-to-one operations the value is nil. For many-to-one
+	// the value is a set of signatures to detect duplicated result elements.
+	matchedSigs := map[string]map[uint64]struct{}{}
+
+	// For all lhs samples find a respective rhs sample and perform
+	// the binary operation.
+	for _, ls := range lhs {
+		sig := sigf(ls.Metric)
+
+		rs, found := rightSigs[sig] // Look for a match in the rhs Vector.
+		if !found {
+			continue
+		}
+
+		// Account for potentially swapped sidedness.
+		vl, vr := ls.F, rs.F
+		if matching.Card == parser.CardOneToMany {
+			vl, vr = vr, vl
+		}
+		value, keep := vectorElemBinop(op, vl, vr)
+		if returnBool {
+			if keep {
+				value = 1.0
+			} else {
+				value = 0.0
+			}
+		} else if !keep {
+			continue
+		}
+		metric := resultMetric(ls.Metric, rs.Metric, op, matching, enh)
+		if returnBool {
+			metric = dropMetricName(metric)
+		}
+		insertedSigs, exists := matchedSigs[sig]
+		if matching.Card == parser.CardOneToOne {
+			if exists {
+				ev.errorf("multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)")
+			}
+			matchedSigs[sig] = nil // Set existence to true.
+		} else {
+			// In many-to-one matching the grouping labels have to ensure a unique metric
+			// for the result Vector. Check whether those labels have already been added for
+			// the same matching labels.
+			insertSig := metric.Hash()
+
+			if !exists {
+				insertedSigs = map[uint64]struct{}{}
+				matchedSigs[sig] = insertedSigs
+			} else if _, duplicate := insertedSigs[insertSig]; duplicate {
+				ev.errorf("multiple matches for labels: grouping labels must ensure unique matches")
+			}
+			insertedSigs[insertSig] = struct{}{}
+		}
+
+		enh.Out = append(enh.Out, Sample{Metric: metric, F: value})
+	}
+	return enh.Out
+}
+
+func signatureFunc(on bool, b []byte, names ...string) func(labels.Labels) string {
+	if on {
+		names = append([]string(nil), names...)
+		sort.Strings(names)
+		return func(lset labels.Labels) string {
+			return string(lset.BytesWithLabels(b, names...))
+		}
+	}
+	names = append([]string{labels.MetricName}, names...)
+	sort.Strings(names)
+	return func(lset labels.Labels) string {
+		return string(lset.BytesWithoutLabels(b, names...))
+	}
+}
+
+// resultMetric returns the metric for the given sample(s) based on the Vector
+// binary operation and the matching options.
+func resultMetric(lhs, rhs labels.Labels, op parser.ItemType, matching *parser.VectorMatching, enh *EvalNodeHelper) labels.Labels {
+	enh.resetBuilder(lhs)
+
+	if shouldDropMetricName(op) {
+		enh.lb.Del(labels.MetricName)
+	}
+
+	if matching.Card == parser.CardOneToOne {
+		if matching.On {
+			enh.lb.Keep(matching.MatchingLabels...)
+		} else {
+			enh.lb.Del(matching.MatchingLabels...)
+		}
+	}
+	for _, ln := range matching.Include {
+		// Included labels from the `group_x` modifier are taken from the "one"-side.
+		if v := rhs.Get(ln); v != "" {
+			enh.lb.Set(ln, v)
+		} else {
+			enh.lb.Del(ln)
+		}
+	}
+
+	return enh.lb.Labels()
+}
+
+// VectorscalarBinop evaluates a binary operation between a Vector and a Scalar.
+func (ev *evaluator) VectorscalarBinop(op parser.ItemType, lhs Vector, rhs Scalar, swap, returnBool bool, enh *EvalNodeHelper) Vector {
+	for _, lhsSample := range lhs {
+		lv, rv := lhsSample.F, rhs.V
+		// lhs always contains the Vector. If the original position was different
+		// swap for calculating the value.
+		if swap {
+			lv, rv = rv, lv
+		}
+		value, keep := vectorElemBinop(op, lv, rv)
+		// Catch cases where the scalar is the LHS in a scalar-vector comparison operation.
+		// We want to always keep the vector element value as the output value, even if it's on the RHS.
+		if op.IsComparisonOperator() && swap {
+			value = rv
+		}
+		if returnBool {
+			if keep {
+				value = 1.0
+			} else {
+				value = 0.0
+			}
+			keep = true
+		}
+		if keep {
+			lhsSample.F = value
+			if shouldDropMetricName(op) || returnBool {
+				lhsSample.Metric = dropMetricName(lhsSample.Metric)
+			}
+			enh.Out = append(enh.Out, lhsSample)
+		}
+	}
+	return enh.Out
+}
+
+func dropMetricName(l labels.Labels) labels.Labels {
+	if !l.Has(labels.MetricName) {
+		return l
+	}
+	return labels.NewBuilder(l).Del(labels.MetricName).Labels()
+}
+
+// scalarBinop evaluates a binary operation between two Scalars.
+func scalarBinop(op parser.ItemType, lhs, rhs float64) float64 {
+	switch op {
+	case parser.ADD:
+		return lhs + rhs
+	case parser.SUB:
+		return lhs - rhs
+	case parser.MUL:
+		return lhs * rhs
+	case parser.DIV:
+		return lhs / rhs
+	case parser.POW:
+		return math.Pow(lhs, rhs)
+	case parser.MOD:
+		return math.Mod(lhs, rhs)
+	case parser.EQLC:
+		return btos(lhs == rhs)
+	case parser.NEQ:
+		return btos(lhs != rhs)
+	case parser.GTR:
+		return btos(lhs > rhs)
+	case parser.LSS:
+		return btos(lhs < rhs)
+	case parser.GTE:
+		return btos(lhs >= rhs)
+	case parser.LTE:
+		return btos(lhs <= rhs)
+	case parser.ATAN2:
+		return math.Atan2(lhs, rhs)
+	}
+	panic(fmt.Errorf("operator %q not allowed for Scalar operations", op))
+}
+
+// vectorElemBinop evaluates a binary operation between two Vector elements.
+func vectorElemBinop(op parser.ItemType, lhs, rhs float64) (float64, bool) {
+	switch op {
+	case parser.ADD:
+		return lhs + rhs, true
+	case parser.SUB:
+		return lhs - rhs, true
+	case parser.MUL:
+		return lhs * rhs, true
+	case parser.DIV:
+		return lhs / rhs, true
+	case parser.POW:
+		return math.Pow(lhs, rhs), true
+	case parser.MOD:
+		return math.Mod(lhs, rhs), true
+	case parser.EQLC:
+		return lhs, lhs == rhs
+	case parser.NEQ:
+		return lhs, lhs != rhs
+	case parser.GTR:
+		return lhs, lhs > rhs
+	case parser.LSS:
+		return lhs, lhs < rhs
+	case parser.GTE:
+		return lhs, lhs >= rhs
+	case parser.LTE:
+		return lhs, lhs <= rhs
+	case parser.ATAN2:
+		return math.Atan2(lhs, rhs), true
+	}
+	panic(fmt.Errorf("operator %q not allowed for operations between Vectors", op))
+}
+
+type groupedAggregation struct {
+	labels     labels.Labels
+	floatValue float64
+	floatMean  float64
+	groupCount int
+	values     []float64 // For quantile.
+	samples    Vector    // For topk and bottomk.
+}
+
+func (ev *evaluator) evalAggregation(e *parser.AggregateExpr) Matrix {
+	grouping := append([]string(nil), e.Grouping...)
+	sort.Strings(grouping)
+
+	switch {
+	case e.Op == parser.COUNT_VALUES:
+		valueLabel := stringFromArg(e.Param)
+		if !model.LabelName(valueLabel).IsValid() {
+			ev.errorf("invalid label name %q", valueLabel)
+		}
+		if !e.Without {
+			grouping = append(grouping, valueLabel)
+			sort.Strings(grouping)
+		}
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return ev.aggregation(e, grouping, 0, valueLabel, v[0].(Vector), enh)
+		}, e.Expr)
+
+	case e.Param != nil:
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return ev.aggregation(e, grouping, v[0].(Vector)[0].F, "", v[1].(Vector), enh)
+		}, e.Param, e.Expr)
+
+	default:
+		return ev.rangeEval(func(v []parser.Value, enh *EvalNodeHelper) Vector {
+			return ev.aggregation(e, grouping, 0, "", v[0].(Vector), enh)
+		}, e.Expr)
+	}
+}
+
+// aggregation evaluates an aggregation operation on a Vector. The provided
+// grouping labels must be sorted.
+func (ev *evaluator) aggregation(e *parser.AggregateExpr, grouping []string, param float64, valueLabel string, vec Vector, enh *EvalNodeHelper) Vector {
+	op, without := e.Op, e.Without
+
+	if op == parser.LIMIT_RATIO {
+		return limitRatio(param, vec, enh)
+	}
+
+	var k int64
+	if op == parser.TOPK || op == parser.BOTTOMK || op == parser.LIMITK {
+		if param >= math.MaxInt64 || param <= math.MinInt64 || math.IsNaN(param) {
+			ev.errorf("Scalar value %v overflows int64", param)
+		}
+		k = int64(param)
+		if k < 1 {
+			return Vector{}
+		}
+	}
+
+	var (
+		result = map[uint64]*groupedAggregation{}
+		order  []uint64
+	)
+	for _, s := range vec {
+		metric := s.Metric
+
+		if op == parser.COUNT_VALUES {
+			enh.resetBuilder(metric)
+			enh.lb.Set(valueLabel, strconv.FormatFloat(s.F, 'f', -1, 64))
+			metric = enh.lb.Labels()
+		}
+
+		var groupingKey uint64
+		if without {
+			groupingKey, enh.lblBuf = metric.HashWithoutLabels(enh.lblBuf, grouping...)
+		} else {
+			groupingKey, enh.lblBuf = metric.HashForLabels(enh.lblBuf, grouping...)
+		}
+
+		group, ok := result[groupingKey]
+		// Add a new group if it doesn't exist.
+		if !ok {
+			enh.resetBuilder(metric)
+			if without {
+				enh.lb.Del(grouping...)
+				enh.lb.Del(labels.MetricName)
+			} else {
+				enh.lb.Keep(grouping...)
+			}
+
+			group = &groupedAggregation{
+				labels:     enh.lb.Labels(),
+				floatValue: s.F,
+				floatMean:  s.F,
+				groupCount: 1,
+			}
+			switch op {
+			case parser.STDVAR, parser.STDDEV:
+				group.floatValue = 0
+			case parser.GROUP:
+				group.floatValue = 1
+			case parser.TOPK, parser.BOTTOMK, parser.LIMITK:
+				group.samples = Vector{s}
+			case parser.QUANTILE:
+				group.values = []float64{s.F}
+			}
+			result[groupingKey] = group
+			order = append(order, groupingKey)
+			continue
+		}
+
+		switch op {
+		case parser.SUM:
+			group.floatValue += s.F
+
+		case parser.AVG:
+			group.groupCount++
+			if math.IsInf(group.floatMean, 0) {
+				if math.IsInf(s.F, 0) && (group.floatMean > 0) == (s.F > 0) {
+					// The `floatMean` and `s.F` values are `Inf` of the same sign. They
+					// can't be subtracted, but the value of `floatMean` is correct
+					// already.
+					break
+				}
+				if !math.IsInf(s.F, 0) && !math.IsNaN(s.F) {
+					// At this stage, the mean is an infinite. If the added
+					// value is neither an Inf or a Nan, we can keep that mean
+					// value.
+					// This is required because our calculation below removes
+					// the mean value, which would look like Inf += x - Inf and
+					// end up as a NaN.
+					break
+				}
+			}
+			// Divide each side of the `-` by `group.groupCount` to avoid float64 overflows.
+			group.floatMean += s.F/float64(group.groupCount) - group.floatMean/float64(group.groupCount)
+
+		case parser.GROUP:
+			// Do nothing. Required to avoid the panic in `default:` below.
+
+		case parser.MAX:
+			if group.floatValue < s.F || math.IsNaN(group.floatValue) {
+				group.floatValue = s.F
+			}
+
+		case parser.MIN:
+			if group.floatValue > s.F || math.IsNaN(group.floatValue) {
+				group.floatValue = s.F
+			}
+
+		case parser.COUNT, parser.COUNT_VALUES:
+			group.groupCount++
+
+		case parser.STDVAR, parser.STDDEV:
+			group.groupCount++
+			delta := s.F - group.floatMean
+			group.floatMean += delta / float64(group.groupCount)
+			group.floatValue += delta * (s.F - group.floatMean)
+
+		case parser.TOPK, parser.BOTTOMK:
+			group.samples = append(group.samples, s)
+
+		case parser.LIMITK:
+			if int64(len(group.samples)) < k {
+				group.samples = append(group.samples, s)
+			}
+
+		case parser.QUANTILE:
+			group.values = append(group.values, s.F)
+
+		default:
+			panic(fmt.Errorf("expected aggregation operator but got %q", op))
+		}
+	}
+
+	// Construct the result Vector from the aggregated groups.
+	for _, key := range order {
+		aggr := result[key]
+		switch op {
+		case parser.AVG:
+			aggr.floatValue = aggr.floatMean
+
+		case parser.COUNT, parser.COUNT_VALUES:
+			aggr.floatValue = float64(aggr.groupCount)
+
+		case parser.STDVAR:
+			aggr.floatValue /= float64(aggr.groupCount)
+
+		case parser.STDDEV:
+			aggr.floatValue = math.Sqrt(aggr.floatValue / float64(aggr.groupCount))
+
+		case parser.TOPK, parser.BOTTOMK:
+			// NaN sorts after all other values in both directions.
+			less := func(a, b float64) bool { return a > b || math.IsNaN(b) && !math.IsNaN(a) }
+			if op == parser.BOTTOMK {
+				less = func(a, b float64) bool { return a < b || math.IsNaN(b) && !math.IsNaN(a) }
+			}
+			sort.SliceStable(aggr.samples, func(i, j int) bool {
+				return less(aggr.samples[i].F, aggr.samples[j].F)
+			})
+			if int64(len(aggr.samples)) > k {
+				aggr.samples = aggr.samples[:k]
+			}
+			enh.Out = append(enh.Out, aggr.samples...)
+			continue // Bypass default append.
+
+		case parser.LIMITK:
+			enh.Out = append(enh.Out, aggr.samples...)
+			continue // Bypass default append.
+
+		case parser.QUANTILE:
+			aggr.floatValue = quantile(param, aggr.values)
+		}
+
+		enh.Out = append(enh.Out, Sample{
+			Metric: aggr.labels,
+			F:      aggr.floatValue,
+		})
+	}
+	return enh.Out
+}
+
+// limitRatio returns the samples of vec selected by limit_ratio. Whether a
+// sample is selected only depends on the hash of its labels, so that the
+// same series are selected at every step and for ratios r and -(1-r) the
+// selected series are complementary. The ratio is clamped to [-1, 1].
+func limitRatio(ratio float64, vec Vector, enh *EvalNodeHelper) Vector {
+	if math.IsNaN(ratio) {
+		return enh.Out
+	}
+	ratio = math.Max(-1, math.Min(1, ratio))
+	for _, s := range vec {
+		offset := float64(s.Metric.Hash()) / math.MaxUint64
+		if ratio >= 0 && offset < ratio || ratio < 0 && offset >= 1+ratio {
+			enh.Out = append(enh.Out, s)
+		}
+	}
+	return enh.Out
+}
+
+// btos returns 1 if b is true, 0 otherwise.
+func btos(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// shouldDropMetricName returns whether the metric name should be dropped in the
+// result of the op operation.
+func shouldDropMetricName(op parser.ItemType) bool {
+	switch op {
+	case parser.ADD, parser.SUB, parser.DIV, parser.MUL, parser.POW, parser.MOD, parser.ATAN2:
+		return true
+	default:
+		return false
+	}
+}
+
+func durationMilliseconds(d time.Duration) int64 {
+	return int64(d / (time.Millisecond / time.Nanosecond))
+}
+
+// FindMinMaxTimes returns the time range in milliseconds the selectors of
+// the statement read samples from.
+func FindMinMaxTimes(s *parser.EvalStmt) (int64, int64) {
+	var minTimestamp, maxTimestamp int64 = math.MaxInt64, math.MinInt64
+	// Whenever a MatrixSelector is evaluated, evalRange is set to the corresponding range.
+	// The evaluation of the VectorSelector inside then evaluates the given range and unsets
+	// the variable.
+	var evalRange time.Duration
+	parser.Inspect(s, func(node parser.Node, path []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			start, end := getTimeRangesForSelector(s, n, path, evalRange)
+			if start < minTimestamp {
+				minTimestamp = start
+			}
+			if end > maxTimestamp {
+				maxTimestamp = end
+			}
+			evalRange = 0
+		case *parser.MatrixSelector:
+			evalRange = n.Range
+		}
+		return nil
+	})
+
+	if maxTimestamp == math.MinInt64 {
+		// This happens when there was no selector. Hence no time range to select.
+		minTimestamp = 0
+		maxTimestamp = 0
+	}
+
+	return minTimestamp, maxTimestamp
+}
+
+func getTimeRangesForSelector(s *parser.EvalStmt, n *parser.VectorSelector, path []parser.Node, evalRange time.Duration) (int64, int64) {
+	start, end := timestamp.FromTime(s.Start), timestamp.FromTime(s.End)
+	subqOffset, subqRange, subqTs := subqueryTimes(path)
+
+	if subqTs != nil {
+		// The timestamp on the subquery overrides the eval statement time ranges.
+		start = *subqTs
+		end = *subqTs
+	}
+
+	if n.Timestamp != nil {
+		// The timestamp on the selector overrides everything.
+		start = *n.Timestamp
+		end = *n.Timestamp
+	} else {
+		offsetMilliseconds := durationMilliseconds(subqOffset)
+		start = start - offsetMilliseconds - durationMilliseconds(subqRange)
+		end -= offsetMilliseconds
+	}
+
+	if evalRange == 0 {
+		start -= durationMilliseconds(s.LookbackDelta)
+	} else {
+		// For all matrix queries we want to ensure that we have (end-start) + range selected
+		// this way we have `range` data before the start time.
+		start -= durationMilliseconds(evalRange)
+	}
+
+	offsetMilliseconds := durationMilliseconds(n.OriginalOffset)
+	start -= offsetMilliseconds
+	end -= offsetMilliseconds
+
+	return start, end
+}
+
+// subqueryTimes returns the sum of offsets and ranges of all subqueries in the path.
+// If the @ modifier is used, then the offset and range is w.r.t. that timestamp
+// (i.e. the sum is reset when we have @ modifier).
+// The returned *int64 is the closest timestamp that was seen. nil for no @ modifier.
+func subqueryTimes(path []parser.Node) (time.Duration, time.Duration, *int64) {
+	var (
+		subqOffset, subqRange time.Duration
+		ts                    int64 = math.MaxInt64
+	)
+	for _, node := range path {
+		if n, ok := node.(*parser.SubqueryExpr); ok {
+			subqOffset += n.OriginalOffset
+			subqRange += n.Range
+			if n.Timestamp != nil {
+				// The @ modifier on subquery invalidates all the offset and
+				// range till now. Hence resetting it here.
+				subqOffset = n.OriginalOffset
+				subqRange = n.Range
+				ts = *n.Timestamp
+			}
+		}
+	}
+	var tsp *int64
+	if ts != math.MaxInt64 {
+		tsp = &ts
+	}
+	return subqOffset, subqRange, tsp
+}
+
+// PreprocessExpr wraps all possible step invariant parts of the given expression with
+// StepInvariantExpr. It also resolves the preprocessors start() and end() of
+// the @ modifier to the given times.
+func PreprocessExpr(expr parser.Expr, start, end time.Time) parser.Expr {
+	isStepInvariant := preprocessExprHelper(expr, start, end)
+	if isStepInvariant {
+		return newStepInvariantExpr(expr)
+	}
+	return expr
+}
+
+// preprocessExprHelper wraps the child nodes of the expression
+// with a StepInvariantExpr wherever it's step invariant. The returned boolean is true if the
+// passed expression qualifies to be wrapped by StepInvariantExpr.
+// It also resolves the preprocessors.
+func preprocessExprHelper(expr parser.Expr, start, end time.Time) bool {
+	switch n := expr.(type) {
+	case *parser.VectorSelector:
+		switch n.StartOrEnd {
+		case parser.START:
+			n.Timestamp = makeInt64Pointer(timestamp.FromTime(start))
+		case parser.END:
+			n.Timestamp = makeInt64Pointer(timestamp.FromTime(end))
+		}
+		return n.Timestamp != nil
+
+	case *parser.AggregateExpr:
+		return preprocessExprHelper(n.Expr, start, end)
+
+	case *parser.BinaryExpr:
+		isInvariant1, isInvariant2 := preprocessExprHelper(n.LHS, start, end), preprocessExprHelper(n.RHS, start, end)
+		if isInvariant1 && isInvariant2 {
+			return true
+		}
+
+		if isInvariant1 {
+			n.LHS = newStepInvariantExpr(n.LHS)
+		}
+		if isInvariant2 {
+			n.RHS = newStepInvariantExpr(n.RHS)
+		}
+
+		return false
+
+	case *parser.Call:
+		_, ok := AtModifierUnsafeFunctions[n.Func.Name]
+		isStepInvariant := !ok
+		isStepInvariantSlice := make([]bool, len(n.Args))
+		for i := range n.Args {
+			isStepInvariantSlice[i] = preprocessExprHelper(n.Args[i], start, end)
+			isStepInvariant = isStepInvariant && isStepInvariantSlice[i]
+		}
+
+		if isStepInvariant {
+			// The function and all arguments are step invariant.
+			return true
+		}
+
+		for i, isi := range isStepInvariantSlice {
+			if isi {
+				n.Args[i] = newStepInvariantExpr(n.Args[i])
+			}
+		}
+		return false
+
+	case *parser.MatrixSelector:
+		return preprocessExprHelper(n.VectorSelector, start, end)
+
+	case *parser.SubqueryExpr:
+		// Wrap the inside of the subquery irrespective of @ on the subquery,
+		// so that it is evaluated only once.
+		isInvariant := preprocessExprHelper(n.Expr, start, end)
+		if isInvariant {
+			n.Expr = newStepInvariantExpr(n.Expr)
+		}
+		switch n.StartOrEnd {
+		case parser.START:
+			n.Timestamp = makeInt64Pointer(timestamp.FromTime(start))
+		case parser.END:
+			n.Timestamp = makeInt64Pointer(timestamp.FromTime(end))
+		}
+		return n.Timestamp != nil
+
+	case *parser.ParenExpr:
+		return preprocessExprHelper(n.Expr, start, end)
+
+	case *parser.UnaryExpr:
+		return preprocessExprHelper(n.Expr, start, end)
+
+	case *parser.StringLiteral, *parser.NumberLiteral:
+		return true
+	}
+
+	panic(fmt.Sprintf("found unexpected node %#v", expr))
+}
+
+func newStepInvariantExpr(expr parser.Expr) parser.Expr {
+	return &parser.StepInvariantExpr{Expr: expr}
+}
+
+func makeInt64Pointer(val int64) *int64 {
+	valp := new(int64)
+	*valp = val
+	return valp
+}
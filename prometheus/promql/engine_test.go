@@ -0,0 +1,773 @@
+package promql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/parser"
+)
+
+// testStorage serves the series loaded from series descriptions.
+type testStorage struct {
+	series []testSeries
+}
+
+type testSeries struct {
+	labels  labels.Labels
+	samples []storage.Sample
+}
+
+// newTestStorage loads the given series descriptions with samples every
+// step, starting at 0.
+func newTestStorage(t *testing.T, step time.Duration, descs ...string) *testStorage {
+	s := &testStorage{}
+	for _, desc := range descs {
+		lset, vals, err := parser.ParseSeriesDesc(desc)
+		require.NoError(t, err)
+
+		ts := testSeries{labels: lset}
+		for i, v := range vals {
+			if v.Omitted {
+				continue
+			}
+			ts.samples = append(ts.samples, storage.Sample{Timestamp: int64(i) * step.Milliseconds(), Value: v.Value})
+		}
+		s.series = append(s.series, ts)
+	}
+	sort.Slice(s.series, func(i, j int) bool { return labels.Compare(s.series[i].labels, s.series[j].labels) < 0 })
+	return s
+}
+
+func (s *testStorage) Querier(mint, maxt int64) (storage.Querier, error) {
+	return &testQuerier{storage: s, mint: mint, maxt: maxt}, nil
+}
+
+type testQuerier struct {
+	storage    *testStorage
+	mint, maxt int64
+}
+
+// Select returns the matching series with their samples narrowed to the
+// time range of the hints, or of the querier if hints is nil.
+func (q *testQuerier) Select(_ context.Context, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+	var res []storage.Series
+	for _, s := range q.storage.series {
+		if !matchAll(s.labels, matchers) {
+			continue
+		}
+		var samples []storage.Sample
+		for _, smpl := range s.samples {
+			if smpl.Timestamp >= mint && smpl.Timestamp <= maxt {
+				samples = append(samples, smpl)
+			}
+		}
+		res = append(res, storage.NewListSeries(s.labels, samples))
+	}
+	return storage.NewListSeriesSet(res, nil)
+}
+
+func (q *testQuerier) LabelValues(context.Context, string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (q *testQuerier) LabelNames(context.Context, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (q *testQuerier) Close() error { return nil }
+
+func matchAll(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestInstantQuery(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`http_requests{job="api", instance="0", group="production"} 0+10x10`,
+		`http_requests{job="api", instance="1", group="production"} 0+20x10`,
+		`http_requests{job="api", instance="0", group="canary"} 0+30x10`,
+		`http_requests{job="db", instance="0", group="production"} 0+50x10`,
+		`http_requests{job="db", instance="1", group="canary"} 0+80x10`,
+		`job_info{job="api", team="a"} 1x10`,
+		`job_info{job="db", team="b"} 1x10`,
+		`stale_metric 1 2 stale`,
+		`counter 0 10 20 5 15`,
+		`request_duration_bucket{le="0.1"} 0+10x10`,
+		`request_duration_bucket{le="0.5"} 0+50x10`,
+		`request_duration_bucket{le="+Inf"} 0+100x10`,
+	)
+	ng := NewEngine(EngineOpts{})
+
+	testInstantQueries(t, ng, q, []instantQueryCase{
+		{
+			query: `http_requests{job="db"}`,
+			res: Vector{
+				{T: 600000, F: 500, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+				{T: 600000, F: 800, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "1", "job", "db")},
+			},
+		},
+		{
+			query: `sum by (job) (http_requests)`,
+			res: Vector{
+				{T: 600000, F: 600, Metric: labels.FromStrings("job", "api")},
+				{T: 600000, F: 1300, Metric: labels.FromStrings("job", "db")},
+			},
+		},
+		{
+			query: `avg without (instance, group) (http_requests)`,
+			res: Vector{
+				{T: 600000, F: 200, Metric: labels.FromStrings("job", "api")},
+				{T: 600000, F: 650, Metric: labels.FromStrings("job", "db")},
+			},
+		},
+		{
+			query: `count_values("value", http_requests{job="api"} / 100)`,
+			res: Vector{
+				{T: 600000, F: 1, Metric: labels.FromStrings("value", "1")},
+				{T: 600000, F: 1, Metric: labels.FromStrings("value", "2")},
+				{T: 600000, F: 1, Metric: labels.FromStrings("value", "3")},
+			},
+		},
+		{
+			query:   `topk(2, http_requests)`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: 800, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "1", "job", "db")},
+				{T: 600000, F: 500, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+			},
+		},
+		{
+			query: `quantile(0.5, http_requests{job="api"})`,
+			res:   Vector{{T: 600000, F: 200, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `stddev(http_requests{job="api"})`,
+			res:   Vector{{T: 600000, F: math.Sqrt(20000.0 / 3), Metric: labels.EmptyLabels()}},
+		},
+		{
+			query:   `sort_desc(http_requests{group="production"} offset 5m)`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: 250, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api")},
+				{T: 600000, F: 50, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api")},
+			},
+		},
+		{
+			query: `http_requests{job="api", group="canary"} @ 120`,
+			res: Vector{
+				{T: 600000, F: 60, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "0", "job", "api")},
+			},
+		},
+		{
+			query: `sum by (job) (http_requests) * on (job) group_left (team) job_info`,
+			res: Vector{
+				{T: 600000, F: 600, Metric: labels.FromStrings("job", "api", "team", "a")},
+				{T: 600000, F: 1300, Metric: labels.FromStrings("job", "db", "team", "b")},
+			},
+		},
+		{
+			query: `http_requests{group="canary"} and ignoring (group, instance) http_requests{job="api", group="production"}`,
+			res: Vector{
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "0", "job", "api")},
+			},
+		},
+		{
+			query: `http_requests{instance="1"} unless on (job) http_requests{group="canary", instance="0"}`,
+			res: Vector{
+				{T: 600000, F: 800, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "1", "job", "db")},
+			},
+		},
+		{
+			query: `http_requests{job="db"} > bool 600`,
+			res: Vector{
+				{T: 600000, F: 0, Metric: labels.FromStrings("group", "production", "instance", "0", "job", "db")},
+				{T: 600000, F: 1, Metric: labels.FromStrings("group", "canary", "instance", "1", "job", "db")},
+			},
+		},
+		{
+			query: `600 < http_requests{job="db"}`,
+			res: Vector{
+				{T: 600000, F: 800, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "1", "job", "db")},
+			},
+		},
+		{
+			query: `rate(http_requests{job="api", instance="0", group="production"}[5m])`,
+			res: Vector{
+				{T: 600000, F: 10.0 / 60, Metric: labels.FromStrings("group", "production", "instance", "0", "job", "api")},
+			},
+		},
+		{
+			query: `last_over_time(http_requests{job="db", instance="0"}[5m])`,
+			res: Vector{
+				{T: 600000, F: 500, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+			},
+		},
+		{
+			query: `max_over_time(rate(http_requests{job="db", instance="0"}[2m])[5m:1m])`,
+			res: Vector{
+				{T: 600000, F: 50.0 / 60, Metric: labels.FromStrings("group", "production", "instance", "0", "job", "db")},
+			},
+		},
+		{
+			query: `resets(counter[10m])`,
+			res:   Vector{{T: 600000, F: 1, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `stale_metric`,
+			ts:    time.Unix(120, 0),
+			res:   Vector{},
+		},
+		{
+			query: `stale_metric`,
+			ts:    time.Unix(60, 0),
+			res: Vector{
+				{T: 60000, F: 2, Metric: labels.FromStrings("__name__", "stale_metric")},
+			},
+		},
+		{
+			query: `count_over_time(stale_metric[5m])`,
+			ts:    time.Unix(120, 0),
+			res:   Vector{{T: 120000, F: 2, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `histogram_quantile(0.9, request_duration_bucket)`,
+			res:   Vector{{T: 600000, F: 0.5, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `histogram_quantile(0.3, request_duration_bucket)`,
+			res:   Vector{{T: 600000, F: 0.1 + 0.4*(200.0/400), Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `absent(nonexistent{job="x", instance=~"y"})`,
+			res:   Vector{{T: 600000, F: 1, Metric: labels.FromStrings("job", "x")}},
+		},
+		{
+			query: `absent_over_time(http_requests[5m])`,
+			res:   Vector{},
+		},
+		{
+			query: `label_replace(job_info{job="api"}, "owner", "team-$1", "team", "(.*)")`,
+			res: Vector{
+				{T: 600000, F: 1, Metric: labels.FromStrings("__name__", "job_info", "job", "api", "owner", "team-a", "team", "a")},
+			},
+		},
+		{
+			query: `scalar(sum(job_info)) * 2 + time()`,
+			res:   Scalar{T: 600000, V: 604},
+		},
+		{
+			query: `"a string"`,
+			res:   String{T: 600000, V: "a string"},
+		},
+		{
+			query: `job_info[2m]`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "job_info", "job", "api", "team", "a"), Floats: []FPoint{{T: 540000, F: 1}, {T: 600000, F: 1}}},
+				{Metric: labels.FromStrings("__name__", "job_info", "job", "db", "team", "b"), Floats: []FPoint{{T: 540000, F: 1}, {T: 600000, F: 1}}},
+			},
+		},
+		{
+			query: `-job_info{job="api"}`,
+			res:   Vector{{T: 600000, F: -1, Metric: labels.FromStrings("job", "api", "team", "a")}},
+		},
+		{
+			query: `http_requests + ignoring (instance) http_requests`,
+			err:   "found duplicate series for the match group",
+		},
+		{
+			query: `http_requests + on (job) group_left http_requests`,
+			err:   "found duplicate series for the match group",
+		},
+		{
+			query: `label_replace(http_requests{group="production", job="api"}, "instance", "x", "", "")`,
+			err:   "vector cannot contain metrics with the same labelset",
+		},
+	})
+}
+
+type instantQueryCase struct {
+	query   string
+	ts      time.Time // Evaluation time, 600s if zero.
+	res     parser.Value
+	ordered bool // Whether the order of the resulting Vector is defined.
+	err     string
+}
+
+// testInstantQueries runs every case as an instant query against q.
+func testInstantQueries(t *testing.T, ng *Engine, q storage.Queryable, cases []instantQueryCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			evalTime := time.Unix(600, 0)
+			if !c.ts.IsZero() {
+				evalTime = c.ts
+			}
+			qry, err := ng.NewInstantQuery(q, c.query, evalTime)
+			require.NoError(t, err)
+
+			res := qry.Exec(context.Background())
+			if c.err != "" {
+				require.Error(t, res.Err)
+				require.Contains(t, res.Err.Error(), c.err)
+				return
+			}
+			require.NoError(t, res.Err)
+			if vec, ok := res.Value.(Vector); ok && !c.ordered {
+				sortVector(vec)
+				sortVector(c.res.(Vector))
+			}
+			requireValuesEqual(t, c.res, res.Value)
+		})
+	}
+}
+
+func TestVectorMatching(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`errors{method="get", code="500"} 24x10`,
+		`errors{method="get", code="404"} 30x10`,
+		`errors{method="put", code="501"} 3x10`,
+		`errors{method="post", code="500"} 6x10`,
+		`errors{method="post", code="404"} 21x10`,
+		`requests{method="get"} 600x10`,
+		`requests{method="del"} 34x10`,
+		`requests{method="post"} 120x10`,
+	)
+
+	testInstantQueries(t, NewEngine(EngineOpts{}), q, []instantQueryCase{
+		{
+			query: `errors{code="500"} / ignoring (code) requests`,
+			res: Vector{
+				{T: 600000, F: 0.04, Metric: labels.FromStrings("method", "get")},
+				{T: 600000, F: 0.05, Metric: labels.FromStrings("method", "post")},
+			},
+		},
+		{
+			query: `errors{code="500"} / on (method) requests`,
+			res: Vector{
+				{T: 600000, F: 0.04, Metric: labels.FromStrings("method", "get")},
+				{T: 600000, F: 0.05, Metric: labels.FromStrings("method", "post")},
+			},
+		},
+		{
+			query: `errors / ignoring (code) group_left requests`,
+			res: Vector{
+				{T: 600000, F: 0.04, Metric: labels.FromStrings("code", "500", "method", "get")},
+				{T: 600000, F: 0.05, Metric: labels.FromStrings("code", "404", "method", "get")},
+				{T: 600000, F: 0.05, Metric: labels.FromStrings("code", "500", "method", "post")},
+				{T: 600000, F: 0.175, Metric: labels.FromStrings("code", "404", "method", "post")},
+			},
+		},
+		{
+			query: `requests / on (method) group_right errors`,
+			res: Vector{
+				{T: 600000, F: 25, Metric: labels.FromStrings("code", "500", "method", "get")},
+				{T: 600000, F: 20, Metric: labels.FromStrings("code", "404", "method", "get")},
+				{T: 600000, F: 20, Metric: labels.FromStrings("code", "500", "method", "post")},
+				{T: 600000, F: 120.0 / 21, Metric: labels.FromStrings("code", "404", "method", "post")},
+			},
+		},
+		{
+			// Comparisons without bool keep the value and labels of the left side.
+			query: `errors > on (method) group_left requests / 10`,
+			res: Vector{
+				{T: 600000, F: 21, Metric: labels.FromStrings("__name__", "errors", "code", "404", "method", "post")},
+			},
+		},
+		{
+			query: `requests or ignoring (code) errors`,
+			res: Vector{
+				{T: 600000, F: 600, Metric: labels.FromStrings("__name__", "requests", "method", "get")},
+				{T: 600000, F: 34, Metric: labels.FromStrings("__name__", "requests", "method", "del")},
+				{T: 600000, F: 120, Metric: labels.FromStrings("__name__", "requests", "method", "post")},
+				{T: 600000, F: 3, Metric: labels.FromStrings("__name__", "errors", "code", "501", "method", "put")},
+			},
+		},
+		{
+			query: `requests and on (method) errors`,
+			res: Vector{
+				{T: 600000, F: 600, Metric: labels.FromStrings("__name__", "requests", "method", "get")},
+				{T: 600000, F: 120, Metric: labels.FromStrings("__name__", "requests", "method", "post")},
+			},
+		},
+		{
+			query: `requests unless ignoring (code) errors`,
+			res: Vector{
+				{T: 600000, F: 34, Metric: labels.FromStrings("__name__", "requests", "method", "del")},
+			},
+		},
+		{
+			query: `errors / on (method) requests`,
+			err:   "many-to-one matching must be explicit (group_left/group_right)",
+		},
+		{
+			query: `requests / on (method) group_left errors`,
+			err:   "found duplicate series for the match group",
+		},
+	})
+}
+
+func TestSubqueries(t *testing.T) {
+	q := newTestStorage(t, time.Minute, `metric 0+10x10`)
+
+	testInstantQueries(t, NewEngine(EngineOpts{}), q, []instantQueryCase{
+		{
+			query: `metric[5m:1m]`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 360000, F: 60}, {T: 420000, F: 70}, {T: 480000, F: 80}, {T: 540000, F: 90}, {T: 600000, F: 100}}},
+			},
+		},
+		{
+			// Subquery steps are aligned to multiples of the step.
+			query: `metric[5m:2m]`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 360000, F: 60}, {T: 480000, F: 80}, {T: 600000, F: 100}}},
+			},
+		},
+		{
+			query: `metric[3m:1m]`,
+			ts:    time.Unix(630, 0),
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 480000, F: 80}, {T: 540000, F: 90}, {T: 600000, F: 100}}},
+			},
+		},
+		{
+			// Without a step, the default of 1m is used.
+			query: `metric[3m:]`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 480000, F: 80}, {T: 540000, F: 90}, {T: 600000, F: 100}}},
+			},
+		},
+		{
+			query: `metric[3m:1m] offset 2m`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 360000, F: 60}, {T: 420000, F: 70}, {T: 480000, F: 80}}},
+			},
+		},
+		{
+			query: `metric[2m:1m] @ 300`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 240000, F: 40}, {T: 300000, F: 50}}},
+			},
+		},
+		{
+			query: `sum_over_time(metric[5m:2m])`,
+			res:   Vector{{T: 600000, F: 240, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `rate(metric[2m])[4m:2m]`,
+			res: Matrix{
+				{Metric: labels.EmptyLabels(), Floats: []FPoint{{T: 480000, F: 10.0 / 60}, {T: 600000, F: 10.0 / 60}}},
+			},
+		},
+		{
+			query: `max_over_time(min_over_time(metric[2m:1m])[4m:2m])`,
+			res:   Vector{{T: 600000, F: 90, Metric: labels.EmptyLabels()}},
+		},
+	})
+}
+
+func TestAtModifierAndOffset(t *testing.T) {
+	q := newTestStorage(t, time.Minute, `metric 0+10x10`)
+
+	testInstantQueries(t, NewEngine(EngineOpts{}), q, []instantQueryCase{
+		{
+			query: `metric offset 3m`,
+			res:   Vector{{T: 600000, F: 70, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			query: `metric offset 90s`,
+			res:   Vector{{T: 600000, F: 80, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			query: `metric offset 15m`,
+			res:   Vector{},
+		},
+		{
+			query: `metric @ 300`,
+			res:   Vector{{T: 600000, F: 50, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			query: `metric @ 300 offset 1m`,
+			res:   Vector{{T: 600000, F: 40, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			// Samples after the evaluation time are visible with @.
+			query: `metric @ 600`,
+			ts:    time.Unix(0, 0),
+			res:   Vector{{T: 0, F: 100, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			query: `metric @ start()`,
+			ts:    time.Unix(120, 0),
+			res:   Vector{{T: 120000, F: 20, Metric: labels.FromStrings("__name__", "metric")}},
+		},
+		{
+			query: `metric[2m] offset 1m`,
+			res: Matrix{
+				{Metric: labels.FromStrings("__name__", "metric"), Floats: []FPoint{{T: 480000, F: 80}, {T: 540000, F: 90}}},
+			},
+		},
+		{
+			query: `sum_over_time(metric[2m] @ 180)`,
+			res:   Vector{{T: 600000, F: 50, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `metric - metric offset 1m`,
+			res:   Vector{{T: 600000, F: 10, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `timestamp(metric @ 300)`,
+			res:   Vector{{T: 600000, F: 300, Metric: labels.EmptyLabels()}},
+		},
+	})
+}
+
+func TestStalenessAndLookback(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`stale 1 2 stale`,
+		`gap 1 _ _ _ _ _ _ 8`,
+	)
+
+	// The default lookback delta is 5m, and samples exactly one lookback
+	// delta before the evaluation time are not selected.
+	testInstantQueries(t, NewEngine(EngineOpts{}), q, []instantQueryCase{
+		{
+			query: `gap`,
+			ts:    time.Unix(299, 0),
+			res:   Vector{{T: 299000, F: 1, Metric: labels.FromStrings("__name__", "gap")}},
+		},
+		{
+			query: `gap`,
+			ts:    time.Unix(300, 0),
+			res:   Vector{},
+		},
+		{
+			query: `gap`,
+			ts:    time.Unix(420, 0),
+			res:   Vector{{T: 420000, F: 8, Metric: labels.FromStrings("__name__", "gap")}},
+		},
+		{
+			query: `stale`,
+			ts:    time.Unix(60, 0),
+			res:   Vector{{T: 60000, F: 2, Metric: labels.FromStrings("__name__", "stale")}},
+		},
+		{
+			// The staleness marker hides the earlier samples within the lookback delta.
+			query: `stale`,
+			ts:    time.Unix(180, 0),
+			res:   Vector{},
+		},
+		{
+			// Range selectors skip staleness markers.
+			query: `last_over_time(stale[5m])`,
+			ts:    time.Unix(180, 0),
+			res:   Vector{{T: 180000, F: 2, Metric: labels.FromStrings("__name__", "stale")}},
+		},
+		{
+			query: `count_over_time(stale[5m])`,
+			ts:    time.Unix(180, 0),
+			res:   Vector{{T: 180000, F: 2, Metric: labels.EmptyLabels()}},
+		},
+	})
+
+	testInstantQueries(t, NewEngine(EngineOpts{LookbackDelta: 2 * time.Minute}), q, []instantQueryCase{
+		{
+			query: `gap`,
+			ts:    time.Unix(119, 0),
+			res:   Vector{{T: 119000, F: 1, Metric: labels.FromStrings("__name__", "gap")}},
+		},
+		{
+			query: `gap`,
+			ts:    time.Unix(120, 0),
+			res:   Vector{},
+		},
+		{
+			// Range selectors are not limited by the lookback delta.
+			query: `count_over_time(gap[10m])`,
+			ts:    time.Unix(420, 0),
+			res:   Vector{{T: 420000, F: 2, Metric: labels.EmptyLabels()}},
+		},
+	})
+}
+
+func sortVector(vec Vector) {
+	sort.Slice(vec, func(i, j int) bool { return labels.Compare(vec[i].Metric, vec[j].Metric) < 0 })
+}
+
+func TestRangeQuery(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`metric{job="a"} 0+10x10`,
+		`metric{job="b"} 0 1 _ _ _ _ _ _ 8 9`,
+	)
+	ng := NewEngine(EngineOpts{LookbackDelta: 2 * time.Minute})
+
+	cases := []struct {
+		query      string
+		start, end time.Time
+		interval   time.Duration
+		res        Matrix
+	}{
+		{
+			query:    `metric{job="b"}`,
+			start:    time.Unix(0, 0),
+			end:      time.Unix(540, 0),
+			interval: time.Minute,
+			res: Matrix{
+				{
+					Metric: labels.FromStrings("__name__", "metric", "job", "b"),
+					Floats: []FPoint{{T: 0, F: 0}, {T: 60000, F: 1}, {T: 120000, F: 1}, {T: 480000, F: 8}, {T: 540000, F: 9}},
+				},
+			},
+		},
+		{
+			query:    `sum(metric)`,
+			start:    time.Unix(60, 0),
+			end:      time.Unix(180, 0),
+			interval: time.Minute,
+			res: Matrix{
+				{
+					Metric: labels.EmptyLabels(),
+					Floats: []FPoint{{T: 60000, F: 11}, {T: 120000, F: 21}, {T: 180000, F: 30}},
+				},
+			},
+		},
+		{
+			query:    `metric{job="a"} @ end()`,
+			start:    time.Unix(0, 0),
+			end:      time.Unix(120, 0),
+			interval: time.Minute,
+			res: Matrix{
+				{
+					Metric: labels.FromStrings("__name__", "metric", "job", "a"),
+					Floats: []FPoint{{T: 0, F: 20}, {T: 60000, F: 20}, {T: 120000, F: 20}},
+				},
+			},
+		},
+		{
+			query:    `sum_over_time(metric{job="a"}[3m:2m])`,
+			start:    time.Unix(240, 0),
+			end:      time.Unix(360, 0),
+			interval: time.Minute,
+			res: Matrix{
+				{
+					Metric: labels.FromStrings("job", "a"),
+					Floats: []FPoint{{T: 240000, F: 60}, {T: 300000, F: 40}, {T: 360000, F: 100}},
+				},
+			},
+		},
+		{
+			query:    `time()`,
+			start:    time.Unix(0, 0),
+			end:      time.Unix(60, 0),
+			interval: 30 * time.Second,
+			res: Matrix{
+				{
+					Metric: labels.EmptyLabels(),
+					Floats: []FPoint{{T: 0, F: 0}, {T: 30000, F: 30}, {T: 60000, F: 60}},
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			qry, err := ng.NewRangeQuery(q, c.query, c.start, c.end, c.interval)
+			require.NoError(t, err)
+
+			res := qry.Exec(context.Background())
+			require.NoError(t, res.Err)
+			requireValuesEqual(t, c.res, res.Value)
+		})
+	}
+}
+
+func TestRangeQueryInvalid(t *testing.T) {
+	ng := NewEngine(EngineOpts{})
+	q := newTestStorage(t, time.Minute)
+
+	_, err := ng.NewRangeQuery(q, `metric[5m]`, time.Unix(0, 0), time.Unix(60, 0), time.Minute)
+	require.EqualError(t, err, `invalid expression type "range vector" for range query, must be Scalar or instant Vector`)
+
+	_, err = ng.NewRangeQuery(q, `metric`, time.Unix(0, 0), time.Unix(60, 0), 0)
+	require.EqualError(t, err, "zero or negative query resolution step widths are not accepted")
+
+	_, err = ng.NewRangeQuery(q, `metric`, time.Unix(60, 0), time.Unix(0, 0), time.Minute)
+	require.EqualError(t, err, "end timestamp must not be before start time")
+}
+
+func TestQueryLimits(t *testing.T) {
+	q := newTestStorage(t, time.Minute, `metric 0+1x100`)
+
+	ng := NewEngine(EngineOpts{MaxSamples: 10})
+	qry, err := ng.NewInstantQuery(q, `sum_over_time(metric[1h])`, time.Unix(6000, 0))
+	require.NoError(t, err)
+	res := qry.Exec(context.Background())
+	require.Equal(t, ErrTooManySamples("query execution"), res.Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	qry, err = NewEngine(EngineOpts{}).NewInstantQuery(q, `metric`, time.Unix(6000, 0))
+	require.NoError(t, err)
+	res = qry.Exec(ctx)
+	require.Equal(t, ErrQueryCanceled("expression evaluation"), res.Err)
+}
+
+func TestQueryStorageError(t *testing.T) {
+	storageErr := errors.New("storage unavailable")
+	q := storage.QueryableFunc(func(int64, int64) (storage.Querier, error) {
+		return nil, storageErr
+	})
+
+	qry, err := NewEngine(EngineOpts{}).NewInstantQuery(q, `sum(metric)`, time.Unix(0, 0))
+	require.NoError(t, err)
+	res := qry.Exec(context.Background())
+	require.ErrorIs(t, res.Err, storageErr)
+}
+
+// requireValuesEqual compares query results, treating NaN values as equal
+// and float values as equal within a small tolerance.
+func requireValuesEqual(t *testing.T, exp, got parser.Value) {
+	t.Helper()
+
+	switch exp := exp.(type) {
+	case Vector:
+		got, ok := got.(Vector)
+		require.True(t, ok, "expected Vector, got %T", got)
+		require.Len(t, got, len(exp), "got %s", got)
+		for i := range exp {
+			require.True(t, labels.Equal(exp[i].Metric, got[i].Metric), "expected %s, got %s", exp[i].Metric, got[i].Metric)
+			require.Equal(t, exp[i].T, got[i].T)
+			require.True(t, almostEqual(exp[i].F, got[i].F, 1e-9), "expected %v, got %v", exp[i].F, got[i].F)
+		}
+	case Matrix:
+		got, ok := got.(Matrix)
+		require.True(t, ok, "expected Matrix, got %T", got)
+		require.Len(t, got, len(exp), "got %s", got)
+		for i := range exp {
+			require.True(t, labels.Equal(exp[i].Metric, got[i].Metric), "expected %s, got %s", exp[i].Metric, got[i].Metric)
+			require.Len(t, got[i].Floats, len(exp[i].Floats), "got %s", got[i])
+			for j := range exp[i].Floats {
+				require.Equal(t, exp[i].Floats[j].T, got[i].Floats[j].T)
+				require.True(t, almostEqual(exp[i].Floats[j].F, got[i].Floats[j].F, 1e-9), "expected %v, got %v", exp[i].Floats[j].F, got[i].Floats[j].F)
+			}
+		}
+	default:
+		require.Equal(t, exp, got)
+	}
+}
@@ -0,0 +1,334 @@
+package promql
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/parser"
+)
+
+func TestFunctionList(t *testing.T) {
+	// Test that Functions and parser.Functions list the same functions.
+	for i := range FunctionCalls {
+		_, ok := parser.Functions[i]
+		require.True(t, ok, "function %s exists in promql package, but not in parser package", i)
+	}
+
+	for i := range parser.Functions {
+		_, ok := FunctionCalls[i]
+		require.True(t, ok, "function %s exists in parser package, but not in promql package", i)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`gauge 9 1 4 7 2 8 3 5 1 6 2`,
+		`requests 0 10 20 30 40 50 60 10 20 30 40`,
+		`val{i="a"} 0.5x10`,
+		`val{i="b"} -2x10`,
+		`val{i="c"} 4x10`,
+		`request_duration_bucket{le="0.1"} 0+10x10`,
+		`request_duration_bucket{le="0.5"} 0+50x10`,
+		`request_duration_bucket{le="+Inf"} 0+100x10`,
+	)
+	// Queries are evaluated at 10m, so range selectors [5m] see the samples
+	// at 6m..10m: gauge 3 5 1 6 2 and requests 60 10 20 30 40.
+
+	var (
+		empty = labels.EmptyLabels()
+		valA  = labels.FromStrings("i", "a")
+		valB  = labels.FromStrings("i", "b")
+		valC  = labels.FromStrings("i", "c")
+		ln2   = math.Ln2
+	)
+	vec := func(f float64) Vector { return Vector{{T: 600000, F: f, Metric: empty}} }
+	vals := func(a, b, c float64) Vector {
+		return Vector{{T: 600000, F: a, Metric: valA}, {T: 600000, F: b, Metric: valB}, {T: 600000, F: c, Metric: valC}}
+	}
+
+	cases := []instantQueryCase{
+		// Range vector functions.
+		{query: `avg_over_time(gauge[5m])`, res: vec(3.4)},
+		{query: `count_over_time(gauge[5m])`, res: vec(5)},
+		{query: `last_over_time(gauge[5m])`, res: Vector{{T: 600000, F: 2, Metric: labels.FromStrings("__name__", "gauge")}}},
+		{query: `max_over_time(gauge[5m])`, res: vec(6)},
+		{query: `min_over_time(gauge[5m])`, res: vec(1)},
+		{query: `sum_over_time(gauge[5m])`, res: vec(17)},
+		{query: `quantile_over_time(0.5, gauge[5m])`, res: vec(3)},
+		{query: `stdvar_over_time(gauge[5m])`, res: vec(3.44)},
+		{query: `stddev_over_time(gauge[5m])`, res: vec(math.Sqrt(3.44))},
+		{query: `present_over_time(gauge[5m])`, res: vec(1)},
+		{query: `absent_over_time(gauge[5m])`, res: Vector{}},
+		{query: `absent_over_time(nonexistent{job="x"}[5m])`, res: Vector{{T: 600000, F: 1, Metric: labels.FromStrings("job", "x")}}},
+		{query: `changes(gauge[5m])`, res: vec(4)},
+		{query: `resets(gauge[5m])`, res: vec(2)},
+		// The first sample is one interval after the range start, so the
+		// change is extrapolated by that interval: -1 * 300s / 240s.
+		{query: `delta(gauge[5m])`, res: vec(-1.25)},
+		{query: `idelta(gauge[5m])`, res: vec(-4)},
+		{query: `deriv(gauge[5m])`, res: vec(-1.0 / 600)},
+		{query: `predict_linear(gauge[5m], 60)`, res: vec(3.1)},
+		{query: `holt_winters(gauge[5m], 0.5, 0.5)`, res: vec(4.0625)},
+		// The counter reset from 60 to 10 adds 60, so the increase is 40,
+		// extrapolated to the full range.
+		{query: `increase(requests[5m])`, res: vec(50)},
+		{query: `rate(requests[5m])`, res: vec(50.0 / 300)},
+		{query: `irate(requests[5m])`, res: vec(10.0 / 60)},
+		{query: `resets(requests[5m])`, res: vec(1)},
+
+		// Instant vector functions.
+		{query: `abs(val)`, res: vals(0.5, 2, 4)},
+		{query: `ceil(val)`, res: vals(1, -2, 4)},
+		{query: `floor(val)`, res: vals(0, -2, 4)},
+		{query: `round(val)`, res: vals(1, -2, 4)},
+		{query: `round(vector(7), 5)`, res: vec(5)},
+		{query: `sgn(val)`, res: vals(1, -1, 1)},
+		{query: `clamp(val, 0, 1)`, res: vals(0.5, 0, 1)},
+		{query: `clamp(val, 1, 0)`, res: Vector{}},
+		{query: `clamp_max(val, 1)`, res: vals(0.5, -2, 1)},
+		{query: `clamp_min(val, 0)`, res: vals(0.5, 0, 4)},
+		{query: `exp(vector(2))`, res: vec(math.Exp(2))},
+		{query: `ln(exp(vector(2)))`, res: vec(2)},
+		{query: `sqrt(vector(16))`, res: vec(4)},
+		{query: `log2(vector(8))`, res: vec(3)},
+		{query: `log10(vector(1000))`, res: vec(3)},
+		{query: `sin(vector(pi() / 2))`, res: vec(1)},
+		{query: `cos(vector(pi()))`, res: vec(-1)},
+		{query: `tan(vector(pi() / 4))`, res: vec(1)},
+		{query: `asin(vector(1))`, res: vec(math.Pi / 2)},
+		{query: `acos(vector(-1))`, res: vec(math.Pi)},
+		{query: `atan(vector(1))`, res: vec(math.Pi / 4)},
+		{query: `sinh(vector(0.6931471805599453))`, res: vec(0.75)},
+		{query: `cosh(vector(0.6931471805599453))`, res: vec(1.25)},
+		{query: `tanh(vector(0.6931471805599453))`, res: vec(0.6)},
+		{query: `asinh(vector(0.75))`, res: vec(ln2)},
+		{query: `acosh(vector(1.25))`, res: vec(ln2)},
+		{query: `atanh(vector(0.6))`, res: vec(ln2)},
+		{query: `rad(vector(180))`, res: vec(math.Pi)},
+		{query: `deg(vector(pi()))`, res: vec(180)},
+		{query: `timestamp(gauge)`, res: vec(600)},
+		{
+			query:   `sort(val)`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: -2, Metric: labels.FromStrings("__name__", "val", "i", "b")},
+				{T: 600000, F: 0.5, Metric: labels.FromStrings("__name__", "val", "i", "a")},
+				{T: 600000, F: 4, Metric: labels.FromStrings("__name__", "val", "i", "c")},
+			},
+		},
+		{
+			query:   `sort_desc(val)`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: 4, Metric: labels.FromStrings("__name__", "val", "i", "c")},
+				{T: 600000, F: 0.5, Metric: labels.FromStrings("__name__", "val", "i", "a")},
+				{T: 600000, F: -2, Metric: labels.FromStrings("__name__", "val", "i", "b")},
+			},
+		},
+		{
+			query: `label_replace(val{i="a"}, "dst", "x-$1", "i", "(.*)")`,
+			res:   Vector{{T: 600000, F: 0.5, Metric: labels.FromStrings("__name__", "val", "dst", "x-a", "i", "a")}},
+		},
+		{
+			query: `label_replace(val{i="a"}, "dst", "x-$1", "i", "b")`,
+			res:   Vector{{T: 600000, F: 0.5, Metric: labels.FromStrings("__name__", "val", "i", "a")}},
+		},
+		{
+			query: `label_join(val{i="a"}, "dst", "-", "i", "__name__")`,
+			res:   Vector{{T: 600000, F: 0.5, Metric: labels.FromStrings("__name__", "val", "dst", "a-val", "i", "a")}},
+		},
+		{query: `absent(val)`, res: Vector{}},
+		{query: `absent(nonexistent{job="x", i=~".+"})`, res: Vector{{T: 600000, F: 1, Metric: labels.FromStrings("job", "x")}}},
+		{query: `histogram_quantile(0.3, request_duration_bucket)`, res: vec(0.3)},
+		// The histogram functions only read native histograms.
+		{query: `histogram_count(request_duration_bucket)`, res: Vector{}},
+		{query: `histogram_sum(request_duration_bucket)`, res: Vector{}},
+		{query: `histogram_fraction(0, 0.2, request_duration_bucket)`, res: Vector{}},
+		{query: `histogram_avg(request_duration_bucket)`, res: Vector{}},
+		{query: `histogram_stddev(request_duration_bucket)`, res: Vector{}},
+		{query: `histogram_stdvar(request_duration_bucket)`, res: Vector{}},
+
+		// Functions returning scalars.
+		{query: `time()`, res: Scalar{T: 600000, V: 600}},
+		{query: `pi()`, res: Scalar{T: 600000, V: math.Pi}},
+		{query: `scalar(val{i="a"})`, res: Scalar{T: 600000, V: 0.5}},
+		{query: `vector(scalar(val{i="c"}))`, res: vec(4)},
+
+		// Date functions, of the evaluation time or of the given timestamps.
+		// 1700000000 is Tuesday, 2023-11-14 22:13:20 UTC.
+		{query: `minute()`, res: vec(10)},
+		{query: `hour(vector(1700000000))`, res: vec(22)},
+		{query: `minute(vector(1700000000))`, res: vec(13)},
+		{query: `day_of_month(vector(1700000000))`, res: vec(14)},
+		{query: `day_of_week(vector(1700000000))`, res: vec(2)},
+		{query: `day_of_year(vector(1700000000))`, res: vec(318)},
+		{query: `days_in_month(vector(1700000000))`, res: vec(30)},
+		{query: `month(vector(1700000000))`, res: vec(11)},
+		{query: `year(vector(1700000000))`, res: vec(2023)},
+	}
+
+	testInstantQueries(t, NewEngine(EngineOpts{}), q, cases)
+
+	requireFunctionsTested(t, cases, false)
+}
+
+// requireFunctionsTested requires that the queries of cases call every
+// function which is experimental or not, as given.
+func requireFunctionsTested(t *testing.T, cases []instantQueryCase, experimental bool) {
+	t.Helper()
+	tested := map[string]bool{}
+	for _, c := range cases {
+		expr, err := parser.ParseExprWithOptions(c.query, parser.Options{EnableExperimentalFunctions: true})
+		require.NoError(t, err)
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			if call, ok := node.(*parser.Call); ok {
+				tested[call.Func.Name] = true
+			}
+			return nil
+		})
+	}
+	for name, f := range parser.Functions {
+		if f.Experimental == experimental {
+			require.True(t, tested[name], "function %s is not tested", name)
+		}
+	}
+}
+
+func TestExperimentalFunctions(t *testing.T) {
+	q := newTestStorage(t, time.Minute,
+		`http_requests{job="api", instance="0", group="production"} 0+10x10`,
+		`http_requests{job="api", instance="1", group="production"} 0+20x10`,
+		`http_requests{job="api", instance="10", group="canary"} 0+30x10`,
+		`http_requests{job="db", instance="0", group="production"} 0+50x10`,
+		`target_info{job="api", instance="0", version="1.0", region="eu"} 1x10`,
+		`build_info{job="api", instance="1", version="2.0"} 1x10`,
+		`counter 0 10 20 5 15`,
+	)
+	_, err := NewEngine(EngineOpts{}).NewInstantQuery(q, `info(counter)`, time.Unix(600, 0))
+	require.ErrorContains(t, err, "experimental")
+
+	ng := NewEngine(EngineOpts{EnableExperimentalFunctions: true})
+
+	cases := []instantQueryCase{
+		{
+			query: `limitk(1, http_requests) by (job)`,
+			res: Vector{
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+				{T: 600000, F: 500, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+			},
+		},
+		{
+			query: `limit_ratio(0, http_requests)`,
+			res:   Vector{},
+		},
+		{
+			// Ratios r and -(1-r) select complementary series.
+			query: `count(limit_ratio(0.3, http_requests) or limit_ratio(-0.7, http_requests))`,
+			res:   Vector{{T: 600000, F: 4, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `count(limit_ratio(0.3, http_requests) and limit_ratio(-0.7, http_requests))`,
+			res:   Vector{},
+		},
+		{
+			query: `mad_over_time(counter[5m])`,
+			ts:    time.Unix(240, 0),
+			res:   Vector{{T: 240000, F: 5, Metric: labels.EmptyLabels()}},
+		},
+		{
+			query: `double_exponential_smoothing(http_requests{job="db"}[5m], 0.5, 0.5)`,
+			res:   Vector{{T: 600000, F: 500, Metric: labels.FromStrings("group", "production", "instance", "0", "job", "db")}},
+		},
+		{
+			query:   `sort_by_label(http_requests{job="api"}, "instance")`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api")},
+				{T: 600000, F: 200, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api")},
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+			},
+		},
+		{
+			query:   `sort_by_label_desc(http_requests, "job", "group")`,
+			ordered: true,
+			res: Vector{
+				{T: 600000, F: 500, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "db")},
+				{T: 600000, F: 200, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api")},
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api")},
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+			},
+		},
+		{
+			query: `info(http_requests{job="api"})`,
+			res: Vector{
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api", "region", "eu", "version", "1.0")},
+				{T: 600000, F: 200, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api")},
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+			},
+		},
+		{
+			query: `info(http_requests{job="api"}, {region=~".+"})`,
+			res: Vector{
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api", "region", "eu")},
+			},
+		},
+		{
+			query: `info(http_requests{job="api"}, build_info)`,
+			res: Vector{
+				{T: 600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api")},
+				{T: 600000, F: 200, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api", "version", "2.0")},
+				{T: 600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+			},
+		},
+		{
+			// The info series are selected at the time of the samples, which
+			// is outside of the time range of the query.
+			query: `info(http_requests{job="api"} offset 50m)`,
+			ts:    time.Unix(3600, 0),
+			res: Vector{
+				{T: 3600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api", "region", "eu", "version", "1.0")},
+				{T: 3600000, F: 200, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "1", "job", "api")},
+				{T: 3600000, F: 300, Metric: labels.FromStrings("__name__", "http_requests", "group", "canary", "instance", "10", "job", "api")},
+			},
+		},
+		{
+			query: `info(http_requests{job="api", instance="0"} @ 600, {region=~".+"})`,
+			ts:    time.Unix(3600, 0),
+			res: Vector{
+				{T: 3600000, F: 100, Metric: labels.FromStrings("__name__", "http_requests", "group", "production", "instance", "0", "job", "api", "region", "eu")},
+			},
+		},
+		{
+			// The first argument has no selector to read samples for.
+			query: `info(label_replace(label_replace(vector(1), "job", "api", "", ""), "instance", "0", "", ""))`,
+			res: Vector{
+				{T: 600000, F: 1, Metric: labels.FromStrings("instance", "0", "job", "api", "region", "eu", "version", "1.0")},
+			},
+		},
+	}
+	testInstantQueries(t, ng, q, cases)
+	requireFunctionsTested(t, cases, true)
+}
+
+func TestNaturalLess(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		less bool
+	}{
+		{"a", "b", true},
+		{"b", "a", false},
+		{"a", "a", false},
+		{"a9", "a10", true},
+		{"a10", "a9", false},
+		{"a01", "a2", true},
+		{"a", "a1", true},
+		{"1.10", "1.9", false},
+		{"x10y2", "x10y10", true},
+	} {
+		require.Equal(t, c.less, naturalLess(c.a, c.b), "%q < %q", c.a, c.b)
+	}
+}
@@ -0,0 +1,202 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/parser"
+)
+
+func (Matrix) Type() parser.ValueType { return parser.ValueTypeMatrix }
+func (Vector) Type() parser.ValueType { return parser.ValueTypeVector }
+func (Scalar) Type() parser.ValueType { return parser.ValueTypeScalar }
+func (String) Type() parser.ValueType { return parser.ValueTypeString }
+
+// String represents a string value.
+type String struct {
+	T int64
+	V string
+}
+
+func (s String) String() string {
+	return s.V
+}
+
+// Scalar is a data point that's explicitly not associated with a metric.
+type Scalar struct {
+	T int64
+	V float64
+}
+
+func (s Scalar) String() string {
+	v := strconv.FormatFloat(s.V, 'f', -1, 64)
+	return fmt.Sprintf("scalar: %v @[%v]", v, s.T)
+}
+
+// FPoint represents a single float data point for a given timestamp.
+type FPoint struct {
+	T int64
+	F float64
+}
+
+func (p FPoint) String() string {
+	return fmt.Sprintf("%s @[%v]", strconv.FormatFloat(p.F, 'f', -1, 64), p.T)
+}
+
+// Series is a stream of data points belonging to a metric.
+type Series struct {
+	Metric labels.Labels
+	Floats []FPoint
+}
+
+func (s Series) String() string {
+	vals := make([]string, len(s.Floats))
+	for i, p := range s.Floats {
+		vals[i] = p.String()
+	}
+	return fmt.Sprintf("%s =>\n%s", s.Metric, strings.Join(vals, "\n"))
+}
+
+// Sample is a single sample belonging to a metric.
+type Sample struct {
+	T int64
+	F float64
+
+	Metric labels.Labels
+}
+
+func (s Sample) String() string {
+	return fmt.Sprintf("%s => %s", s.Metric, FPoint{T: s.T, F: s.F})
+}
+
+// Vector is basically only an alias for []Sample, but the contract is that
+// in a Vector, all Samples have the same timestamp.
+type Vector []Sample
+
+func (vec Vector) String() string {
+	entries := make([]string, len(vec))
+	for i, s := range vec {
+		entries[i] = s.String()
+	}
+	return strings.Join(entries, "\n")
+}
+
+// ContainsSameLabelset checks if a vector has samples with the same labelset.
+// Such a behavior is semantically undefined.
+func (vec Vector) ContainsSameLabelset() bool {
+	if len(vec) < 2 {
+		return false
+	}
+	seen := make(map[uint64]struct{}, len(vec))
+	for _, s := range vec {
+		hash := s.Metric.Hash()
+		if _, ok := seen[hash]; ok {
+			return true
+		}
+		seen[hash] = struct{}{}
+	}
+	return false
+}
+
+// Matrix is a slice of Series that implements sort.Interface and
+// has a String method.
+type Matrix []Series
+
+func (m Matrix) String() string {
+	strs := make([]string, len(m))
+	for i, ss := range m {
+		strs[i] = ss.String()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// TotalSamples returns the total number of samples in the series within a matrix.
+func (m Matrix) TotalSamples() int {
+	numSamples := 0
+	for _, series := range m {
+		numSamples += len(series.Floats)
+	}
+	return numSamples
+}
+
+func (m Matrix) Len() int           { return len(m) }
+func (m Matrix) Less(i, j int) bool { return labels.Compare(m[i].Metric, m[j].Metric) < 0 }
+func (m Matrix) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// ContainsSameLabelset checks if a matrix has samples with the same labelset.
+// Such a behavior is semantically undefined.
+func (m Matrix) ContainsSameLabelset() bool {
+	if len(m) < 2 {
+		return false
+	}
+	seen := make(map[uint64]struct{}, len(m))
+	for _, s := range m {
+		hash := s.Metric.Hash()
+		if _, ok := seen[hash]; ok {
+			return true
+		}
+		seen[hash] = struct{}{}
+	}
+	return false
+}
+
+// Result holds the resulting value of an execution or an error
+// if any occurred.
+type Result struct {
+	Err      error
+	Value    parser.Value
+	Warnings storage.Warnings
+}
+
+// Vector returns a Vector if the result value is one. An error is returned if
+// the result was an error or the result value is not a Vector.
+func (r *Result) Vector() (Vector, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	v, ok := r.Value.(Vector)
+	if !ok {
+		return nil, errors.New("query result is not a Vector")
+	}
+	return v, nil
+}
+
+// Matrix returns a Matrix. An error is returned if
+// the result was an error or the result value is not a Matrix.
+func (r *Result) Matrix() (Matrix, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	v, ok := r.Value.(Matrix)
+	if !ok {
+		return nil, errors.New("query result is not a range Vector")
+	}
+	return v, nil
+}
+
+// Scalar returns a Scalar value. An error is returned if
+// the result was an error or the result value is not a Scalar.
+func (r *Result) Scalar() (Scalar, error) {
+	if r.Err != nil {
+		return Scalar{}, r.Err
+	}
+	v, ok := r.Value.(Scalar)
+	if !ok {
+		return Scalar{}, errors.New("query result is not a Scalar")
+	}
+	return v, nil
+}
+
+func (r *Result) String() string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	if r.Value == nil {
+		return ""
+	}
+	return r.Value.String()
+}
@@ -0,0 +1,309 @@
+package remote
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+)
+
+// encXOR is the chunk encoding of float samples in the remote read protocol.
+const encXOR = 1
+
+// chunk is a chunk of samples as sent in streamed remote read responses.
+type chunk struct {
+	minTime, maxTime int64
+	encoding         int
+	data             []byte
+}
+
+// bitReader reads a byte slice bit by bit, most significant bit first.
+type bitReader struct {
+	b   []byte
+	pos uint
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.b))*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.b[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n uint8) (uint64, error) {
+	var v uint64
+	for i := uint8(0); i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// ReadByte implements io.ByteReader so that varints can be read from the stream.
+func (r *bitReader) ReadByte() (byte, error) {
+	v, err := r.readBits(8)
+	return byte(v), err
+}
+
+// xorIterator decodes a Gorilla-style XOR chunk as written by the
+// Prometheus TSDB. See tsdb/chunkenc/xor.go of Prometheus.
+type xorIterator struct {
+	br       bitReader
+	numTotal uint16
+	numRead  uint16
+
+	t      int64
+	val    float64
+	tDelta uint64
+
+	leading  uint8
+	trailing uint8
+
+	err error
+}
+
+func newXORIterator(b []byte) *xorIterator {
+	it := &xorIterator{}
+	if len(b) < 2 {
+		it.err = fmt.Errorf("invalid XOR chunk of %d bytes", len(b))
+		return it
+	}
+	it.numTotal = binary.BigEndian.Uint16(b)
+	it.br = bitReader{b: b[2:]}
+	return it
+}
+
+func (it *xorIterator) At() (int64, float64) { return it.t, it.val }
+
+func (it *xorIterator) AtT() int64 { return it.t }
+
+func (it *xorIterator) Err() error { return it.err }
+
+func (it *xorIterator) Next() storage.ValueType {
+	if it.err != nil || it.numRead == it.numTotal {
+		return storage.ValNone
+	}
+
+	switch it.numRead {
+	case 0:
+		t, err := binary.ReadVarint(&it.br)
+		if err != nil {
+			return it.fail(err)
+		}
+		v, err := it.br.readBits(64)
+		if err != nil {
+			return it.fail(err)
+		}
+		it.t = t
+		it.val = math.Float64frombits(v)
+	case 1:
+		tDelta, err := binary.ReadUvarint(&it.br)
+		if err != nil {
+			return it.fail(err)
+		}
+		it.tDelta = tDelta
+		it.t += int64(it.tDelta)
+		if err := it.readValue(); err != nil {
+			return it.fail(err)
+		}
+	default:
+		// Read the prefix of the delta-of-delta, one of 0, 10, 110, 1110 and 1111.
+		var d byte
+		for i := 0; i < 4; i++ {
+			d <<= 1
+			bit, err := it.br.readBit()
+			if err != nil {
+				return it.fail(err)
+			}
+			if !bit {
+				break
+			}
+			d |= 1
+		}
+
+		var sz uint8
+		var dod int64
+		switch d {
+		case 0b0:
+			// dod == 0
+		case 0b10:
+			sz = 14
+		case 0b110:
+			sz = 17
+		case 0b1110:
+			sz = 20
+		case 0b1111:
+			bits, err := it.br.readBits(64)
+			if err != nil {
+				return it.fail(err)
+			}
+			dod = int64(bits)
+		}
+
+		if sz != 0 {
+			bits, err := it.br.readBits(sz)
+			if err != nil {
+				return it.fail(err)
+			}
+			// Account for negative numbers, which come back as high unsigned numbers.
+			if bits > (1 << (sz - 1)) {
+				bits -= 1 << sz
+			}
+			dod = int64(bits)
+		}
+
+		it.tDelta = uint64(int64(it.tDelta) + dod)
+		it.t += int64(it.tDelta)
+		if err := it.readValue(); err != nil {
+			return it.fail(err)
+		}
+	}
+
+	it.numRead++
+	return storage.ValFloat
+}
+
+func (it *xorIterator) readValue() error {
+	bit, err := it.br.readBit()
+	if err != nil {
+		return err
+	}
+	if !bit {
+		// The value did not change.
+		return nil
+	}
+
+	bit, err = it.br.readBit()
+	if err != nil {
+		return err
+	}
+	if bit {
+		// New leading and trailing zeros, otherwise reuse the previous ones.
+		bits, err := it.br.readBits(5)
+		if err != nil {
+			return err
+		}
+		it.leading = uint8(bits)
+
+		bits, err = it.br.readBits(6)
+		if err != nil {
+			return err
+		}
+		mbits := uint8(bits)
+		// 0 significant bits here means we overflowed and we actually need 64.
+		if mbits == 0 {
+			mbits = 64
+		}
+		it.trailing = 64 - it.leading - mbits
+	}
+
+	mbits := 64 - it.leading - it.trailing
+	bits, err := it.br.readBits(mbits)
+	if err != nil {
+		return err
+	}
+	vbits := math.Float64bits(it.val)
+	vbits ^= bits << it.trailing
+	it.val = math.Float64frombits(vbits)
+	return nil
+}
+
+func (it *xorIterator) fail(err error) storage.ValueType {
+	it.err = fmt.Errorf("corrupted XOR chunk: %w", err)
+	return storage.ValNone
+}
+
+// chunkedSeries is a series of a streamed remote read response.
+type chunkedSeries struct {
+	labels     labels.Labels
+	chunks     []chunk
+	mint, maxt int64
+}
+
+func (s *chunkedSeries) Labels() labels.Labels { return s.labels }
+
+func (s *chunkedSeries) Iterator() storage.Iterator {
+	return &chunkedSeriesIterator{chunks: s.chunks, idx: -1, mint: s.mint, maxt: s.maxt}
+}
+
+// chunkedSeriesIterator iterates over the samples of consecutive chunks,
+// leaving out the samples outside of the queried time range.
+type chunkedSeriesIterator struct {
+	chunks     []chunk
+	idx        int
+	cur        *xorIterator
+	mint, maxt int64
+	// Set if the iterator is positioned at a sample.
+	valid bool
+	err   error
+}
+
+func (it *chunkedSeriesIterator) Next() storage.ValueType {
+	it.valid = false
+	for it.err == nil {
+		if it.cur == nil {
+			it.idx++
+			if it.idx >= len(it.chunks) {
+				return storage.ValNone
+			}
+			c := it.chunks[it.idx]
+			if c.maxTime < it.mint {
+				continue
+			}
+			if c.encoding != encXOR {
+				it.err = fmt.Errorf("unsupported chunk encoding %d", c.encoding)
+				return storage.ValNone
+			}
+			it.cur = newXORIterator(c.data)
+		}
+
+		if it.cur.Next() == storage.ValNone {
+			if err := it.cur.Err(); err != nil {
+				it.err = err
+				return storage.ValNone
+			}
+			it.cur = nil
+			continue
+		}
+		t := it.cur.AtT()
+		if t < it.mint {
+			continue
+		}
+		if t > it.maxt {
+			it.cur, it.idx = nil, len(it.chunks)
+			return storage.ValNone
+		}
+		it.valid = true
+		return storage.ValFloat
+	}
+	return storage.ValNone
+}
+
+func (it *chunkedSeriesIterator) SeekTo(t int64) storage.ValueType {
+	if it.valid && it.cur.AtT() >= t {
+		return storage.ValFloat
+	}
+	for it.Next() == storage.ValFloat {
+		if it.cur.AtT() >= t {
+			return storage.ValFloat
+		}
+	}
+	return storage.ValNone
+}
+
+func (it *chunkedSeriesIterator) At() (int64, float64) { return it.cur.At() }
+
+func (it *chunkedSeriesIterator) AtT() int64 { return it.cur.AtT() }
+
+func (it *chunkedSeriesIterator) Err() error { return it.err }
@@ -0,0 +1,424 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+)
+
+const (
+	defaultReadPath = "/api/v1/read"
+
+	remoteReadVersion = "0.1.0"
+
+	// Response types of the remote read protocol.
+	responseTypeSamples           = 0
+	responseTypeStreamedXORChunks = 1
+
+	// The maximum size of a single frame of a streamed response.
+	maxFrameSize = 50 * 1024 * 1024
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ReadConfig configures a Reader.
+type ReadConfig struct {
+	// The path of the remote read endpoint relative to the client address,
+	// "/api/v1/read" if empty.
+	Path string
+
+	// SamplesOnly disables streamed XOR chunks, which are otherwise preferred
+	// if the server supports them.
+	SamplesOnly bool
+}
+
+// Reader reads raw samples from a remote read endpoint.
+//
+// It is safe to use a Reader from multiple goroutines.
+type Reader struct {
+	client prometheus.Client
+	cfg    ReadConfig
+}
+
+// NewReader returns a Reader sending through the given client, so that the
+// authentication and TLS settings of its prometheus.Config apply.
+func NewReader(client prometheus.Client, cfg ReadConfig) *Reader {
+	if cfg.Path == "" {
+		cfg.Path = defaultReadPath
+	}
+	return &Reader{client: client, cfg: cfg}
+}
+
+// Read returns the series matching all of the given matchers together with
+// their samples between mint and maxt, both inclusive and in milliseconds.
+//
+// Streamed responses are decoded while the returned set is iterated. The set
+// must be iterated until Next returns false, or ctx be canceled, to release
+// the connection.
+func (r *Reader) Read(ctx context.Context, mint, maxt int64, matchers ...*labels.Matcher) (storage.SeriesSet, error) {
+	header := http.Header{}
+	header.Set("Content-Encoding", "snappy")
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("X-Prometheus-Remote-Read-Version", remoteReadVersion)
+
+	req := encodeReadRequest(nil, mint, maxt, matchers, !r.cfg.SamplesOnly)
+	resp, err := r.client.Raw(ctx, prometheus.RawRequest{
+		Method: http.MethodPost,
+		Path:   r.cfg.Path,
+		Header: header,
+		Body:   bytes.NewReader(snappy.Encode(nil, req)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		// Only show the first line of the error message.
+		line, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		return nil, fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-streamed-protobuf") {
+		return &streamedSeriesSet{
+			body: resp.Body,
+			r:    bufio.NewReader(resp.Body),
+			mint: mint,
+			maxt: maxt,
+		}, nil
+	}
+
+	defer resp.Body.Close()
+	compressed, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress response: %w", err)
+	}
+	series, err := decodeReadResponse(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode response: %w", err)
+	}
+	return storage.NewListSeriesSet(series, nil), nil
+}
+
+// streamedSeriesSet decodes the frames of a streamed response one at a time.
+type streamedSeriesSet struct {
+	body       io.ReadCloser
+	r          *bufio.Reader
+	mint, maxt int64
+
+	queue []*chunkedSeries
+	cur   *chunkedSeries
+	err   error
+	done  bool
+}
+
+func (s *streamedSeriesSet) Next() bool {
+	if len(s.queue) == 0 && !s.readFrame() {
+		return false
+	}
+	cur := s.queue[0]
+	s.queue = s.queue[1:]
+
+	// The chunks of a series may be split across frames.
+	for len(s.queue) == 0 && s.readFrame() {
+		next := s.queue[0]
+		if !labels.Equal(next.labels, cur.labels) {
+			break
+		}
+		cur.chunks = append(cur.chunks, next.chunks...)
+		s.queue = s.queue[1:]
+	}
+	if s.err != nil {
+		return false
+	}
+	s.cur = cur
+	return true
+}
+
+func (s *streamedSeriesSet) At() storage.Series { return s.cur }
+
+func (s *streamedSeriesSet) Err() error { return s.err }
+
+func (s *streamedSeriesSet) Warnings() storage.Warnings { return nil }
+
+// readFrame appends the series of the next frame to the queue. It returns
+// false and releases the body once the stream is exhausted or failed.
+func (s *streamedSeriesSet) readFrame() bool {
+	if s.done {
+		return false
+	}
+	for {
+		series, err := s.nextFrame()
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			s.done = true
+			s.body.Close()
+			return false
+		}
+		if len(series) > 0 {
+			s.queue = append(s.queue, series...)
+			return true
+		}
+	}
+}
+
+func (s *streamedSeriesSet) nextFrame() ([]*chunkedSeries, error) {
+	size, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d bytes", size, maxFrameSize)
+	}
+
+	var crc [4]byte
+	if _, err := io.ReadFull(s.r, crc[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(s.r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if crc32.Checksum(b, castagnoliTable) != binary.BigEndian.Uint32(crc[:]) {
+		return nil, fmt.Errorf("frame checksum mismatch")
+	}
+
+	series, err := decodeChunkedReadResponse(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode frame: %w", err)
+	}
+	for _, cs := range series {
+		cs.mint, cs.maxt = s.mint, s.maxt
+	}
+	return series, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// encodeReadRequest appends the protobuf encoding of a prometheus.ReadRequest
+// with a single query to buf.
+func encodeReadRequest(buf []byte, mint, maxt int64, matchers []*labels.Matcher, streamed bool) []byte {
+	var q, m []byte
+	q = protowire.AppendTag(q, 1, protowire.VarintType)
+	q = protowire.AppendVarint(q, uint64(mint))
+	q = protowire.AppendTag(q, 2, protowire.VarintType)
+	q = protowire.AppendVarint(q, uint64(maxt))
+	for _, matcher := range matchers {
+		m = m[:0]
+		m = protowire.AppendTag(m, 1, protowire.VarintType)
+		m = protowire.AppendVarint(m, uint64(matcher.Type))
+		m = protowire.AppendTag(m, 2, protowire.BytesType)
+		m = protowire.AppendString(m, matcher.Name)
+		m = protowire.AppendTag(m, 3, protowire.BytesType)
+		m = protowire.AppendString(m, matcher.Value)
+
+		q = protowire.AppendTag(q, 3, protowire.BytesType)
+		q = protowire.AppendBytes(q, m)
+	}
+
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, q)
+
+	// The accepted response types, in order of preference.
+	if streamed {
+		buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, responseTypeStreamedXORChunks)
+	}
+	buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, responseTypeSamples)
+	return buf
+}
+
+// field is a single decoded field of a protobuf message.
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value uint64
+	bytes []byte
+}
+
+// parseFields calls f for every field of the protobuf message b.
+func parseFields(b []byte, f func(fd field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		fd := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			fd.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			fd.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			fd.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := f(fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeReadResponse decodes the series of the first result of a prometheus.ReadResponse.
+func decodeReadResponse(b []byte) ([]storage.Series, error) {
+	var (
+		series []storage.Series
+		seen   bool
+	)
+	err := parseFields(b, func(result field) error {
+		if result.num != 1 || seen {
+			return nil
+		}
+		seen = true
+		return parseFields(result.bytes, func(fd field) error {
+			if fd.num != 1 {
+				return nil
+			}
+			lset, samples, err := decodeTimeSeries(fd.bytes)
+			if err != nil {
+				return err
+			}
+			series = append(series, storage.NewListSeries(lset, samples))
+			return nil
+		})
+	})
+	return series, err
+}
+
+// decodeTimeSeries decodes a prometheus.TimeSeries.
+func decodeTimeSeries(b []byte) (labels.Labels, []Sample, error) {
+	var (
+		lb      = labels.NewScratchBuilder(0)
+		samples []Sample
+	)
+	err := parseFields(b, func(fd field) error {
+		switch fd.num {
+		case 1:
+			name, value, err := decodeLabel(fd.bytes)
+			if err != nil {
+				return err
+			}
+			lb.Add(name, value)
+		case 2:
+			var s Sample
+			err := parseFields(fd.bytes, func(sf field) error {
+				switch sf.num {
+				case 1:
+					s.Value = math.Float64frombits(sf.value)
+				case 2:
+					s.Timestamp = int64(sf.value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			samples = append(samples, s)
+		}
+		return nil
+	})
+	lb.Sort()
+	return lb.Labels(), samples, err
+}
+
+// decodeLabel decodes a prometheus.Label.
+func decodeLabel(b []byte) (name, value string, err error) {
+	err = parseFields(b, func(fd field) error {
+		switch fd.num {
+		case 1:
+			name = string(fd.bytes)
+		case 2:
+			value = string(fd.bytes)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+// decodeChunkedReadResponse decodes the series of a prometheus.ChunkedReadResponse.
+func decodeChunkedReadResponse(b []byte) ([]*chunkedSeries, error) {
+	var series []*chunkedSeries
+	err := parseFields(b, func(cs field) error {
+		if cs.num != 1 {
+			return nil
+		}
+		s := &chunkedSeries{}
+		lb := labels.NewScratchBuilder(0)
+		err := parseFields(cs.bytes, func(fd field) error {
+			switch fd.num {
+			case 1:
+				name, value, err := decodeLabel(fd.bytes)
+				if err != nil {
+					return err
+				}
+				lb.Add(name, value)
+			case 2:
+				var c chunk
+				err := parseFields(fd.bytes, func(cf field) error {
+					switch cf.num {
+					case 1:
+						c.minTime = int64(cf.value)
+					case 2:
+						c.maxTime = int64(cf.value)
+					case 3:
+						c.encoding = int(cf.value)
+					case 4:
+						c.data = cf.bytes
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				s.chunks = append(s.chunks, c)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		lb.Sort()
+		s.labels = lb.Labels()
+		series = append(series, s)
+		return nil
+	})
+	return series, err
+}
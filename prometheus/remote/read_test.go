@@ -0,0 +1,358 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+)
+
+// bitWriter is the counterpart of bitReader.
+type bitWriter struct {
+	b   []byte
+	pos uint
+}
+
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v&(1<<uint(i)) != 0 {
+			w.b[len(w.b)-1] |= 0x80 >> (w.pos % 8)
+		}
+		w.pos++
+	}
+}
+
+func (w *bitWriter) writeBytes(b []byte) {
+	for _, c := range b {
+		w.writeBits(uint64(c), 8)
+	}
+}
+
+// encodeXOR encodes samples as XOR chunk the way Prometheus does. It uses
+// the narrowest encoding of the delta-of-delta of the timestamps and reuses
+// the leading and trailing zeros of the previous value where possible.
+func encodeXOR(samples []Sample) []byte {
+	w := &bitWriter{}
+	w.writeBits(uint64(len(samples)), 16)
+
+	var (
+		tDelta   int64
+		leading  = -1
+		trailing int
+	)
+	for i, s := range samples {
+		switch i {
+		case 0:
+			w.writeBytes(binary.AppendVarint(nil, s.Timestamp))
+			w.writeBits(math.Float64bits(s.Value), 64)
+			continue
+		case 1:
+			tDelta = s.Timestamp - samples[0].Timestamp
+			w.writeBytes(binary.AppendUvarint(nil, uint64(tDelta)))
+		default:
+			d := s.Timestamp - samples[i-1].Timestamp
+			dod := d - tDelta
+			switch {
+			case dod == 0:
+				w.writeBits(0, 1)
+			case fitsBits(dod, 14):
+				w.writeBits(0b10, 2)
+				w.writeBits(uint64(dod), 14)
+			case fitsBits(dod, 17):
+				w.writeBits(0b110, 3)
+				w.writeBits(uint64(dod), 17)
+			case fitsBits(dod, 20):
+				w.writeBits(0b1110, 4)
+				w.writeBits(uint64(dod), 20)
+			default:
+				w.writeBits(0b1111, 4)
+				w.writeBits(uint64(dod), 64)
+			}
+			tDelta = d
+		}
+
+		xor := math.Float64bits(s.Value) ^ math.Float64bits(samples[i-1].Value)
+		if xor == 0 {
+			w.writeBits(0, 1)
+			continue
+		}
+		l := bits.LeadingZeros64(xor)
+		if l > 31 {
+			l = 31
+		}
+		t := bits.TrailingZeros64(xor)
+		if leading >= 0 && l >= leading && t >= trailing {
+			w.writeBits(0b10, 2)
+			w.writeBits(xor>>uint(trailing), 64-leading-trailing)
+			continue
+		}
+		leading, trailing = l, t
+		sigbits := 64 - leading - trailing
+		w.writeBits(0b11, 2)
+		w.writeBits(uint64(leading), 5)
+		w.writeBits(uint64(sigbits), 6)
+		w.writeBits(xor>>uint(trailing), sigbits)
+	}
+	return w.b
+}
+
+// fitsBits reports whether dod fits into the n bit encoding of the delta-of-delta.
+func fitsBits(dod int64, n uint) bool {
+	return -(1<<(n-1))+1 <= dod && dod <= 1<<(n-1)
+}
+
+func appendLabels(buf []byte, ls labels.Labels) []byte {
+	ls.Range(func(l labels.Label) {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, l.Name)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, l.Value)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, b)
+	})
+	return buf
+}
+
+// appendFrame appends a ChunkedReadResponse with a single series.
+func appendFrame(buf []byte, ls labels.Labels, samples ...[]Sample) []byte {
+	cs := appendLabels(nil, ls)
+	for _, s := range samples {
+		var c []byte
+		c = protowire.AppendTag(c, 1, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(s[0].Timestamp))
+		c = protowire.AppendTag(c, 2, protowire.VarintType)
+		c = protowire.AppendVarint(c, uint64(s[len(s)-1].Timestamp))
+		c = protowire.AppendTag(c, 3, protowire.VarintType)
+		c = protowire.AppendVarint(c, encXOR)
+		c = protowire.AppendTag(c, 4, protowire.BytesType)
+		c = protowire.AppendBytes(c, encodeXOR(s))
+		cs = protowire.AppendTag(cs, 2, protowire.BytesType)
+		cs = protowire.AppendBytes(cs, c)
+	}
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, cs)
+
+	buf = binary.AppendUvarint(buf, uint64(len(msg)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(msg, castagnoliTable))
+	return append(buf, msg...)
+}
+
+type readRequest struct {
+	mint, maxt int64
+	matchers   []*labels.Matcher
+	types      []uint64
+}
+
+func decodeReadRequest(t *testing.T, r *http.Request) readRequest {
+	compressed, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	b, err := snappy.Decode(nil, compressed)
+	require.NoError(t, err)
+
+	var req readRequest
+	err = parseFields(b, func(fd field) error {
+		if fd.num == 2 {
+			req.types = append(req.types, fd.value)
+			return nil
+		}
+		return parseFields(fd.bytes, func(qf field) error {
+			switch qf.num {
+			case 1:
+				req.mint = int64(qf.value)
+			case 2:
+				req.maxt = int64(qf.value)
+			case 3:
+				m := &labels.Matcher{}
+				err := parseFields(qf.bytes, func(mf field) error {
+					switch mf.num {
+					case 1:
+						m.Type = labels.MatchType(mf.value)
+					case 2:
+						m.Name = string(mf.bytes)
+					case 3:
+						m.Value = string(mf.bytes)
+					}
+					return nil
+				})
+				req.matchers = append(req.matchers, m)
+				return err
+			}
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	return req
+}
+
+func readAll(t *testing.T, ss storage.SeriesSet) []timeSeries {
+	var res []timeSeries
+	for ss.Next() {
+		s := timeSeries{labels: ss.At().Labels()}
+		it := ss.At().Iterator()
+		for it.Next() == storage.ValFloat {
+			ts, v := it.At()
+			s.samples = append(s.samples, Sample{Timestamp: ts, Value: v})
+		}
+		require.NoError(t, it.Err())
+		res = append(res, s)
+	}
+	require.NoError(t, ss.Err())
+	return res
+}
+
+func newTestReader(t *testing.T, h http.HandlerFunc, cfg ReadConfig) *Reader {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	client, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return NewReader(client, cfg)
+}
+
+func TestXORIterator(t *testing.T) {
+	// The delta-of-delta of the timestamps starts at the third sample. They
+	// cover the boundaries of every encoding width.
+	dods := []int64{
+		0, 1, -1,
+		8192, -8191, // 14 bits
+		8193, -8192, 65536, -65535, // 17 bits
+		65537, -65536, 524288, -524287, // 20 bits
+		524289, -524288, 1 << 40, -(1 << 40), // 64 bits
+	}
+	values := []float64{
+		1, 1, 2, 2.5, 2.5, 3, -3, 1e300, math.Float64frombits(^math.Float64bits(1)),
+		0, 0.1, 0.2, 0.3, math.Inf(1), math.Inf(-1), 42, 42, 1, 7,
+	}
+
+	samples := []Sample{{Timestamp: 1700000000000, Value: values[0]}, {Timestamp: 1700000015000, Value: values[1]}}
+	delta := int64(15000)
+	for i, dod := range dods {
+		delta += dod
+		samples = append(samples, Sample{Timestamp: samples[len(samples)-1].Timestamp + delta, Value: values[i+2]})
+	}
+
+	it := newXORIterator(encodeXOR(samples))
+	var got []Sample
+	for it.Next() == storage.ValFloat {
+		ts, v := it.At()
+		got = append(got, Sample{Timestamp: ts, Value: v})
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, samples, got)
+}
+
+func TestXORIteratorTruncated(t *testing.T) {
+	samples := []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}, {Timestamp: 3500, Value: 3}}
+	b := encodeXOR(samples)
+
+	it := newXORIterator(b[:len(b)-2])
+	for it.Next() == storage.ValFloat {
+	}
+	require.ErrorContains(t, it.Err(), "corrupted XOR chunk")
+
+	it = newXORIterator(b[:1])
+	require.Equal(t, storage.ValNone, it.Next())
+	require.ErrorContains(t, it.Err(), "invalid XOR chunk")
+}
+
+func TestReadSamples(t *testing.T) {
+	up := labels.FromStrings("__name__", "up", "job", "a")
+	r := newTestReader(t, func(w http.ResponseWriter, r *http.Request) {
+		req := decodeReadRequest(t, r)
+		require.Equal(t, "/api/v1/read", r.URL.Path)
+		require.Equal(t, int64(1000), req.mint)
+		require.Equal(t, int64(5000), req.maxt)
+		require.Equal(t, []uint64{responseTypeSamples}, req.types)
+		require.Len(t, req.matchers, 2)
+		require.Equal(t, labels.MatchRegexp, req.matchers[1].Type)
+		require.Equal(t, "job", req.matchers[1].Name)
+		require.Equal(t, "a|b", req.matchers[1].Value)
+
+		ts := encodeTimeSeries(nil, timeSeries{labels: up, samples: []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}}})
+		var result, resp []byte
+		result = protowire.AppendTag(result, 1, protowire.BytesType)
+		result = protowire.AppendBytes(result, ts)
+		resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+		resp = protowire.AppendBytes(resp, result)
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(snappy.Encode(nil, resp))
+	}, ReadConfig{SamplesOnly: true})
+
+	ss, err := r.Read(context.Background(), 1000, 5000,
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"),
+		labels.MustNewMatcher(labels.MatchRegexp, "job", "a|b"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []timeSeries{
+		{labels: up, samples: []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}}},
+	}, readAll(t, ss))
+}
+
+func TestReadStreamed(t *testing.T) {
+	a := labels.FromStrings("__name__", "up", "job", "a")
+	b := labels.FromStrings("__name__", "up", "job", "b")
+	r := newTestReader(t, func(w http.ResponseWriter, r *http.Request) {
+		req := decodeReadRequest(t, r)
+		require.Equal(t, []uint64{responseTypeStreamedXORChunks, responseTypeSamples}, req.types)
+
+		var buf []byte
+		// The samples of series a span two frames, the first and last
+		// samples are outside of the requested range.
+		buf = appendFrame(buf, a, []Sample{{Timestamp: 500, Value: 1}, {Timestamp: 1000, Value: 2}, {Timestamp: 2000, Value: 2.5}})
+		buf = appendFrame(buf, a, []Sample{{Timestamp: 3000, Value: -1}, {Timestamp: 4500, Value: 1e10}, {Timestamp: 6000, Value: 3}})
+		buf = appendFrame(buf, b, []Sample{{Timestamp: 1000, Value: math.Inf(1)}, {Timestamp: 1015, Value: 0}, {Timestamp: 1030, Value: 0}})
+
+		w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+		w.Write(buf)
+	}, ReadConfig{})
+
+	ss, err := r.Read(context.Background(), 1000, 5000)
+	require.NoError(t, err)
+	require.Equal(t, []timeSeries{
+		{labels: a, samples: []Sample{{Timestamp: 1000, Value: 2}, {Timestamp: 2000, Value: 2.5}, {Timestamp: 3000, Value: -1}, {Timestamp: 4500, Value: 1e10}}},
+		{labels: b, samples: []Sample{{Timestamp: 1000, Value: math.Inf(1)}, {Timestamp: 1015, Value: 0}, {Timestamp: 1030, Value: 0}}},
+	}, readAll(t, ss))
+}
+
+func TestReadStreamedCorrupted(t *testing.T) {
+	r := newTestReader(t, func(w http.ResponseWriter, r *http.Request) {
+		buf := appendFrame(nil, labels.FromStrings("job", "a"), []Sample{{Timestamp: 1000, Value: 1}})
+		buf[len(buf)-1] ^= 0xff
+
+		w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+		w.Write(buf)
+	}, ReadConfig{})
+
+	ss, err := r.Read(context.Background(), 0, 5000)
+	require.NoError(t, err)
+	require.False(t, ss.Next())
+	require.ErrorContains(t, ss.Err(), "checksum")
+}
+
+func TestReadError(t *testing.T) {
+	r := newTestReader(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "remote read is disabled\nmore", http.StatusBadRequest)
+	}, ReadConfig{})
+
+	_, err := r.Read(context.Background(), 0, 5000)
+	require.EqualError(t, err, "server returned HTTP status 400 Bad Request: remote read is disabled")
+}
@@ -0,0 +1,363 @@
+// Package remote provides clients for the Prometheus remote write and
+// remote read protocols.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+)
+
+const (
+	defaultWritePath = "/api/v1/write"
+
+	remoteWriteVersion = "0.1.0"
+)
+
+// ErrWriterClosed is returned by Append and Close once the Writer is closed.
+var ErrWriterClosed = errors.New("writer already closed")
+
+// Sample is a single sample of a series.
+type Sample = storage.Sample
+
+// WriteConfig configures a Writer.
+type WriteConfig struct {
+	// The path of the remote write endpoint relative to the client address,
+	// "/api/v1/write" if empty.
+	Path string
+
+	// The maximum number of samples sent in a single request. Appending more
+	// samples flushes the pending ones. Defaults to 2000.
+	MaxSamplesPerSend int
+
+	// The maximum time samples are buffered before they are sent. Defaults to 5s.
+	BatchSendDeadline time.Duration
+
+	// The maximum number of retries of a request failing with a 5xx status
+	// code or a network error. Defaults to 3, negative values disable retries.
+	MaxRetries int
+
+	// The backoff before the first retry, doubled on every further retry. Defaults to 30ms.
+	MinBackoff time.Duration
+
+	// The upper bound of the backoff. Defaults to 5s.
+	MaxBackoff time.Duration
+}
+
+func (cfg *WriteConfig) setDefaults() {
+	if cfg.Path == "" {
+		cfg.Path = defaultWritePath
+	}
+	if cfg.MaxSamplesPerSend <= 0 {
+		cfg.MaxSamplesPerSend = 2000
+	}
+	if cfg.BatchSendDeadline <= 0 {
+		cfg.BatchSendDeadline = 5 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 30 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Second
+	}
+}
+
+type timeSeries struct {
+	labels  labels.Labels
+	samples []Sample
+}
+
+// Writer pushes samples to a remote write endpoint, e.g. Prometheus with
+// --web.enable-remote-write-receiver or VictoriaMetrics. Samples are buffered
+// and sent once MaxSamplesPerSend is reached or BatchSendDeadline passed.
+//
+// It is safe to use a Writer from multiple goroutines.
+type Writer struct {
+	client prometheus.Client
+	cfg    WriteConfig
+
+	mtx      sync.Mutex
+	pending  []timeSeries
+	nSamples int
+	// The error of the last background flush, returned by the next call.
+	err error
+	// Set by Close, after which no more samples are accepted.
+	closed bool
+
+	// Held while a flush is in progress.
+	sendMtx   sync.Mutex
+	closeOnce sync.Once
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+// NewWriter returns a Writer sending through the given client, so that the
+// authentication and TLS settings of its prometheus.Config apply.
+func NewWriter(client prometheus.Client, cfg WriteConfig) *Writer {
+	cfg.setDefaults()
+	w := &Writer{
+		client: client,
+		cfg:    cfg,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Append buffers samples of the series with the given labels. If the buffer
+// is full, it is sent before Append returns. If a background flush failed
+// since the last call, its error is returned after buffering the samples.
+func (w *Writer) Append(ctx context.Context, ls labels.Labels, samples ...Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return ErrWriterClosed
+	}
+	w.pending = append(w.pending, timeSeries{labels: ls, samples: append([]Sample(nil), samples...)})
+	w.nSamples += len(samples)
+	full := w.nSamples >= w.cfg.MaxSamplesPerSend
+	err := w.err
+	w.err = nil
+	w.mtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if full {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends all buffered samples.
+func (w *Writer) Flush(ctx context.Context) error {
+	w.mtx.Lock()
+	err := w.err
+	w.err = nil
+	w.mtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return w.flush(ctx)
+}
+
+// flush takes the buffered samples and sends them. Only one flush runs at a
+// time so that the samples of a series arrive in order.
+func (w *Writer) flush(ctx context.Context) error {
+	w.sendMtx.Lock()
+	defer w.sendMtx.Unlock()
+
+	w.mtx.Lock()
+	batch := w.pending
+	w.pending, w.nSamples = nil, 0
+	w.mtx.Unlock()
+
+	return w.send(ctx, batch)
+}
+
+// Close stops the background flushing and sends the buffered samples.
+// Calling Close more than once returns ErrWriterClosed.
+func (w *Writer) Close(ctx context.Context) error {
+	closed := true
+	w.closeOnce.Do(func() {
+		closed = false
+		// Samples appended before this point are sent by the final flush,
+		// later ones are rejected.
+		w.mtx.Lock()
+		w.closed = true
+		w.mtx.Unlock()
+		close(w.quit)
+	})
+	if closed {
+		return ErrWriterClosed
+	}
+	<-w.done
+	return w.Flush(ctx)
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.BatchSendDeadline)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), w.cfg.BatchSendDeadline)
+			if err := w.flush(ctx); err != nil {
+				w.mtx.Lock()
+				w.err = err
+				w.mtx.Unlock()
+			}
+			cancel()
+		}
+	}
+}
+
+// send splits the series into requests of at most MaxSamplesPerSend samples.
+func (w *Writer) send(ctx context.Context, series []timeSeries) error {
+	var (
+		batch []timeSeries
+		n     int
+		buf   []byte
+	)
+	for _, s := range series {
+		for len(s.samples) > 0 {
+			k := w.cfg.MaxSamplesPerSend - n
+			if k > len(s.samples) {
+				k = len(s.samples)
+			}
+			batch = append(batch, timeSeries{labels: s.labels, samples: s.samples[:k]})
+			n += k
+			s.samples = s.samples[k:]
+
+			if n == w.cfg.MaxSamplesPerSend {
+				buf = encodeWriteRequest(buf[:0], batch)
+				if err := w.sendBatch(ctx, buf); err != nil {
+					return err
+				}
+				batch, n = batch[:0], 0
+			}
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	buf = encodeWriteRequest(buf[:0], batch)
+	return w.sendBatch(ctx, buf)
+}
+
+func (w *Writer) sendBatch(ctx context.Context, req []byte) error {
+	compressed := snappy.Encode(nil, req)
+
+	backoff := w.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, compressed)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(recoverableError); !ok || attempt >= w.cfg.MaxRetries {
+			return err
+		}
+
+		// Wait between half and the full backoff.
+		d := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+		if backoff > w.cfg.MaxBackoff {
+			backoff = w.cfg.MaxBackoff
+		}
+	}
+}
+
+// recoverableError is an error of a request that is worth retrying.
+type recoverableError struct {
+	error
+}
+
+func (w *Writer) post(ctx context.Context, compressed []byte) error {
+	header := http.Header{}
+	header.Set("Content-Encoding", "snappy")
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	resp, err := w.client.Raw(ctx, prometheus.RawRequest{
+		Method: http.MethodPost,
+		Path:   w.cfg.Path,
+		Header: header,
+		Body:   bytes.NewReader(compressed),
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	// Only show the first line of the error message.
+	line, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+	if resp.StatusCode/100 == 5 {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// encodeWriteRequest appends the protobuf encoding of a prometheus.WriteRequest to buf.
+func encodeWriteRequest(buf []byte, series []timeSeries) []byte {
+	var ts []byte
+	for _, s := range series {
+		ts = encodeTimeSeries(ts[:0], s)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
+
+func encodeTimeSeries(buf []byte, s timeSeries) []byte {
+	var b []byte
+	s.labels.Range(func(l labels.Label) {
+		b = b[:0]
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, l.Name)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, l.Value)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, b)
+	})
+	for _, smpl := range s.samples {
+		b = b[:0]
+		b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(smpl.Value))
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(smpl.Timestamp))
+
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, b)
+	}
+	return buf
+}
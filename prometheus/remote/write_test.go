@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+// receiver is a remote write endpoint decoding the requests it gets.
+type receiver struct {
+	mtx      sync.Mutex
+	requests [][]timeSeries
+	// Number of requests to fail with 503 before accepting.
+	failures int32
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&rc.failures, -1) >= 0 {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "snappy" {
+		http.Error(w, "bad encoding", http.StatusBadRequest)
+		return
+	}
+	compressed, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := decodeWriteRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.mtx.Lock()
+	rc.requests = append(rc.requests, series)
+	rc.mtx.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeWriteRequest(b []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := parseFields(b, func(fd field) error {
+		lset, samples, err := decodeTimeSeries(fd.bytes)
+		series = append(series, timeSeries{labels: lset, samples: samples})
+		return err
+	})
+	return series, err
+}
+
+func newTestWriter(t *testing.T, rc *receiver, cfg WriteConfig) *Writer {
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	client, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return NewWriter(client, cfg)
+}
+
+func TestWriterBatchesBySize(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{MaxSamplesPerSend: 3, BatchSendDeadline: time.Hour})
+	ctx := context.Background()
+
+	up := labels.FromStrings("__name__", "up", "job", "a")
+	require.NoError(t, w.Append(ctx, up, Sample{Timestamp: 1000, Value: 1}, Sample{Timestamp: 2000, Value: 0}))
+	require.NoError(t, w.Append(ctx, up, Sample{Timestamp: 3000, Value: 1}, Sample{Timestamp: 4000, Value: 1}))
+	require.NoError(t, w.Close(ctx))
+
+	require.Equal(t, [][]timeSeries{
+		{
+			{labels: up, samples: []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}}},
+			{labels: up, samples: []Sample{{Timestamp: 3000, Value: 1}}},
+		},
+		{
+			{labels: up, samples: []Sample{{Timestamp: 4000, Value: 1}}},
+		},
+	}, rc.requests)
+}
+
+func TestWriterFlushesByTime(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: 10 * time.Millisecond})
+	defer w.Close(context.Background())
+
+	up := labels.FromStrings("__name__", "up")
+	require.NoError(t, w.Append(context.Background(), up, Sample{Timestamp: 1000, Value: 1}))
+
+	require.Eventually(t, func() bool {
+		rc.mtx.Lock()
+		defer rc.mtx.Unlock()
+		return len(rc.requests) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWriterCloseTwice(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour})
+
+	require.NoError(t, w.Append(context.Background(), labels.FromStrings("__name__", "up"), Sample{Timestamp: 1000, Value: 1}))
+	require.NoError(t, w.Close(context.Background()))
+	require.Equal(t, ErrWriterClosed, w.Close(context.Background()))
+	require.Len(t, rc.requests, 1)
+}
+
+func TestWriterRetries(t *testing.T) {
+	rc := &receiver{failures: 2}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour, MinBackoff: time.Millisecond})
+
+	up := labels.FromStrings("__name__", "up")
+	require.NoError(t, w.Append(context.Background(), up, Sample{Timestamp: 1000, Value: 1}))
+	require.NoError(t, w.Close(context.Background()))
+	require.Len(t, rc.requests, 1)
+
+	rc = &receiver{failures: 2}
+	w = newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour, MinBackoff: time.Millisecond, MaxRetries: 1})
+	require.NoError(t, w.Append(context.Background(), up, Sample{Timestamp: 1000, Value: 1}))
+	require.Error(t, w.Close(context.Background()))
+	require.Empty(t, rc.requests)
+}
+
+func TestWriterAppendAfterClose(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour})
+	ctx := context.Background()
+
+	up := labels.FromStrings("__name__", "up")
+	require.NoError(t, w.Close(ctx))
+	require.Equal(t, ErrWriterClosed, w.Append(ctx, up, Sample{Timestamp: 1000, Value: 1}))
+	require.NoError(t, w.Flush(ctx))
+	require.Empty(t, rc.requests)
+}
+
+func TestWriterAppendRacingClose(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour})
+	ctx := context.Background()
+	up := labels.FromStrings("__name__", "up")
+
+	var (
+		mtx       sync.Mutex
+		accepted  []Sample
+		appendErr error
+		closed    = make(chan struct{})
+		done      = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for i := int64(0); ; i++ {
+			// Once Close returned, the next Append must fail.
+			var last bool
+			select {
+			case <-closed:
+				last = true
+			default:
+			}
+			s := Sample{Timestamp: i, Value: 1}
+			if appendErr = w.Append(ctx, up, s); appendErr != nil || last {
+				return
+			}
+			mtx.Lock()
+			accepted = append(accepted, s)
+			mtx.Unlock()
+		}
+	}()
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(accepted) > 0
+	}, time.Second, time.Millisecond)
+	require.NoError(t, w.Close(ctx))
+	close(closed)
+	<-done
+	require.Equal(t, ErrWriterClosed, appendErr)
+
+	// Every sample accepted by Append was sent by the final flush.
+	var sent []Sample
+	for _, req := range rc.requests {
+		for _, s := range req {
+			sent = append(sent, s.samples...)
+		}
+	}
+	require.Equal(t, accepted, sent)
+}
+
+func TestWriterAppendKeepsSamplesOnError(t *testing.T) {
+	rc := &receiver{failures: 1}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: 10 * time.Millisecond, MaxRetries: -1})
+	ctx := context.Background()
+	up := labels.FromStrings("__name__", "up")
+
+	require.NoError(t, w.Append(ctx, up, Sample{Timestamp: 1000, Value: 1}))
+	// Wait for the background flush to fail and store its error.
+	require.Eventually(t, func() bool {
+		w.mtx.Lock()
+		defer w.mtx.Unlock()
+		return w.err != nil
+	}, time.Second, time.Millisecond)
+
+	require.ErrorContains(t, w.Append(ctx, up, Sample{Timestamp: 2000, Value: 1}), "503")
+	require.NoError(t, w.Close(ctx))
+	require.Equal(t, [][]timeSeries{{{labels: up, samples: []Sample{{Timestamp: 2000, Value: 1}}}}}, rc.requests)
+}
+
+func TestWriterAppendCopiesSamples(t *testing.T) {
+	rc := &receiver{}
+	w := newTestWriter(t, rc, WriteConfig{BatchSendDeadline: time.Hour})
+	ctx := context.Background()
+	up := labels.FromStrings("__name__", "up")
+
+	samples := []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}
+	require.NoError(t, w.Append(ctx, up, samples...))
+	samples[0], samples[1] = Sample{Timestamp: 3000, Value: 3}, Sample{Timestamp: 4000, Value: 4}
+	require.NoError(t, w.Close(ctx))
+	require.Equal(t, [][]timeSeries{{{labels: up, samples: []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}}}}, rc.requests)
+}
@@ -0,0 +1,175 @@
+//go:build go1.7
+// +build go1.7
+
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusAPIError is the status code Prometheus uses for errors described in the response body.
+const statusAPIError = 422
+
+// DefaultRetryStatusCodes are retried if RetryConfig.StatusCodes is empty.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryConfig defines how failed requests are retried. Only idempotent
+// requests are retried: GET and HEAD requests, and requests carrying an
+// Idempotency-Key or X-Idempotency-Key header as understood by net/http.
+// A Retry-After header sent by the server is honored.
+type RetryConfig struct {
+	// The maximum number of attempts, including the first one.
+	// Values lower than 2 disable retries.
+	MaxAttempts int
+
+	// The backoff before the first retry. It is doubled on every further retry.
+	MinBackoff time.Duration
+
+	// The upper bound of the backoff. Zero means no bound.
+	MaxBackoff time.Duration
+
+	// The HTTP status codes that are retried. If empty, DefaultRetryStatusCodes are used.
+	StatusCodes []int
+
+	// The API error types that are retried for responses with status code 422,
+	// e.g. "timeout". See the ErrorType constants of the v1 package.
+	ErrorTypes []string
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying.
+func (r *RetryConfig) shouldRetry(ctx context.Context, req *http.Request, resp *http.Response, body []byte, err error) bool {
+	if !isIdempotent(req) || ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return resp == nil
+	}
+
+	codes := r.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+
+	if resp.StatusCode == statusAPIError && len(r.ErrorTypes) > 0 && body != nil {
+		var result struct {
+			ErrorType string `json:"errorType"`
+		}
+		if json.Unmarshal(body, &result) != nil {
+			return false
+		}
+		for _, t := range r.ErrorTypes {
+			if result.ErrorType == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// backoff returns the jittered time to wait before the given retry, starting at 1.
+func (r *RetryConfig) backoff(retry int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < retry && (r.MaxBackoff == 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Wait at least half of the backoff so that retries still spread out.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// wait sleeps before the given retry. A Retry-After header in resp takes
+// precedence over the backoff. It returns false without sleeping if the
+// context would expire before the retry could be sent, or if the server asks
+// to wait longer than MaxBackoff.
+func (r *RetryConfig) wait(ctx context.Context, retry int, resp *http.Response) bool {
+	d, ok := retryAfter(resp)
+	if !ok {
+		d = r.backoff(retry)
+	} else if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp,
+// given either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(t); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	_, ok := req.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// rewind returns a copy of req that can be sent again.
+func rewind(req *http.Request) (*http.Request, bool) {
+	r := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	r.Body = body
+	return r, true
+}
@@ -0,0 +1,344 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRetry(t *testing.T) {
+	timeoutBody := []byte(`{"status":"error","errorType":"timeout","error":"query timed out"}`)
+	execBody := []byte(`{"status":"error","errorType":"execution","error":"boom"}`)
+
+	for _, tc := range []struct {
+		name   string
+		cfg    RetryConfig
+		method string
+		header http.Header
+		code   int
+		body   []byte
+		err    error
+		retry  bool
+	}{
+		{name: "GET 503", method: http.MethodGet, code: http.StatusServiceUnavailable, retry: true},
+		{name: "GET 500", method: http.MethodGet, code: http.StatusInternalServerError},
+		{name: "GET 200", method: http.MethodGet, code: http.StatusOK},
+		{name: "connection error", method: http.MethodGet, err: errors.New("connection refused"), retry: true},
+		{name: "POST 503", method: http.MethodPost, code: http.StatusServiceUnavailable},
+		{name: "POST connection error", method: http.MethodPost, err: errors.New("connection refused")},
+		{
+			name:   "POST with Idempotency-Key",
+			method: http.MethodPost,
+			header: http.Header{"Idempotency-Key": {"k"}},
+			code:   http.StatusServiceUnavailable,
+			retry:  true,
+		},
+		{
+			name:   "POST with X-Idempotency-Key",
+			method: http.MethodPost,
+			header: http.Header{"X-Idempotency-Key": nil},
+			code:   http.StatusServiceUnavailable,
+			retry:  true,
+		},
+		{
+			name:   "custom status codes",
+			cfg:    RetryConfig{StatusCodes: []int{http.StatusInternalServerError}},
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			retry:  true,
+		},
+		{
+			name:   "custom status codes replace the defaults",
+			cfg:    RetryConfig{StatusCodes: []int{http.StatusInternalServerError}},
+			method: http.MethodGet,
+			code:   http.StatusServiceUnavailable,
+		},
+		{
+			name:   "422 with configured error type",
+			cfg:    RetryConfig{ErrorTypes: []string{"timeout"}},
+			method: http.MethodGet,
+			code:   statusAPIError,
+			body:   timeoutBody,
+			retry:  true,
+		},
+		{
+			name:   "422 with other error type",
+			cfg:    RetryConfig{ErrorTypes: []string{"timeout"}},
+			method: http.MethodGet,
+			code:   statusAPIError,
+			body:   execBody,
+		},
+		{
+			name:   "422 without error types",
+			method: http.MethodGet,
+			code:   statusAPIError,
+			body:   timeoutBody,
+		},
+		{
+			name:   "422 with unreadable body",
+			cfg:    RetryConfig{ErrorTypes: []string{"timeout"}},
+			method: http.MethodGet,
+			code:   statusAPIError,
+			body:   []byte(`timeout`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://localhost/api/v1/query", nil)
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			var resp *http.Response
+			if tc.err == nil {
+				resp = &http.Response{StatusCode: tc.code}
+			}
+			require.Equal(t, tc.retry, tc.cfg.shouldRetry(context.Background(), req, resp, tc.body, tc.err))
+		})
+	}
+}
+
+func TestShouldRetryCanceled(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var cfg RetryConfig
+	require.False(t, cfg.shouldRetry(ctx, req, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil, nil))
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := RetryConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for _, tc := range []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{retry: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{retry: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{retry: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{retry: 5, min: 500 * time.Millisecond, max: time.Second},
+		{retry: 50, min: 500 * time.Millisecond, max: time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			d := cfg.backoff(tc.retry)
+			require.GreaterOrEqual(t, d, tc.min, "retry %d", tc.retry)
+			require.LessOrEqual(t, d, tc.max, "retry %d", tc.retry)
+		}
+	}
+
+	var zero RetryConfig
+	require.Equal(t, time.Duration(0), zero.backoff(3))
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		ok    bool
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: ""},
+		{value: "soon"},
+		{value: "-1"},
+		{value: "0", ok: true},
+		{value: "3", ok: true, min: 3 * time.Second, max: 3 * time.Second},
+		{value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), ok: true, min: 59 * time.Minute, max: time.Hour},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), ok: true},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if tc.value != "" {
+			resp.Header.Set("Retry-After", tc.value)
+		}
+		d, ok := retryAfter(resp)
+		require.Equal(t, tc.ok, ok, "value %q", tc.value)
+		require.GreaterOrEqual(t, d, tc.min, "value %q", tc.value)
+		require.LessOrEqual(t, d, tc.max, "value %q", tc.value)
+	}
+
+	_, ok := retryAfter(nil)
+	require.False(t, ok)
+}
+
+// flakyServer fails the first n requests with the given status code and
+// records the bodies of all requests.
+type flakyServer struct {
+	mtx    sync.Mutex
+	fail   int
+	code   int
+	header http.Header
+	bodies []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.bodies = append(s.bodies, string(body))
+	if len(s.bodies) <= s.fail {
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(s.code)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func newRetryClient(t *testing.T, h http.Handler, retry RetryConfig) Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(Config{Address: srv.URL, Retry: retry})
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientRetry(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond}
+
+	t.Run("GET", func(t *testing.T) {
+		s := &flakyServer{fail: 2, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		resp, body, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "ok", string(body))
+		require.Len(t, s.bodies, 3)
+	})
+
+	t.Run("gives up after MaxAttempts", func(t *testing.T) {
+		s := &flakyServer{fail: 5, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Len(t, s.bodies, 3)
+	})
+
+	t.Run("POST is not retried", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodPost, c.URL("/api/v1/admin/tsdb/snapshot", nil).String(), strings.NewReader("x"))
+		require.NoError(t, err)
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Len(t, s.bodies, 1)
+	})
+
+	t.Run("body is rewound", func(t *testing.T) {
+		s := &flakyServer{fail: 2, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodPost, c.URL("/api/v1/query", nil).String(), strings.NewReader("query=up"))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", "1")
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{"query=up", "query=up", "query=up"}, s.bodies)
+	})
+
+	t.Run("body without GetBody is not retried", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodPost, c.URL("/api/v1/query", nil).String(), io.NopCloser(strings.NewReader("query=up")))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", "1")
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Len(t, s.bodies, 1)
+	})
+
+	t.Run("422 error type", func(t *testing.T) {
+		var n int
+		c := newRetryClient(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			n++
+			w.WriteHeader(statusAPIError)
+			if n == 1 {
+				io.WriteString(w, `{"status":"error","errorType":"timeout","error":"query timed out"}`)
+				return
+			}
+			io.WriteString(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+		}), RetryConfig{MaxAttempts: 5, MinBackoff: time.Millisecond, ErrorTypes: []string{"timeout"}})
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		_, body, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Contains(t, string(body), "bad_data")
+		require.Equal(t, 2, n)
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusServiceUnavailable}
+		c := newRetryClient(t, s, RetryConfig{MaxAttempts: 3, MinBackoff: time.Minute})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		resp, _, err := c.Do(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Len(t, s.bodies, 1)
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"1"}}}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		start := time.Now()
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+		require.Len(t, s.bodies, 2)
+	})
+
+	t.Run("Retry-After beyond MaxBackoff", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"120"}}}
+		c := newRetryClient(t, s, RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Second})
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+		require.NoError(t, err)
+		resp, _, err := c.Do(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		require.Len(t, s.bodies, 1)
+	})
+
+	t.Run("DoStream", func(t *testing.T) {
+		s := &flakyServer{fail: 1, code: http.StatusBadGateway}
+		c := newRetryClient(t, s, retry)
+
+		req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query_range", nil).String(), nil)
+		require.NoError(t, err)
+		resp, err := c.DoStream(context.Background(), req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, s.bodies, 2)
+	})
+}
@@ -0,0 +1,130 @@
+// Package scrape fetches metrics exposed in the Prometheus text exposition
+// format or OpenMetrics, e.g. by exporters on /metrics or by the /federate
+// endpoint of Prometheus.
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/textparse"
+	"github.com/liticer/gclients/prometheus/model/value"
+)
+
+const (
+	epFederate = "/federate"
+
+	acceptHeader = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+)
+
+// Target is a metrics endpoint scraped through a prometheus.Client, so that
+// the authentication and TLS settings of its prometheus.Config apply.
+//
+// It is safe to use a Target from multiple goroutines.
+type Target struct {
+	client prometheus.Client
+	path   string
+	query  url.Values
+
+	mtx sync.Mutex
+	// The series without explicit timestamps of the previous scrape, by hash.
+	prev map[uint64]labels.Labels
+}
+
+// NewTarget returns a Target for the endpoint at the given path relative to
+// the client address, e.g. "/metrics".
+func NewTarget(client prometheus.Client, path string) *Target {
+	return &Target{client: client, path: path}
+}
+
+// NewFederationTarget returns a Target for the /federate endpoint of a
+// Prometheus, selecting the series matching any of the given selectors.
+func NewFederationTarget(client prometheus.Client, matches ...string) *Target {
+	return &Target{
+		client: client,
+		path:   epFederate,
+		query:  url.Values{"match[]": matches},
+	}
+}
+
+// Scrape fetches and parses the metrics of the target.
+//
+// Like Prometheus, Scrape reports series without explicit timestamps which
+// were present in the previous scrape of the target but are missing now
+// with a stale marker, i.e. a value.StaleNaN sample at the time of the scrape.
+func (t *Target) Scrape(ctx context.Context) (*textparse.Result, error) {
+	header := http.Header{}
+	header.Set("Accept", acceptHeader)
+
+	start := time.Now()
+	resp, err := t.client.Raw(ctx, prometheus.RawRequest{
+		Path:   t.path,
+		Query:  t.query,
+		Header: header,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		// Only show the first line of the error message.
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[:i]
+		}
+		return nil, fmt.Errorf("server returned HTTP status %s: %s", resp.Status, b)
+	}
+
+	res, err := textparse.Parse(b, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	t.addStaleMarkers(res, start.UnixMilli())
+	return res, nil
+}
+
+func (t *Target) addStaleMarkers(res *textparse.Result, ts int64) {
+	cur := make(map[uint64]labels.Labels, len(res.Samples))
+	for _, s := range res.Samples {
+		if !s.HasTimestamp {
+			cur[s.Labels.Hash()] = s.Labels
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var stale []labels.Labels
+	for h, ls := range t.prev {
+		if _, ok := cur[h]; !ok {
+			stale = append(stale, ls)
+		}
+	}
+	t.prev = cur
+
+	sort.Slice(stale, func(i, j int) bool {
+		return labels.Compare(stale[i], stale[j]) < 0
+	})
+	for _, ls := range stale {
+		res.Samples = append(res.Samples, textparse.Sample{
+			Labels:       ls,
+			Value:        math.Float64frombits(value.StaleNaN),
+			Timestamp:    ts,
+			HasTimestamp: true,
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package scrape
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/value"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) prometheus.Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	client, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return client
+}
+
+func TestScrapeStaleMarkers(t *testing.T) {
+	pages := []string{
+		"a 1\nb 2\nc 3 1000\n",
+		"a 1\n",
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/metrics", r.URL.Path)
+		require.Contains(t, r.Header.Get("Accept"), "application/openmetrics-text")
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(pages[0]))
+		pages = pages[1:]
+	})
+	target := NewTarget(client, "/metrics")
+
+	res, err := target.Scrape(context.Background())
+	require.NoError(t, err)
+	require.Len(t, res.Samples, 3)
+
+	res, err = target.Scrape(context.Background())
+	require.NoError(t, err)
+	require.Len(t, res.Samples, 2)
+	// c had an explicit timestamp and is not marked stale.
+	stale := res.Samples[1]
+	require.Equal(t, labels.FromStrings("__name__", "b"), stale.Labels)
+	require.True(t, value.IsStaleNaN(stale.Value))
+	require.True(t, stale.HasTimestamp)
+}
+
+func TestFederate(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/federate", r.URL.Path)
+		require.Equal(t, []string{`{job="a"}`, "up"}, r.URL.Query()["match[]"])
+
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0")
+		w.Write([]byte("# TYPE up gauge\nup{job=\"a\",instance=\"x\"} 1 1.5\n# EOF\n"))
+	})
+
+	res, err := NewFederationTarget(client, `{job="a"}`, "up").Scrape(context.Background())
+	require.NoError(t, err)
+	require.Len(t, res.Samples, 1)
+	require.Equal(t, labels.FromStrings("__name__", "up", "instance", "x", "job", "a"), res.Samples[0].Labels)
+	require.Equal(t, int64(1500), res.Samples[0].Timestamp)
+}
+
+func TestScrapeError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	_, err := NewTarget(client, "/metrics").Scrape(context.Background())
+	require.EqualError(t, err, "server returned HTTP status 404 Not Found: not found")
+}
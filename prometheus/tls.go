@@ -0,0 +1,118 @@
+//go:build go1.7
+// +build go1.7
+
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// TLSConfig configures the TLS connection to the Prometheus.
+// Server certificates are verified unless InsecureSkipVerify is set.
+type TLSConfig struct {
+	// PEM encoded CA bundle used to verify the server certificate.
+	// If neither CA nor CAFile is set, the system roots are used.
+	CA string
+	// The path of a PEM encoded CA bundle.
+	CAFile string
+
+	// PEM encoded client certificate and key for mTLS.
+	Cert string
+	Key  string
+	// The paths of a PEM encoded client certificate and key for mTLS.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+
+	// MinVersion is the minimum TLS version accepted, e.g. tls.VersionTLS12.
+	// If zero, the crypto/tls default is used.
+	MinVersion uint16
+
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
+}
+
+func (c *TLSConfig) isZero() bool {
+	return *c == TLSConfig{}
+}
+
+// NewTLSConfig returns a *tls.Config for the given configuration.
+func NewTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		MinVersion:         cfg.MinVersion,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	ca := []byte(cfg.CA)
+	if cfg.CAFile != "" {
+		b, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file %s: %w", cfg.CAFile, err)
+		}
+		ca = append(ca, b...)
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("unable to use specified CA: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	cert, key := []byte(cfg.Cert), []byte(cfg.Key)
+	if cfg.CertFile != "" {
+		b, err := os.ReadFile(cfg.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client cert file %s: %w", cfg.CertFile, err)
+		}
+		cert = b
+	}
+	if cfg.KeyFile != "" {
+		b, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client key file %s: %w", cfg.KeyFile, err)
+		}
+		key = b
+	}
+	if len(cert) > 0 || len(key) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to use specified client cert and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	return tlsConfig, nil
+}
+
+// newTransport returns a copy of DefaultRoundTripper using the TLS and proxy settings of cfg.
+func newTransport(cfg *Config) (http.RoundTripper, error) {
+	t, ok := DefaultRoundTripper.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("TLSConfig and ProxyURL require DefaultRoundTripper to be an *http.Transport")
+	}
+	t = t.Clone()
+
+	tlsConfig, err := NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.ProxyURL, err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	return t, nil
+}
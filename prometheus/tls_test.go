@@ -0,0 +1,191 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// certPEM returns the PEM encoding of the leaf certificate of srv.
+func certPEM(srv *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+// newClientCert returns a self-signed client certificate and its key, PEM encoded.
+func newClientCert(t *testing.T) (cert, key string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+
+	cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return cert, key
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+// get sends a GET request for the query endpoint through a client built from cfg.
+func get(t *testing.T, cfg Config) error {
+	t.Helper()
+	c, err := NewClient(cfg)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, c.URL("/api/v1/query", nil).String(), nil)
+	require.NoError(t, err)
+	resp, _, err := c.Do(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return nil
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestTLSServerVerification(t *testing.T) {
+	srv := httptest.NewTLSServer(okHandler())
+	defer srv.Close()
+	ca := certPEM(srv)
+	caFile := writeFile(t, "ca.pem", ca)
+
+	for _, tc := range []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{name: "unknown CA", tls: TLSConfig{ServerName: "example.com"}, wantErr: "certificate signed by unknown authority"},
+		{name: "CA", tls: TLSConfig{CA: ca}},
+		{name: "CA file", tls: TLSConfig{CAFile: caFile}},
+		{name: "insecure", tls: TLSConfig{InsecureSkipVerify: true}},
+		{name: "matching server name", tls: TLSConfig{CA: ca, ServerName: "example.com"}},
+		{name: "mismatching server name", tls: TLSConfig{CA: ca, ServerName: "prometheus.invalid"}, wantErr: "certificate is valid for"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := get(t, Config{Address: srv.URL, TLSConfig: tc.tls})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(okHandler())
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := certPEM(srv)
+
+	require.NoError(t, get(t, Config{Address: srv.URL, TLSConfig: TLSConfig{CA: ca, MinVersion: tls.VersionTLS12}}))
+	require.ErrorContains(t, get(t, Config{Address: srv.URL, TLSConfig: TLSConfig{CA: ca, MinVersion: tls.VersionTLS13}}), "protocol version")
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	cert, key := newClientCert(t)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM([]byte(cert)))
+
+	var peers int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peers = len(r.TLS.PeerCertificates)
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := certPEM(srv)
+
+	t.Run("inline", func(t *testing.T) {
+		peers = 0
+		require.NoError(t, get(t, Config{Address: srv.URL, TLSConfig: TLSConfig{CA: ca, Cert: cert, Key: key}}))
+		require.Equal(t, 1, peers)
+	})
+	t.Run("files", func(t *testing.T) {
+		peers = 0
+		require.NoError(t, get(t, Config{Address: srv.URL, TLSConfig: TLSConfig{
+			CA:       ca,
+			CertFile: writeFile(t, "cert.pem", cert),
+			KeyFile:  writeFile(t, "key.pem", key),
+		}}))
+		require.Equal(t, 1, peers)
+	})
+	t.Run("missing", func(t *testing.T) {
+		require.Error(t, get(t, Config{Address: srv.URL, TLSConfig: TLSConfig{CA: ca}}))
+	})
+}
+
+func TestProxyURL(t *testing.T) {
+	var target string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	require.NoError(t, get(t, Config{Address: "http://prometheus.invalid:9090", ProxyURL: proxy.URL}))
+	require.Equal(t, "http://prometheus.invalid:9090/api/v1/query", target)
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	cert, key := newClientCert(t)
+	_, otherKey := newClientCert(t)
+
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "missing CA file", cfg: Config{TLSConfig: TLSConfig{CAFile: "/nonexistent/ca.pem"}}, wantErr: "unable to read CA file"},
+		{name: "invalid CA", cfg: Config{TLSConfig: TLSConfig{CA: "not a certificate"}}, wantErr: "no certificates found"},
+		{name: "cert without key", cfg: Config{TLSConfig: TLSConfig{Cert: cert}}, wantErr: "unable to use specified client cert and key"},
+		{name: "mismatched key", cfg: Config{TLSConfig: TLSConfig{Cert: cert, Key: otherKey}}, wantErr: "unable to use specified client cert and key"},
+		{name: "missing key file", cfg: Config{TLSConfig: TLSConfig{Cert: cert, Key: key, KeyFile: "/nonexistent/key.pem"}}, wantErr: "unable to read client key file"},
+		{name: "invalid proxy URL", cfg: Config{ProxyURL: "http://[::1"}, wantErr: "invalid proxy URL"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Address = "https://localhost:9090"
+			_, err := NewClient(tc.cfg)
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
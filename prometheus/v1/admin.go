@@ -0,0 +1,102 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/liticer/gclients/prometheus"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	epSnapshot        = apiPrefix + "/admin/tsdb/snapshot"
+	epDeleteSeries    = apiPrefix + "/admin/tsdb/delete_series"
+	epCleanTombstones = apiPrefix + "/admin/tsdb/clean_tombstones"
+)
+
+// AdminAPI provides bindings for Prometheus's TSDB admin API. The admin API
+// is only available if Prometheus runs with --web.enable-admin-api.
+type AdminAPI interface {
+	// Snapshot creates a snapshot of all current data into snapshots/<datetime>-<rand>
+	// under the TSDB's data directory. If skipHead is set, data in the head block is left out.
+	Snapshot(ctx context.Context, skipHead bool) (SnapshotResult, error)
+	// DeleteSeries deletes data for the series matching any of the given selectors
+	// within the given time range. If dryRun is set nothing is deleted, and the
+	// series that would have been removed are returned instead.
+	DeleteSeries(ctx context.Context, matches []string, start, end time.Time, dryRun bool) ([]model.Metric, error)
+	// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+	CleanTombstones(ctx context.Context) error
+}
+
+// SnapshotResult contains the result from querying the snapshot endpoint.
+type SnapshotResult struct {
+	Name string `json:"name"`
+}
+
+// NewAdminAPI returns a new AdminAPI for the client.
+//
+// It is safe to use the returned AdminAPI from multiple goroutines.
+func NewAdminAPI(c prometheus.Client) AdminAPI {
+	return &httpAdminAPI{
+		api: &httpAPI{client: apiClient{c}, postThreshold: -1},
+	}
+}
+
+type httpAdminAPI struct {
+	api *httpAPI
+}
+
+func (h *httpAdminAPI) Snapshot(ctx context.Context, skipHead bool) (SnapshotResult, error) {
+	u := h.api.client.URL(epSnapshot, nil)
+	q := u.Query()
+	q.Set("skip_head", strconv.FormatBool(skipHead))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return SnapshotResult{}, err
+	}
+	_, body, err := h.api.client.Do(ctx, req)
+	if err != nil {
+		return SnapshotResult{}, err
+	}
+	var res SnapshotResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+func (h *httpAdminAPI) DeleteSeries(ctx context.Context, matches []string, start, end time.Time, dryRun bool) ([]model.Metric, error) {
+	if dryRun {
+		return h.api.Series(ctx, matches, start, end)
+	}
+
+	u := h.api.client.URL(epDeleteSeries, nil)
+	q := u.Query()
+	setSeriesParams(q, matches, start, end)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = h.api.client.Do(ctx, req)
+	return nil, err
+}
+
+func (h *httpAdminAPI) CleanTombstones(ctx context.Context) error {
+	u := h.api.client.URL(epCleanTombstones, nil)
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = h.api.client.Do(ctx, req)
+	return err
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+)
+
+// newTestAdminAPI returns an AdminAPI talking to a test server that serves h.
+func newTestAdminAPI(t *testing.T, h http.Handler) AdminAPI {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return NewAdminAPI(c)
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, skipHead := range []bool{false, true} {
+		api := newTestAdminAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, epSnapshot, r.URL.Path)
+			require.Equal(t, fmt.Sprint(skipHead), r.URL.Query().Get("skip_head"))
+			fmt.Fprint(w, success(`{"name":"20240102T030405Z-6c5b6a1d"}`))
+		}))
+
+		res, err := api.Snapshot(context.Background(), skipHead)
+		require.NoError(t, err)
+		require.Equal(t, SnapshotResult{Name: "20240102T030405Z-6c5b6a1d"}, res)
+	}
+}
+
+func TestDeleteSeries(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(time.Hour)
+	matches := []string{`up{job="a"}`, `up{job="b"}`}
+	wantQuery := url.Values{
+		"match[]": matches,
+		"start":   {"2024-01-02T03:04:05Z"},
+		"end":     {"2024-01-02T04:04:05Z"},
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		var calls int
+		api := newTestAdminAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, epDeleteSeries, r.URL.Path)
+			require.Equal(t, wantQuery, r.URL.Query())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		res, err := api.DeleteSeries(context.Background(), matches, start, end, false)
+		require.NoError(t, err)
+		require.Nil(t, res)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		api := newTestAdminAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodGet, r.Method)
+			require.Equal(t, epSeries, r.URL.Path)
+			require.Equal(t, wantQuery, r.URL.Query())
+			fmt.Fprint(w, success(`[{"__name__":"up","job":"a"},{"__name__":"up","job":"b"}]`))
+		}))
+
+		res, err := api.DeleteSeries(context.Background(), matches, start, end, true)
+		require.NoError(t, err)
+		require.Equal(t, []model.Metric{
+			{"__name__": "up", "job": "a"},
+			{"__name__": "up", "job": "b"},
+		}, res)
+	})
+
+	t.Run("admin API disabled", func(t *testing.T) {
+		api := newTestAdminAPI(t, respondWith(http.StatusServiceUnavailable, `{"status":"error","errorType":"unavailable","error":"admin APIs disabled"}`))
+
+		_, err := api.DeleteSeries(context.Background(), matches, start, end, false)
+		require.Equal(t, &Error{Type: ErrBadResponse, Msg: "bad response code 503"}, err)
+	})
+}
+
+func TestCleanTombstones(t *testing.T) {
+	api := newTestAdminAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, epCleanTombstones, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	require.NoError(t, api.CleanTombstones(context.Background()))
+}
+
+func TestDecodeNoContent(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		code    int
+		body    string
+		wantErr error
+	}{
+		{name: "no content", code: http.StatusNoContent},
+		{
+			name:    "empty body",
+			code:    http.StatusOK,
+			wantErr: &Error{Type: ErrBadResponse, Msg: "unexpected end of JSON input"},
+		},
+		{
+			name:    "error envelope on success code",
+			code:    http.StatusOK,
+			body:    `{"status":"error","errorType":"internal","error":"boom"}`,
+			wantErr: &Error{Type: ErrBadResponse, Msg: "inconsistent body for response code"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAdminAPI(t, respondWith(tc.code, tc.body))
+			require.Equal(t, tc.wantErr, api.CleanTombstones(context.Background()))
+		})
+	}
+}
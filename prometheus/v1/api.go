@@ -23,12 +23,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
 
-	"github.com/levigross/grequests"
 	"github.com/prometheus/common/model"
 )
 
@@ -42,6 +44,70 @@ const (
 	epLabels      = apiPrefix + "/labels"
 	epLabelValues = apiPrefix + "/label/:name/values"
 	epSeries      = apiPrefix + "/series"
+	epExemplars   = apiPrefix + "/query_exemplars"
+	epTargets     = apiPrefix + "/targets"
+	epRules       = apiPrefix + "/rules"
+	epAlerts      = apiPrefix + "/alerts"
+	epMetadata    = apiPrefix + "/metadata"
+	epConfig      = apiPrefix + "/status/config"
+	epFlags       = apiPrefix + "/status/flags"
+	epBuildinfo   = apiPrefix + "/status/buildinfo"
+	epRuntimeinfo = apiPrefix + "/status/runtimeinfo"
+	epTSDB        = apiPrefix + "/status/tsdb"
+)
+
+// AlertState models the state of an alert.
+type AlertState string
+
+// Possible values for AlertState.
+const (
+	AlertStateFiring   AlertState = "firing"
+	AlertStateInactive AlertState = "inactive"
+	AlertStatePending  AlertState = "pending"
+)
+
+// HealthStatus models the health status of a scrape target.
+type HealthStatus string
+
+// Possible values for HealthStatus.
+const (
+	HealthGood    HealthStatus = "up"
+	HealthUnknown HealthStatus = "unknown"
+	HealthBad     HealthStatus = "down"
+)
+
+// RuleType models the type of a rule.
+type RuleType string
+
+// Possible values for RuleType.
+const (
+	RuleTypeRecording RuleType = "recording"
+	RuleTypeAlerting  RuleType = "alerting"
+)
+
+// RuleHealth models the health status of a rule.
+type RuleHealth string
+
+// Possible values for RuleHealth.
+const (
+	RuleHealthGood    RuleHealth = "ok"
+	RuleHealthUnknown RuleHealth = "unknown"
+	RuleHealthBad     RuleHealth = "err"
+)
+
+// MetricType models the type of a metric.
+type MetricType string
+
+// Possible values for MetricType.
+const (
+	MetricTypeCounter        MetricType = "counter"
+	MetricTypeGauge          MetricType = "gauge"
+	MetricTypeHistogram      MetricType = "histogram"
+	MetricTypeGaugeHistogram MetricType = "gaugehistogram"
+	MetricTypeSummary        MetricType = "summary"
+	MetricTypeInfo           MetricType = "info"
+	MetricTypeStateset       MetricType = "stateset"
+	MetricTypeUnknown        MetricType = "unknown"
 )
 
 // ErrorType models the different API error types.
@@ -82,14 +148,397 @@ type API interface {
 	Query(ctx context.Context, query string, ts time.Time) (model.Value, error)
 	// QueryRange performs a query for the given range.
 	QueryRange(ctx context.Context, query string, r Range) (model.Value, error)
-	// Labels getting label names.
-	Labels(ctx context.Context, start, end int64, match string) (model.LabelValues, error)
-	// LabelValues performs a query for the values of the given label.
-	LabelValues(ctx context.Context, start, end int64, label string) (model.LabelValues, error)
-	// Series finding series by label matchers.
-	Series(ctx context.Context, start, end int64, match string) ([]model.Metric, error)
-	// Proxy request to prometheus endpoint
-	Proxy(method string, url string, params map[string]string, data map[string]string) (*grequests.Response, error)
+	// QueryDetailed performs a query for the given time and returns the result
+	// together with the warnings, infos and stats reported by the server.
+	QueryDetailed(ctx context.Context, query string, ts time.Time, opts ...Option) (*QueryResult, error)
+	// QueryRangeDetailed performs a query for the given range and returns the result
+	// together with the warnings, infos and stats reported by the server.
+	QueryRangeDetailed(ctx context.Context, query string, r Range, opts ...Option) (*QueryResult, error)
+	// Labels getting label names of the series matching any of the given selectors.
+	Labels(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error)
+	// LabelValues performs a query for the values of the given label of the
+	// series matching any of the given selectors.
+	LabelValues(ctx context.Context, label string, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error)
+	// Series finding series matching any of the given selectors.
+	Series(ctx context.Context, matches []string, start, end time.Time, opts ...Option) ([]model.Metric, error)
+	// QueryRangeStream performs a query for the given range and decodes the
+	// resulting matrix incrementally, one series at a time.
+	QueryRangeStream(ctx context.Context, query string, r Range, opts ...Option) (MatrixStream, error)
+	// QueryExemplars performs a query for the exemplars of the series selected
+	// by query within the given time range.
+	QueryExemplars(ctx context.Context, query string, start, end time.Time) ([]ExemplarQueryResult, error)
+	// Targets returns an overview of the current state of the Prometheus target discovery.
+	Targets(ctx context.Context) (TargetsResult, error)
+	// Rules returns a list of alerting and recording rules that are currently loaded.
+	Rules(ctx context.Context) (RulesResult, error)
+	// Alerts returns a list of all active alerts.
+	Alerts(ctx context.Context) (AlertsResult, error)
+	// Metadata returns metadata about metrics currently scraped by the metric name.
+	Metadata(ctx context.Context, metric, limit string) (map[string][]Metadata, error)
+	// Config returns the current Prometheus configuration.
+	Config(ctx context.Context) (ConfigResult, error)
+	// Flags returns the flag values that Prometheus was launched with.
+	Flags(ctx context.Context) (FlagsResult, error)
+	// Buildinfo returns various build information properties about the Prometheus server.
+	Buildinfo(ctx context.Context) (BuildinfoResult, error)
+	// Runtimeinfo returns the various runtime information properties about the Prometheus server.
+	Runtimeinfo(ctx context.Context) (RuntimeinfoResult, error)
+	// TSDB returns the cardinality statistics.
+	TSDB(ctx context.Context) (TSDBResult, error)
+	// Raw sends an arbitrary request to the prometheus endpoint. The caller
+	// must close the body of the returned response.
+	Raw(ctx context.Context, r prometheus.RawRequest) (*http.Response, error)
+}
+
+// ExemplarQueryResult contains the exemplars of a single series.
+type ExemplarQueryResult struct {
+	SeriesLabels labels.Labels `json:"seriesLabels"`
+	Exemplars    []Exemplar    `json:"exemplars"`
+}
+
+// Exemplar models a single exemplar, e.g. a sample carrying a trace ID.
+type Exemplar struct {
+	Labels    labels.Labels     `json:"labels"`
+	Value     model.SampleValue `json:"value"`
+	Timestamp model.Time        `json:"timestamp"`
+}
+
+// AlertsResult contains the result from querying the alerts endpoint.
+type AlertsResult struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Alert models an active alert.
+type Alert struct {
+	ActiveAt    time.Time      `json:"activeAt"`
+	Annotations model.LabelSet `json:"annotations"`
+	Labels      model.LabelSet `json:"labels"`
+	State       AlertState     `json:"state"`
+	Value       string         `json:"value"`
+}
+
+// TargetsResult contains the result from querying the targets endpoint.
+type TargetsResult struct {
+	Active  []ActiveTarget  `json:"activeTargets"`
+	Dropped []DroppedTarget `json:"droppedTargets"`
+}
+
+// ActiveTarget models an active Prometheus scrape target.
+type ActiveTarget struct {
+	DiscoveredLabels   map[string]string `json:"discoveredLabels"`
+	Labels             model.LabelSet    `json:"labels"`
+	ScrapePool         string            `json:"scrapePool"`
+	ScrapeURL          string            `json:"scrapeUrl"`
+	GlobalURL          string            `json:"globalUrl"`
+	LastError          string            `json:"lastError"`
+	LastScrape         time.Time         `json:"lastScrape"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	Health             HealthStatus      `json:"health"`
+	ScrapeInterval     string            `json:"scrapeInterval"`
+	ScrapeTimeout      string            `json:"scrapeTimeout"`
+}
+
+// DroppedTarget models a dropped Prometheus scrape target.
+type DroppedTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+}
+
+// RulesResult contains the result from querying the rules endpoint.
+type RulesResult struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+// RuleGroup models a rule group that contains a set of recording and alerting rules.
+type RuleGroup struct {
+	Name           string    `json:"name"`
+	File           string    `json:"file"`
+	Interval       float64   `json:"interval"`
+	Rules          Rules     `json:"rules"`
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+}
+
+// Rules is a slice of alerting and recording rules. Every element is either
+// an AlertingRule or a RecordingRule.
+type Rules []interface{}
+
+// AlertingRule models an alerting rule.
+type AlertingRule struct {
+	Name           string         `json:"name"`
+	Query          string         `json:"query"`
+	Duration       float64        `json:"duration"`
+	Labels         model.LabelSet `json:"labels"`
+	Annotations    model.LabelSet `json:"annotations"`
+	Alerts         []*Alert       `json:"alerts"`
+	Health         RuleHealth     `json:"health"`
+	LastError      string         `json:"lastError,omitempty"`
+	EvaluationTime float64        `json:"evaluationTime"`
+	LastEvaluation time.Time      `json:"lastEvaluation"`
+	State          string         `json:"state"`
+}
+
+// RecordingRule models a recording rule.
+type RecordingRule struct {
+	Name           string         `json:"name"`
+	Query          string         `json:"query"`
+	Labels         model.LabelSet `json:"labels,omitempty"`
+	Health         RuleHealth     `json:"health"`
+	LastError      string         `json:"lastError,omitempty"`
+	EvaluationTime float64        `json:"evaluationTime"`
+	LastEvaluation time.Time      `json:"lastEvaluation"`
+}
+
+func (rg *RuleGroup) UnmarshalJSON(b []byte) error {
+	v := struct {
+		Name           string            `json:"name"`
+		File           string            `json:"file"`
+		Interval       float64           `json:"interval"`
+		Rules          []json.RawMessage `json:"rules"`
+		EvaluationTime float64           `json:"evaluationTime"`
+		LastEvaluation time.Time         `json:"lastEvaluation"`
+	}{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	rg.Name = v.Name
+	rg.File = v.File
+	rg.Interval = v.Interval
+	rg.EvaluationTime = v.EvaluationTime
+	rg.LastEvaluation = v.LastEvaluation
+	rg.Rules = make(Rules, 0, len(v.Rules))
+
+	for _, rule := range v.Rules {
+		var rt struct {
+			Type RuleType `json:"type"`
+		}
+		if err := json.Unmarshal(rule, &rt); err != nil {
+			return err
+		}
+
+		switch rt.Type {
+		case RuleTypeAlerting:
+			var alertingRule AlertingRule
+			if err := json.Unmarshal(rule, &alertingRule); err != nil {
+				return err
+			}
+			rg.Rules = append(rg.Rules, alertingRule)
+		case RuleTypeRecording:
+			var recordingRule RecordingRule
+			if err := json.Unmarshal(rule, &recordingRule); err != nil {
+				return err
+			}
+			rg.Rules = append(rg.Rules, recordingRule)
+		default:
+			return fmt.Errorf("unexpected rule type %q", rt.Type)
+		}
+	}
+	return nil
+}
+
+// Metadata models the metadata of a metric.
+type Metadata struct {
+	Type MetricType `json:"type"`
+	Help string     `json:"help"`
+	Unit string     `json:"unit"`
+}
+
+// ConfigResult contains the result from querying the config endpoint.
+type ConfigResult struct {
+	YAML string `json:"yaml"`
+}
+
+// FlagsResult contains the result from querying the flag endpoint.
+type FlagsResult map[string]string
+
+// BuildinfoResult contains the results from querying the buildinfo endpoint.
+type BuildinfoResult struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// RuntimeinfoResult contains the result from querying the runtimeinfo endpoint.
+type RuntimeinfoResult struct {
+	StartTime           time.Time `json:"startTime"`
+	CWD                 string    `json:"CWD"`
+	ReloadConfigSuccess bool      `json:"reloadConfigSuccess"`
+	LastConfigTime      time.Time `json:"lastConfigTime"`
+	CorruptionCount     int       `json:"corruptionCount"`
+	GoroutineCount      int       `json:"goroutineCount"`
+	GOMAXPROCS          int       `json:"GOMAXPROCS"`
+	GOGC                string    `json:"GOGC"`
+	GODEBUG             string    `json:"GODEBUG"`
+	StorageRetention    string    `json:"storageRetention"`
+}
+
+// TSDBResult contains the result from querying the tsdb endpoint.
+type TSDBResult struct {
+	HeadStats                   TSDBHeadStats `json:"headStats"`
+	SeriesCountByMetricName     []Stat        `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []Stat        `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []Stat        `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []Stat        `json:"seriesCountByLabelValuePair"`
+}
+
+// TSDBHeadStats contains TSDB stats of the head block.
+type TSDBHeadStats struct {
+	NumSeries     int `json:"numSeries"`
+	NumLabelPairs int `json:"numLabelPairs"`
+	ChunkCount    int `json:"chunkCount"`
+	MinTime       int `json:"minTime"`
+	MaxTime       int `json:"maxTime"`
+}
+
+// Stat models a single statistic value.
+type Stat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// Warnings is an array of non critical errors returned by the API.
+type Warnings []string
+
+// Option sets optional parameters of a request.
+type Option func(*queryOptions)
+
+type queryOptions struct {
+	stats string
+	limit uint64
+
+	// VictoriaMetrics extensions.
+	extraLabels  []string
+	extraFilters []string
+	nocache      bool
+	roundDigits  *int
+}
+
+// WithStats asks the server to include per-step execution stats in the result.
+func WithStats() Option {
+	return func(o *queryOptions) {
+		o.stats = "all"
+	}
+}
+
+// WithLimit limits the number of returned series, label names or label values.
+func WithLimit(limit uint64) Option {
+	return func(o *queryOptions) {
+		o.limit = limit
+	}
+}
+
+// WithExtraLabel enforces the label name=value on the series selected by a
+// VictoriaMetrics query, export or import. It may be given multiple times.
+func WithExtraLabel(name, value string) Option {
+	return func(o *queryOptions) {
+		o.extraLabels = append(o.extraLabels, name+"="+value)
+	}
+}
+
+// WithExtraFilters restricts the series selected by a VictoriaMetrics query
+// or export to those matching any of the given series selectors.
+func WithExtraFilters(selectors ...string) Option {
+	return func(o *queryOptions) {
+		o.extraFilters = append(o.extraFilters, selectors...)
+	}
+}
+
+// WithNoCache disables the response cache of VictoriaMetrics for a query.
+func WithNoCache() Option {
+	return func(o *queryOptions) {
+		o.nocache = true
+	}
+}
+
+// WithRoundDigits makes VictoriaMetrics round the values of a query result
+// to the given number of decimal digits.
+func WithRoundDigits(digits int) Option {
+	return func(o *queryOptions) {
+		o.roundDigits = &digits
+	}
+}
+
+func (o *queryOptions) apply(q url.Values) {
+	if o.stats != "" {
+		q.Set("stats", o.stats)
+	}
+	if o.limit != 0 {
+		q.Set("limit", strconv.FormatUint(o.limit, 10))
+	}
+	for _, l := range o.extraLabels {
+		q.Add("extra_label", l)
+	}
+	for _, f := range o.extraFilters {
+		q.Add("extra_filters[]", f)
+	}
+	if o.nocache {
+		q.Set("nocache", "1")
+	}
+	if o.roundDigits != nil {
+		q.Set("round_digits", strconv.Itoa(*o.roundDigits))
+	}
+}
+
+func newQueryOptions(opts []Option) *queryOptions {
+	o := &queryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// QueryResult contains the decoded value of a query together with the
+// warnings, infos and execution stats attached to the response.
+type QueryResult struct {
+	Value    model.Value
+	Warnings Warnings
+	Infos    []string
+	// Stats is only set if the query was issued WithStats.
+	Stats *QueryStats
+}
+
+// QueryStats models the execution stats of a query.
+type QueryStats struct {
+	Timings QueryTimings  `json:"timings"`
+	Samples *QuerySamples `json:"samples,omitempty"`
+}
+
+// QueryTimings models the time spent in the phases of a query, in seconds.
+type QueryTimings struct {
+	EvalTotalTime        float64 `json:"evalTotalTime"`
+	ResultSortTime       float64 `json:"resultSortTime"`
+	QueryPreparationTime float64 `json:"queryPreparationTime"`
+	InnerEvalTime        float64 `json:"innerEvalTime"`
+	ExecQueueTime        float64 `json:"execQueueTime"`
+	ExecTotalTime        float64 `json:"execTotalTime"`
+}
+
+// QuerySamples models the number of samples loaded by a query.
+type QuerySamples struct {
+	TotalQueryableSamplesPerStep []StepStat `json:"totalQueryableSamplesPerStep,omitempty"`
+	TotalQueryableSamples        int64      `json:"totalQueryableSamples"`
+	PeakSamples                  int        `json:"peakSamples"`
+}
+
+// StepStat is the number of samples loaded at a single evaluation step.
+type StepStat struct {
+	Timestamp model.Time
+	Value     int64
+}
+
+func (s *StepStat) UnmarshalJSON(b []byte) error {
+	var v [2]json.RawMessage
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(v[0], &s.Timestamp); err != nil {
+		return err
+	}
+	return json.Unmarshal(v[1], &s.Value)
 }
 
 // queryResult contains result data for a query.
@@ -99,18 +548,22 @@ type queryResult struct {
 
 	// The decoded value.
 	v model.Value
+	// The decoded stats, if requested.
+	stats *QueryStats
 }
 
 func (qr *queryResult) UnmarshalJSON(b []byte) error {
 	v := struct {
 		Type   model.ValueType `json:"resultType"`
 		Result json.RawMessage `json:"result"`
+		Stats  *QueryStats     `json:"stats"`
 	}{}
 
 	err := json.Unmarshal(b, &v)
 	if err != nil {
 		return err
 	}
+	qr.stats = v.Stats
 
 	switch v.Type {
 	case model.ValScalar:
@@ -137,12 +590,84 @@ func (qr *queryResult) UnmarshalJSON(b []byte) error {
 // NewAPI returns a new API for the client.
 //
 // It is safe to use the returned API from multiple goroutines.
-func NewAPI(c prometheus.Client) API {
-	return &httpAPI{client: apiClient{c}}
+func NewAPI(c prometheus.Client, opts ...APIOption) API {
+	h := &httpAPI{
+		client:        apiClient{c},
+		postThreshold: -1,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// APIOption configures the API returned by NewAPI.
+type APIOption func(*httpAPI)
+
+// WithPostForm makes Query, QueryRange, Labels and Series always send their
+// parameters as an application/x-www-form-urlencoded POST request.
+func WithPostForm() APIOption {
+	return WithPostThreshold(0)
+}
+
+// WithPostThreshold makes Query, QueryRange, Labels and Series send their
+// parameters as an application/x-www-form-urlencoded POST request once the
+// encoded parameters are longer than n bytes. A negative n disables POST.
+func WithPostThreshold(n int) APIOption {
+	return func(h *httpAPI) {
+		h.postThreshold = n
+	}
 }
 
 type httpAPI struct {
-	client prometheus.Client
+	client apiClient
+	// Size of the encoded parameters above which requests are sent as POST.
+	// Negative values always use GET.
+	postThreshold int
+}
+
+// doGetFallback sends args as a form-encoded POST if they exceed the post
+// threshold, and falls back to GET when the server answers 405.
+func (h *httpAPI) doGetFallback(ctx context.Context, u *url.URL, args url.Values) (*http.Response, apiResponse, error) {
+	encoded := args.Encode()
+	if h.usePost(encoded) {
+		req, err := newFormRequest(u, encoded)
+		if err != nil {
+			return nil, apiResponse{}, err
+		}
+
+		resp, result, err := h.client.do(ctx, req)
+		if resp == nil || resp.StatusCode != http.StatusMethodNotAllowed {
+			return resp, result, err
+		}
+	}
+
+	u.RawQuery = encoded
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, apiResponse{}, err
+	}
+	return h.client.do(ctx, req)
+}
+
+func (h *httpAPI) usePost(encoded string) bool {
+	return h.postThreshold >= 0 && len(encoded) > h.postThreshold
+}
+
+// newFormRequest returns a POST request to u carrying the encoded parameters
+// as an application/x-www-form-urlencoded body.
+func newFormRequest(u *url.URL, encoded string) (*http.Request, error) {
+	pu := *u
+	pu.RawQuery = ""
+	req, err := http.NewRequest(http.MethodPost, pu.String(), strings.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Queries are reads, so mark them as safe to retry like GET requests.
+	// net/http does not send the header if its value is nil.
+	req.Header["Idempotency-Key"] = nil
+	return req, nil
 }
 
 func (h *httpAPI) Health(ctx context.Context) (int, error) {
@@ -166,31 +691,129 @@ func (h *httpAPI) Health(ctx context.Context) (int, error) {
 }
 
 func (h *httpAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	res, err := h.QueryDetailed(ctx, query, ts)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (h *httpAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, error) {
+	res, err := h.QueryRangeDetailed(ctx, query, r)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (h *httpAPI) QueryDetailed(ctx context.Context, query string, ts time.Time, opts ...Option) (*QueryResult, error) {
 	u := h.client.URL(epQuery, nil)
 	q := u.Query()
 	q.Set("query", query)
 	q.Set("time", ts.Format(time.RFC3339Nano))
-	u.RawQuery = q.Encode()
+	newQueryOptions(opts).apply(q)
+
+	return h.doQuery(ctx, u, q)
+}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+func (h *httpAPI) QueryRangeDetailed(ctx context.Context, query string, r Range, opts ...Option) (*QueryResult, error) {
+	u := h.client.URL(epQueryRange, nil)
+	q := u.Query()
+	setRangeParams(q, query, r)
+	newQueryOptions(opts).apply(q)
+
+	return h.doQuery(ctx, u, q)
+}
+
+func (h *httpAPI) doQuery(ctx context.Context, u *url.URL, args url.Values) (*QueryResult, error) {
+	_, result, err := h.doGetFallback(ctx, u, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var qres queryResult
+	err = json.Unmarshal(result.Data, &qres)
+
+	return &QueryResult{
+		Value:    qres.v,
+		Warnings: result.Warnings,
+		Infos:    result.Infos,
+		Stats:    qres.stats,
+	}, err
+}
+
+func (h *httpAPI) Labels(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error) {
+	u := h.client.URL(epLabels, nil)
+	q := u.Query()
+	setSeriesParams(q, matches, start, end)
+	newQueryOptions(opts).apply(q)
+
+	_, result, err := h.doGetFallback(ctx, u, q)
 	if err != nil {
 		return nil, err
 	}
+	var labelValues model.LabelValues
+	err = json.Unmarshal(result.Data, &labelValues)
+	return labelValues, err
+}
+
+func (h *httpAPI) LabelValues(ctx context.Context, label string, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error) {
+	u := h.client.URL(epLabelValues, map[string]string{"name": label})
+	q := u.Query()
+	setSeriesParams(q, matches, start, end)
+	newQueryOptions(opts).apply(q)
+	u.RawQuery = q.Encode()
 
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
 	_, body, err := h.client.Do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	var labelValues model.LabelValues
+	err = json.Unmarshal(body, &labelValues)
+	return labelValues, err
+}
 
-	var qres queryResult
-	err = json.Unmarshal(body, &qres)
+func (h *httpAPI) Series(ctx context.Context, matches []string, start, end time.Time, opts ...Option) ([]model.Metric, error) {
+	u := h.client.URL(epSeries, nil)
+	q := u.Query()
+	setSeriesParams(q, matches, start, end)
+	newQueryOptions(opts).apply(q)
 
-	return qres.v, err
+	_, result, err := h.doGetFallback(ctx, u, q)
+	if err != nil {
+		return nil, err
+	}
+	var series []model.Metric
+	err = json.Unmarshal(result.Data, &series)
+	return series, err
 }
 
-func (h *httpAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, error) {
-	u := h.client.URL(epQueryRange, nil)
+func (h *httpAPI) QueryExemplars(ctx context.Context, query string, start, end time.Time) ([]ExemplarQueryResult, error) {
+	u := h.client.URL(epExemplars, nil)
 	q := u.Query()
+	q.Set("query", query)
+	if !start.IsZero() {
+		q.Set("start", start.Format(time.RFC3339Nano))
+	}
+	if !end.IsZero() {
+		q.Set("end", end.Format(time.RFC3339Nano))
+	}
+
+	_, result, err := h.doGetFallback(ctx, u, q)
+	if err != nil {
+		return nil, err
+	}
+	var res []ExemplarQueryResult
+	err = json.Unmarshal(result.Data, &res)
+	return res, err
+}
+
+// setRangeParams sets the parameters of a range query.
+func setRangeParams(q url.Values, query string, r Range) {
 	if !r.Start.IsZero() {
 		q.Set("start", r.Start.Format(time.RFC3339Nano))
 	}
@@ -199,35 +822,78 @@ func (h *httpAPI) QueryRange(ctx context.Context, query string, r Range) (model.
 	}
 	q.Set("query", query)
 	q.Set("step", strconv.FormatFloat(r.Step.Seconds(), 'f', 3, 64))
-	u.RawQuery = q.Encode()
+}
+
+// setSeriesParams sets the match[], start and end parameters shared by the
+// series and label endpoints. Zero times are left out.
+func setSeriesParams(q url.Values, matches []string, start, end time.Time) {
+	if !start.IsZero() {
+		q.Set("start", start.Format(time.RFC3339Nano))
+	}
+	if !end.IsZero() {
+		q.Set("end", end.Format(time.RFC3339Nano))
+	}
+	for _, m := range matches {
+		q.Add("match[]", m)
+	}
+}
+
+func (h *httpAPI) Targets(ctx context.Context) (TargetsResult, error) {
+	u := h.client.URL(epTargets, nil)
 
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, err
+		return TargetsResult{}, err
 	}
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return TargetsResult{}, err
+	}
+	var res TargetsResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
 
+func (h *httpAPI) Rules(ctx context.Context) (RulesResult, error) {
+	u := h.client.URL(epRules, nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return RulesResult{}, err
+	}
 	_, body, err := h.client.Do(ctx, req)
 	if err != nil {
-		return nil, err
+		return RulesResult{}, err
 	}
+	var res RulesResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
 
-	var qres queryResult
-	err = json.Unmarshal(body, &qres)
+func (h *httpAPI) Alerts(ctx context.Context) (AlertsResult, error) {
+	u := h.client.URL(epAlerts, nil)
 
-	return qres.v, err
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return AlertsResult{}, err
+	}
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return AlertsResult{}, err
+	}
+	var res AlertsResult
+	err = json.Unmarshal(body, &res)
+	return res, err
 }
 
-func (h *httpAPI) Labels(ctx context.Context, start, end int64, match string) (model.LabelValues, error) {
-	u := h.client.URL(epLabels, nil)
+func (h *httpAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]Metadata, error) {
+	u := h.client.URL(epMetadata, nil)
 	q := u.Query()
-	if start != 0 {
-		q.Set("start", time.Unix(start, 0).Format(time.RFC3339Nano))
+	if metric != "" {
+		q.Set("metric", metric)
 	}
-	if end != 0 {
-		q.Set("end", time.Unix(end, 0).Format(time.RFC3339Nano))
-	}
-	if match != "" {
-		q.Set("match[]", match)
+	if limit != "" {
+		q.Set("limit", limit)
 	}
 	u.RawQuery = q.Encode()
 
@@ -239,64 +905,93 @@ func (h *httpAPI) Labels(ctx context.Context, start, end int64, match string) (m
 	if err != nil {
 		return nil, err
 	}
-	var labelValues model.LabelValues
-	err = json.Unmarshal(body, &labelValues)
-	return labelValues, err
+	var res map[string][]Metadata
+	err = json.Unmarshal(body, &res)
+	return res, err
 }
 
-func (h *httpAPI) LabelValues(ctx context.Context, start, end int64, label string) (model.LabelValues, error) {
-	u := h.client.URL(epLabelValues, map[string]string{"name": label})
-	q := u.Query()
-	if start != 0 {
-		q.Set("start", time.Unix(start, 0).Format(time.RFC3339Nano))
+func (h *httpAPI) Config(ctx context.Context) (ConfigResult, error) {
+	u := h.client.URL(epConfig, nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return ConfigResult{}, err
 	}
-	if end != 0 {
-		q.Set("end", time.Unix(end, 0).Format(time.RFC3339Nano))
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return ConfigResult{}, err
 	}
-	u.RawQuery = q.Encode()
+	var res ConfigResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+func (h *httpAPI) Flags(ctx context.Context) (FlagsResult, error) {
+	u := h.client.URL(epFlags, nil)
 
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, err
+		return FlagsResult{}, err
 	}
 	_, body, err := h.client.Do(ctx, req)
 	if err != nil {
-		return nil, err
+		return FlagsResult{}, err
 	}
-	var labelValues model.LabelValues
-	err = json.Unmarshal(body, &labelValues)
-	return labelValues, err
+	var res FlagsResult
+	err = json.Unmarshal(body, &res)
+	return res, err
 }
 
-func (h *httpAPI) Series(ctx context.Context, start, end int64, match string) ([]model.Metric, error) {
-	u := h.client.URL(epSeries, nil)
-	q := u.Query()
-	if start != 0 {
-		q.Set("start", time.Unix(start, 0).Format(time.RFC3339Nano))
+func (h *httpAPI) Buildinfo(ctx context.Context) (BuildinfoResult, error) {
+	u := h.client.URL(epBuildinfo, nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return BuildinfoResult{}, err
 	}
-	if end != 0 {
-		q.Set("end", time.Unix(end, 0).Format(time.RFC3339Nano))
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return BuildinfoResult{}, err
 	}
-	if match != "" {
-		q.Set("match[]", match)
+	var res BuildinfoResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+func (h *httpAPI) Runtimeinfo(ctx context.Context) (RuntimeinfoResult, error) {
+	u := h.client.URL(epRuntimeinfo, nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return RuntimeinfoResult{}, err
 	}
-	u.RawQuery = q.Encode()
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return RuntimeinfoResult{}, err
+	}
+	var res RuntimeinfoResult
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+func (h *httpAPI) TSDB(ctx context.Context) (TSDBResult, error) {
+	u := h.client.URL(epTSDB, nil)
 
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, err
+		return TSDBResult{}, err
 	}
 	_, body, err := h.client.Do(ctx, req)
 	if err != nil {
-		return nil, err
+		return TSDBResult{}, err
 	}
-	var series []model.Metric
-	err = json.Unmarshal(body, &series)
-	return series, err
+	var res TSDBResult
+	err = json.Unmarshal(body, &res)
+	return res, err
 }
 
-func (h *httpAPI) Proxy(method string, url string, params map[string]string, data map[string]string) (*grequests.Response, error) {
-	return h.client.Proxy(method, url, params, data)
+func (h *httpAPI) Raw(ctx context.Context, r prometheus.RawRequest) (*http.Response, error) {
+	return h.client.Raw(ctx, r)
 }
 
 // apiClient wraps a regular client and processes successful API responses.
@@ -310,18 +1005,33 @@ type apiResponse struct {
 	Data      json.RawMessage `json:"data"`
 	ErrorType ErrorType       `json:"errorType"`
 	Error     string          `json:"error"`
+	Warnings  Warnings        `json:"warnings,omitempty"`
+	Infos     []string        `json:"infos,omitempty"`
 }
 
 func (c apiClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	resp, result, err := c.do(ctx, req)
+	return resp, result.Data, err
+}
+
+// do processes the response like Do, but returns the whole envelope so
+// that callers can look at the warnings and infos.
+func (c apiClient) do(ctx context.Context, req *http.Request) (*http.Response, apiResponse, error) {
 	resp, body, err := c.Client.Do(ctx, req)
 	if err != nil {
-		return resp, body, err
+		return resp, apiResponse{Data: body}, err
 	}
 
+	result, err := decodeResponse(resp, body)
+	return resp, result, err
+}
+
+// decodeResponse unwraps the API envelope of a fully read response body.
+func decodeResponse(resp *http.Response, body []byte) (apiResponse, error) {
 	code := resp.StatusCode
 
 	if code/100 != 2 && code != statusAPIError {
-		return resp, body, &Error{
+		return apiResponse{Data: body}, &Error{
 			Type: ErrBadResponse,
 			Msg:  fmt.Sprintf("bad response code %d", resp.StatusCode),
 		}
@@ -329,13 +1039,16 @@ func (c apiClient) Do(ctx context.Context, req *http.Request) (*http.Response, [
 
 	var result apiResponse
 
-	if err = json.Unmarshal(body, &result); err != nil {
-		return resp, body, &Error{
-			Type: ErrBadResponse,
-			Msg:  err.Error(),
+	if code != http.StatusNoContent {
+		if err := json.Unmarshal(body, &result); err != nil {
+			return apiResponse{Data: body}, &Error{
+				Type: ErrBadResponse,
+				Msg:  err.Error(),
+			}
 		}
 	}
 
+	var err error
 	if (code == statusAPIError) != (result.Status == "error") {
 		err = &Error{
 			Type: ErrBadResponse,
@@ -350,5 +1063,5 @@ func (c apiClient) Do(ctx context.Context, req *http.Request) (*http.Response, [
 		}
 	}
 
-	return resp, result.Data, err
+	return result, err
 }
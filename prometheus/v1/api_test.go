@@ -0,0 +1,552 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+)
+
+// newTestAPI returns an API talking to a test server that serves h.
+func newTestAPI(t *testing.T, h http.Handler, opts ...APIOption) API {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return NewAPI(c, opts...)
+}
+
+func respondWith(code int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		fmt.Fprint(w, body)
+	})
+}
+
+func TestEndpoints(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		path string
+		data string
+		do   func(API) (interface{}, error)
+		want interface{}
+	}{
+		{
+			name: "targets",
+			path: epTargets,
+			data: `{"activeTargets":[{"discoveredLabels":{"__address__":"h:9090"},"labels":{"job":"prom"},"scrapePool":"prom","scrapeUrl":"http://h:9090/metrics","lastScrape":"2024-01-02T03:04:05Z","lastScrapeDuration":0.5,"health":"up"}],"droppedTargets":[{"discoveredLabels":{"__address__":"x:1"}}]}`,
+			do:   func(a API) (interface{}, error) { return a.Targets(context.Background()) },
+			want: TargetsResult{
+				Active: []ActiveTarget{{
+					DiscoveredLabels:   map[string]string{"__address__": "h:9090"},
+					Labels:             model.LabelSet{"job": "prom"},
+					ScrapePool:         "prom",
+					ScrapeURL:          "http://h:9090/metrics",
+					LastScrape:         ts,
+					LastScrapeDuration: 0.5,
+					Health:             HealthGood,
+				}},
+				Dropped: []DroppedTarget{{DiscoveredLabels: map[string]string{"__address__": "x:1"}}},
+			},
+		},
+		{
+			name: "alerts",
+			path: epAlerts,
+			data: `{"alerts":[{"activeAt":"2024-01-02T03:04:05Z","labels":{"alertname":"Down"},"annotations":{"summary":"down"},"state":"firing","value":"1e+00"}]}`,
+			do:   func(a API) (interface{}, error) { return a.Alerts(context.Background()) },
+			want: AlertsResult{Alerts: []Alert{{
+				ActiveAt:    ts,
+				Labels:      model.LabelSet{"alertname": "Down"},
+				Annotations: model.LabelSet{"summary": "down"},
+				State:       AlertStateFiring,
+				Value:       "1e+00",
+			}}},
+		},
+		{
+			name: "config",
+			path: epConfig,
+			data: `{"yaml":"global: {}\n"}`,
+			do:   func(a API) (interface{}, error) { return a.Config(context.Background()) },
+			want: ConfigResult{YAML: "global: {}\n"},
+		},
+		{
+			name: "flags",
+			path: epFlags,
+			data: `{"log.level":"info"}`,
+			do:   func(a API) (interface{}, error) { return a.Flags(context.Background()) },
+			want: FlagsResult{"log.level": "info"},
+		},
+		{
+			name: "buildinfo",
+			path: epBuildinfo,
+			data: `{"version":"2.50.0","revision":"abc","branch":"HEAD","buildUser":"u","buildDate":"d","goVersion":"go1.21"}`,
+			do:   func(a API) (interface{}, error) { return a.Buildinfo(context.Background()) },
+			want: BuildinfoResult{Version: "2.50.0", Revision: "abc", Branch: "HEAD", BuildUser: "u", BuildDate: "d", GoVersion: "go1.21"},
+		},
+		{
+			name: "runtimeinfo",
+			path: epRuntimeinfo,
+			data: `{"startTime":"2024-01-02T03:04:05Z","CWD":"/","reloadConfigSuccess":true,"goroutineCount":7,"GOMAXPROCS":4,"storageRetention":"15d"}`,
+			do:   func(a API) (interface{}, error) { return a.Runtimeinfo(context.Background()) },
+			want: RuntimeinfoResult{StartTime: ts, CWD: "/", ReloadConfigSuccess: true, GoroutineCount: 7, GOMAXPROCS: 4, StorageRetention: "15d"},
+		},
+		{
+			name: "tsdb",
+			path: epTSDB,
+			data: `{"headStats":{"numSeries":2,"chunkCount":3},"seriesCountByMetricName":[{"name":"up","value":2}]}`,
+			do:   func(a API) (interface{}, error) { return a.TSDB(context.Background()) },
+			want: TSDBResult{
+				HeadStats:               TSDBHeadStats{NumSeries: 2, ChunkCount: 3},
+				SeriesCountByMetricName: []Stat{{Name: "up", Value: 2}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, tc.path, r.URL.Path)
+				fmt.Fprint(w, success(tc.data))
+			}))
+
+			got, err := tc.do(api)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		metric, limit string
+		wantQuery     string
+	}{
+		{wantQuery: ""},
+		{metric: "up", wantQuery: "metric=up"},
+		{metric: "up", limit: "5", wantQuery: "limit=5&metric=up"},
+	} {
+		api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, epMetadata, r.URL.Path)
+			require.Equal(t, tc.wantQuery, r.URL.RawQuery)
+			fmt.Fprint(w, success(`{"up":[{"type":"gauge","help":"Target is up.","unit":""}]}`))
+		}))
+
+		got, err := api.Metadata(context.Background(), tc.metric, tc.limit)
+		require.NoError(t, err)
+		require.Equal(t, map[string][]Metadata{"up": {{Type: MetricTypeGauge, Help: "Target is up."}}}, got)
+	}
+}
+
+func TestRules(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	api := newTestAPI(t, respondWith(http.StatusOK, success(`{"groups":[{
+		"name":"g","file":"rules.yml","interval":60,"evaluationTime":0.1,"lastEvaluation":"2024-01-02T03:04:05Z",
+		"rules":[
+			{"type":"alerting","name":"Down","query":"up == 0","duration":300,"labels":{"severity":"page"},"annotations":{},
+			 "alerts":[{"activeAt":"2024-01-02T03:04:05Z","labels":{"alertname":"Down"},"state":"pending","value":"0"}],
+			 "health":"ok","state":"pending","lastEvaluation":"2024-01-02T03:04:05Z"},
+			{"type":"recording","name":"job:up:sum","query":"sum by (job) (up)","health":"err","lastError":"boom"}
+		]}]}`)))
+
+	got, err := api.Rules(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RulesResult{Groups: []RuleGroup{{
+		Name:           "g",
+		File:           "rules.yml",
+		Interval:       60,
+		EvaluationTime: 0.1,
+		LastEvaluation: ts,
+		Rules: Rules{
+			AlertingRule{
+				Name:        "Down",
+				Query:       "up == 0",
+				Duration:    300,
+				Labels:      model.LabelSet{"severity": "page"},
+				Annotations: model.LabelSet{},
+				Alerts: []*Alert{{
+					ActiveAt: ts,
+					Labels:   model.LabelSet{"alertname": "Down"},
+					State:    AlertStatePending,
+					Value:    "0",
+				}},
+				Health:         RuleHealthGood,
+				State:          "pending",
+				LastEvaluation: ts,
+			},
+			RecordingRule{
+				Name:      "job:up:sum",
+				Query:     "sum by (job) (up)",
+				Health:    RuleHealthBad,
+				LastError: "boom",
+			},
+		},
+	}}}, got)
+}
+
+func TestRuleGroupUnmarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		in      string
+		want    RuleGroup
+		wantErr string
+	}{
+		{
+			name: "no rules",
+			in:   `{"name":"g","rules":[]}`,
+			want: RuleGroup{Name: "g", Rules: Rules{}},
+		},
+		{
+			name:    "unknown rule type",
+			in:      `{"name":"g","rules":[{"type":"other","name":"x"}]}`,
+			wantErr: `unexpected rule type "other"`,
+		},
+		{
+			name:    "missing rule type",
+			in:      `{"name":"g","rules":[{"name":"x"}]}`,
+			wantErr: `unexpected rule type ""`,
+		},
+		{
+			name:    "malformed rule",
+			in:      `{"name":"g","rules":[{"type":"alerting","duration":"5m"}]}`,
+			wantErr: "cannot unmarshal",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rg RuleGroup
+			err := rg.UnmarshalJSON([]byte(tc.in))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, rg)
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	api := newTestAPI(t, respondWith(statusAPIError, `{"status":"error","errorType":"bad_data","error":"invalid parameter"}`))
+
+	_, err := api.Targets(context.Background())
+	require.Equal(t, &Error{Type: ErrBadData, Msg: "invalid parameter"}, err)
+}
+
+func TestQueryDetailed(t *testing.T) {
+	const body = `{"status":"success","warnings":["w1"],"infos":["i1","i2"],"data":{
+		"resultType":"vector",
+		"result":[{"metric":{"__name__":"up"},"value":[1700000000,"1"]}],
+		"stats":{
+			"timings":{"evalTotalTime":0.5,"execTotalTime":1.5},
+			"samples":{"totalQueryableSamplesPerStep":[[1700000000,3],[1700000030,4]],"totalQueryableSamples":7,"peakSamples":4}
+		}}}`
+	ts := time.Unix(1700000000, 0)
+	rng := Range{Start: ts, End: ts.Add(time.Minute), Step: 30 * time.Second}
+
+	wantValue := model.Vector{{Metric: model.Metric{"__name__": "up"}, Value: 1, Timestamp: model.TimeFromUnix(1700000000)}}
+	wantStats := &QueryStats{
+		Timings: QueryTimings{EvalTotalTime: 0.5, ExecTotalTime: 1.5},
+		Samples: &QuerySamples{
+			TotalQueryableSamplesPerStep: []StepStat{
+				{Timestamp: model.TimeFromUnix(1700000000), Value: 3},
+				{Timestamp: model.TimeFromUnix(1700000030), Value: 4},
+			},
+			TotalQueryableSamples: 7,
+			PeakSamples:           4,
+		},
+	}
+
+	for _, tc := range []struct {
+		name string
+		path string
+		do   func(API) (*QueryResult, error)
+	}{
+		{
+			name: "instant",
+			path: epQuery,
+			do: func(a API) (*QueryResult, error) {
+				return a.QueryDetailed(context.Background(), "up", ts, WithStats())
+			},
+		},
+		{
+			name: "range",
+			path: epQueryRange,
+			do: func(a API) (*QueryResult, error) {
+				return a.QueryRangeDetailed(context.Background(), "up", rng, WithStats())
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tc.path, r.URL.Path)
+				require.Equal(t, "all", r.URL.Query().Get("stats"))
+				fmt.Fprint(w, body)
+			}))
+
+			res, err := tc.do(api)
+			require.NoError(t, err)
+			require.Equal(t, &QueryResult{
+				Value:    wantValue,
+				Warnings: Warnings{"w1"},
+				Infos:    []string{"i1", "i2"},
+				Stats:    wantStats,
+			}, res)
+		})
+	}
+}
+
+func TestQueryWithoutStats(t *testing.T) {
+	api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.URL.Query()["stats"]
+		require.False(t, ok)
+		fmt.Fprint(w, success(`{"resultType":"scalar","result":[1700000000,"2"]}`))
+	}))
+
+	res, err := api.QueryDetailed(context.Background(), "2", time.Unix(1700000000, 0))
+	require.NoError(t, err)
+	require.Equal(t, &QueryResult{Value: &model.Scalar{Value: 2, Timestamp: model.TimeFromUnix(1700000000)}}, res)
+
+	v, err := api.Query(context.Background(), "2", time.Unix(1700000000, 0))
+	require.NoError(t, err)
+	require.Equal(t, res.Value, v)
+}
+
+func TestQueryDetailedError(t *testing.T) {
+	api := newTestAPI(t, respondWith(statusAPIError, `{"status":"error","errorType":"execution","error":"boom","warnings":["w1"]}`))
+
+	_, err := api.QueryDetailed(context.Background(), "up", time.Unix(1700000000, 0))
+	require.Equal(t, &Error{Type: ErrExec, Msg: "boom"}, err)
+}
+
+func TestStepStatUnmarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    StepStat
+		wantErr bool
+	}{
+		{in: `[1700000000,3]`, want: StepStat{Timestamp: model.TimeFromUnix(1700000000), Value: 3}},
+		{in: `[1700000000.5,0]`, want: StepStat{Timestamp: model.TimeFromUnixNano(1700000000500000000)}},
+		{in: `{"timestamp":1}`, wantErr: true},
+		{in: `[1700000000,"3"]`, wantErr: true},
+	} {
+		var s StepStat
+		err := s.UnmarshalJSON([]byte(tc.in))
+		if tc.wantErr {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, s, tc.in)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestPostThreshold(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	long := "up{job=\"" + strings.Repeat("a", 64) + "\"}"
+
+	for _, tc := range []struct {
+		name     string
+		opts     []APIOption
+		query    string
+		wantPost bool
+	}{
+		{name: "default", query: long},
+		{name: "post form", opts: []APIOption{WithPostForm()}, query: "up", wantPost: true},
+		{name: "below threshold", opts: []APIOption{WithPostThreshold(64)}, query: "up"},
+		{name: "above threshold", opts: []APIOption{WithPostThreshold(64)}, query: long, wantPost: true},
+		{name: "disabled", opts: []APIOption{WithPostThreshold(-1)}, query: long},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.wantPost {
+					require.Equal(t, http.MethodPost, r.Method)
+					require.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+					require.Empty(t, r.URL.RawQuery)
+					require.NoError(t, r.ParseForm())
+					require.Equal(t, tc.query, r.PostForm.Get("query"))
+				} else {
+					require.Equal(t, http.MethodGet, r.Method)
+					require.Equal(t, tc.query, r.URL.Query().Get("query"))
+				}
+				require.Empty(t, r.Header.Values("Idempotency-Key"))
+				fmt.Fprint(w, success(`{"resultType":"vector","result":[]}`))
+			}))
+			defer srv.Close()
+
+			var sawKey bool
+			c, err := prometheus.NewClient(prometheus.Config{
+				Address: srv.URL,
+				RoundTripper: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					v, ok := req.Header["Idempotency-Key"]
+					sawKey = ok && v == nil
+					return http.DefaultTransport.RoundTrip(req)
+				}),
+			})
+			require.NoError(t, err)
+
+			v, err := NewAPI(c, tc.opts...).Query(context.Background(), tc.query, ts)
+			require.NoError(t, err)
+			require.Equal(t, model.Vector{}, v)
+			require.Equal(t, tc.wantPost, sawKey)
+		})
+	}
+}
+
+func TestPostFallbackToGet(t *testing.T) {
+	var methods []string
+	api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		require.Equal(t, "up", r.URL.Query().Get("match[]"))
+		fmt.Fprint(w, success(`["instance","job"]`))
+	}), WithPostForm())
+
+	got, err := api.Labels(context.Background(), []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelValues{"instance", "job"}, got)
+	require.Equal(t, []string{http.MethodPost, http.MethodGet}, methods)
+}
+
+func TestPostErrorNoFallback(t *testing.T) {
+	var methods []string
+	api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.WriteHeader(statusAPIError)
+		fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	}), WithPostForm())
+
+	_, err := api.Series(context.Background(), []string{"up{"}, time.Time{}, time.Time{})
+	require.Equal(t, &Error{Type: ErrBadData, Msg: "parse error"}, err)
+	require.Equal(t, []string{http.MethodPost}, methods)
+}
+
+func TestSeriesParams(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	end := start.Add(time.Hour)
+	matches := []string{`up{job="a"}`, `process_start_time_seconds`}
+
+	for _, tc := range []struct {
+		name string
+		path string
+		data string
+		do   func(API, []string, time.Time, time.Time, ...Option) (interface{}, error)
+		want interface{}
+	}{
+		{
+			name: "labels",
+			path: epLabels,
+			data: `["__name__","job"]`,
+			do: func(a API, m []string, s, e time.Time, opts ...Option) (interface{}, error) {
+				return a.Labels(context.Background(), m, s, e, opts...)
+			},
+			want: model.LabelValues{"__name__", "job"},
+		},
+		{
+			name: "label values",
+			path: "/api/v1/label/job/values",
+			data: `["a","b"]`,
+			do: func(a API, m []string, s, e time.Time, opts ...Option) (interface{}, error) {
+				return a.LabelValues(context.Background(), "job", m, s, e, opts...)
+			},
+			want: model.LabelValues{"a", "b"},
+		},
+		{
+			name: "series",
+			path: epSeries,
+			data: `[{"__name__":"up","job":"a"}]`,
+			do: func(a API, m []string, s, e time.Time, opts ...Option) (interface{}, error) {
+				return a.Series(context.Background(), m, s, e, opts...)
+			},
+			want: []model.Metric{{"__name__": "up", "job": "a"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got url.Values
+			api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tc.path, r.URL.Path)
+				got = r.URL.Query()
+				fmt.Fprint(w, success(tc.data))
+			}))
+
+			res, err := tc.do(api, matches, start, end, WithLimit(10))
+			require.NoError(t, err)
+			require.Equal(t, tc.want, res)
+			require.Equal(t, url.Values{
+				"match[]": matches,
+				"start":   {"2024-01-02T03:04:05.5Z"},
+				"end":     {"2024-01-02T04:04:05.5Z"},
+				"limit":   {"10"},
+			}, got)
+
+			// Zero times, no selectors and no limit leave the parameters out.
+			_, err = tc.do(api, nil, time.Time{}, time.Time{})
+			require.NoError(t, err)
+			require.Empty(t, got)
+		})
+	}
+}
+
+func TestQueryExemplars(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	var got url.Values
+	api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, epExemplars, r.URL.Path)
+		got = r.URL.Query()
+		fmt.Fprint(w, success(`[{
+			"seriesLabels":{"__name__":"http_requests_total","job":"api"},
+			"exemplars":[
+				{"labels":{"trace_id":"abc"},"value":"6","timestamp":1700000000.123},
+				{"labels":{"trace_id":"def"},"value":"19","timestamp":1700000001}
+			]}]`))
+	}))
+
+	res, err := api.QueryExemplars(context.Background(), "http_requests_total", start, end)
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"query": {"http_requests_total"},
+		"start": {"2024-01-02T03:04:05Z"},
+		"end":   {"2024-01-02T04:04:05Z"},
+	}, got)
+	require.Equal(t, []ExemplarQueryResult{{
+		SeriesLabels: labels.FromStrings("__name__", "http_requests_total", "job", "api"),
+		Exemplars: []Exemplar{
+			{Labels: labels.FromStrings("trace_id", "abc"), Value: 6, Timestamp: model.TimeFromUnixNano(1700000000123000000)},
+			{Labels: labels.FromStrings("trace_id", "def"), Value: 19, Timestamp: model.TimeFromUnix(1700000001)},
+		},
+	}}, res)
+
+	_, err = api.QueryExemplars(context.Background(), "up", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, url.Values{"query": {"up"}}, got)
+}
+
+func TestQueryExemplarsError(t *testing.T) {
+	api := newTestAPI(t, respondWith(statusAPIError, `{"status":"error","errorType":"bad_data","error":"invalid query"}`))
+
+	res, err := api.QueryExemplars(context.Background(), "up{", time.Time{}, time.Time{})
+	require.Nil(t, res)
+	require.Equal(t, &Error{Type: ErrBadData, Msg: "invalid query"}, err)
+}
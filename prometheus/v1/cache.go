@@ -0,0 +1,282 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liticer/gclients/prometheus/parser"
+
+	"github.com/prometheus/common/model"
+)
+
+// Extent is the cached result of a range query for the evaluation
+// timestamps between Start and End, both inclusive.
+type Extent struct {
+	Start, End time.Time
+	Matrix     model.Matrix
+}
+
+// ResultCache stores the extents of range query results. Implementations
+// must be safe for concurrent use.
+type ResultCache interface {
+	// Get returns the extents stored under key.
+	Get(ctx context.Context, key string) ([]Extent, bool)
+	// Put replaces the extents stored under key. The extents are sorted by
+	// start and don't overlap.
+	Put(ctx context.Context, key string, extents []Extent)
+}
+
+// NewLRUCache returns an in-memory ResultCache holding the extents of at
+// most size keys, evicting the least recently used ones.
+func NewLRUCache(size int) ResultCache {
+	return &lruCache{
+		size:  size,
+		items: map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+type lruCache struct {
+	size int
+
+	mtx   sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	extents []Extent
+}
+
+func (c *lruCache) Get(_ context.Context, key string) ([]Extent, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).extents, true
+}
+
+func (c *lruCache) Put(_ context.Context, key string, extents []Extent) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).extents = extents
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, extents: extents})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+// CacheConfig configures NewCachingAPI.
+type CacheConfig struct {
+	// The store of the cached extents. Defaults to NewLRUCache(1000).
+	Cache ResultCache
+
+	// Results for evaluation timestamps within MaxFreshness before now are
+	// never cached, as they may still change with samples being ingested.
+	// Defaults to 10m.
+	MaxFreshness time.Duration
+}
+
+// NewCachingAPI returns an API caching the results of QueryRange and
+// QueryRangeDetailed. Results are cached as extents keyed by the normalized
+// query, the step and the alignment of the range to the step, so that only
+// the parts of a range missing from the cache, e.g. the head and the tail of
+// a sliding window, are fetched from api. All other calls are passed through.
+//
+// Queries with options and sub-results with warnings are not cached. The
+// returned matrices share the label sets with the cache and must not be
+// modified.
+func NewCachingAPI(api API, cfg CacheConfig) API {
+	if cfg.Cache == nil {
+		cfg.Cache = NewLRUCache(1000)
+	}
+	if cfg.MaxFreshness <= 0 {
+		cfg.MaxFreshness = 10 * time.Minute
+	}
+	return &cachingAPI{API: api, cfg: cfg}
+}
+
+type cachingAPI struct {
+	API
+	cfg CacheConfig
+}
+
+func (c *cachingAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, error) {
+	res, err := c.QueryRangeDetailed(ctx, query, r)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (c *cachingAPI) QueryRangeDetailed(ctx context.Context, query string, r Range, opts ...Option) (*QueryResult, error) {
+	if len(opts) > 0 || r.Step <= 0 || r.End.Before(r.Start) {
+		return c.API.QueryRangeDetailed(ctx, query, r, opts...)
+	}
+
+	key := cacheKey(query, r)
+	extents, _ := c.cfg.Cache.Get(ctx, key)
+
+	// The last evaluation timestamp which may be cached.
+	maxCacheable := time.Now().Add(-c.cfg.MaxFreshness)
+
+	var (
+		parts   []*QueryResult
+		starts  []time.Time
+		updated = append([]Extent(nil), extents...)
+	)
+	for _, e := range extents {
+		if e.End.Before(r.Start) || e.Start.After(r.End) {
+			continue
+		}
+		parts = append(parts, &QueryResult{Value: trimMatrix(e.Matrix, r.Start, r.End)})
+		starts = append(starts, e.Start)
+	}
+	for _, gap := range missingRanges(r, extents) {
+		res, err := c.API.QueryRangeDetailed(ctx, query, gap)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := res.Value.(model.Matrix)
+		if !ok {
+			return nil, fmt.Errorf("unexpected result type %s of range query", res.Value.Type())
+		}
+		parts = append(parts, res)
+		starts = append(starts, gap.Start)
+
+		if len(res.Warnings) > 0 || gap.Start.After(maxCacheable) {
+			continue
+		}
+		end := gap.End
+		if end.After(maxCacheable) {
+			end = gap.Start.Add(maxCacheable.Sub(gap.Start) / r.Step * r.Step)
+			m = trimMatrix(m, gap.Start, end)
+		}
+		updated = append(updated, Extent{Start: gap.Start, End: end, Matrix: m})
+	}
+
+	if len(updated) > len(extents) {
+		c.cfg.Cache.Put(ctx, key, mergeExtents(updated, r.Step))
+	}
+
+	sort.Sort(byStart{parts, starts})
+	return mergeQueryResults(parts), nil
+}
+
+// cacheKey returns the key of the extents holding results for the query
+// with the step and the alignment of r.
+func cacheKey(query string, r Range) string {
+	if expr, err := parser.ParseExpr(query); err == nil {
+		query = expr.String()
+	} else {
+		query = strings.TrimSpace(query)
+	}
+	offset := time.Duration(r.Start.UnixNano()) % r.Step
+	return fmt.Sprintf("%s:%d:%d", query, r.Step, offset)
+}
+
+// missingRanges returns the parts of r not covered by the given extents,
+// which are sorted by start and don't overlap.
+func missingRanges(r Range, extents []Extent) []Range {
+	var (
+		gaps []Range
+		cur  = r.Start
+	)
+	for _, e := range extents {
+		if e.End.Before(cur) {
+			continue
+		}
+		if e.Start.After(r.End) {
+			break
+		}
+		if e.Start.After(cur) {
+			gaps = append(gaps, Range{Start: cur, End: e.Start.Add(-r.Step), Step: r.Step})
+		}
+		cur = e.End.Add(r.Step)
+	}
+	if !cur.After(r.End) {
+		gaps = append(gaps, Range{Start: cur, End: r.End, Step: r.Step})
+	}
+	return gaps
+}
+
+// mergeExtents sorts the extents by start and merges the overlapping and
+// adjacent ones.
+func mergeExtents(extents []Extent, step time.Duration) []Extent {
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].Start.Before(extents[j].Start)
+	})
+
+	merged := extents[:1]
+	for _, e := range extents[1:] {
+		last := &merged[len(merged)-1]
+		if e.Start.After(last.End.Add(step)) {
+			merged = append(merged, e)
+			continue
+		}
+		if e.End.After(last.End) {
+			m := mergeQueryResults([]*QueryResult{{Value: last.Matrix}, {Value: e.Matrix}})
+			last.Matrix = m.Value.(model.Matrix)
+			last.End = e.End
+		}
+	}
+	return merged
+}
+
+// trimMatrix returns the samples of m between start and end, leaving out
+// series without any samples in between.
+func trimMatrix(m model.Matrix, start, end time.Time) model.Matrix {
+	mint, maxt := model.TimeFromUnixNano(start.UnixNano()), model.TimeFromUnixNano(end.UnixNano())
+
+	res := make(model.Matrix, 0, len(m))
+	for _, ss := range m {
+		trimmed := &model.SampleStream{Metric: ss.Metric}
+		for _, s := range ss.Values {
+			if !s.Timestamp.Before(mint) && !s.Timestamp.After(maxt) {
+				trimmed.Values = append(trimmed.Values, s)
+			}
+		}
+		for _, h := range ss.Histograms {
+			if !h.Timestamp.Before(mint) && !h.Timestamp.After(maxt) {
+				trimmed.Histograms = append(trimmed.Histograms, h)
+			}
+		}
+		if len(trimmed.Values) > 0 || len(trimmed.Histograms) > 0 {
+			res = append(res, trimmed)
+		}
+	}
+	return res
+}
+
+// byStart sorts query results by the start of their ranges.
+type byStart struct {
+	results []*QueryResult
+	starts  []time.Time
+}
+
+func (b byStart) Len() int           { return len(b.results) }
+func (b byStart) Less(i, j int) bool { return b.starts[i].Before(b.starts[j]) }
+func (b byStart) Swap(i, j int) {
+	b.results[i], b.results[j] = b.results[j], b.results[i]
+	b.starts[i], b.starts[j] = b.starts[j], b.starts[i]
+}
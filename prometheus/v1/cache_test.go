@@ -0,0 +1,279 @@
+package v1
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+var cacheBase = time.Unix(1700000000, 0)
+
+// at returns the n-th minute after cacheBase.
+func at(n int) time.Time {
+	return cacheBase.Add(time.Duration(n) * time.Minute)
+}
+
+// minuteMatrix returns a matrix with a single series holding a sample at
+// every minute between from and to, valued with its minute.
+func minuteMatrix(from, to int) model.Matrix {
+	ss := &model.SampleStream{Metric: model.Metric{"__name__": "up"}}
+	for i := from; i <= to; i++ {
+		ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(at(i).UnixNano()), Value: model.SampleValue(i)})
+	}
+	return model.Matrix{ss}
+}
+
+func TestMissingRanges(t *testing.T) {
+	r := Range{Start: at(0), End: at(10), Step: time.Minute}
+	for _, tc := range []struct {
+		name     string
+		extents  []Extent
+		expected []Range
+	}{
+		{
+			name:     "empty",
+			expected: []Range{r},
+		},
+		{
+			name:    "covered",
+			extents: []Extent{{Start: at(-5), End: at(15)}},
+		},
+		{
+			name:    "exactly covered",
+			extents: []Extent{{Start: at(0), End: at(10)}},
+		},
+		{
+			name:    "head and tail",
+			extents: []Extent{{Start: at(3), End: at(6)}},
+			expected: []Range{
+				{Start: at(0), End: at(2), Step: time.Minute},
+				{Start: at(7), End: at(10), Step: time.Minute},
+			},
+		},
+		{
+			name:     "adjacent extents",
+			extents:  []Extent{{Start: at(0), End: at(4)}, {Start: at(5), End: at(8)}},
+			expected: []Range{{Start: at(9), End: at(10), Step: time.Minute}},
+		},
+		{
+			name:     "one step between extents",
+			extents:  []Extent{{Start: at(0), End: at(4)}, {Start: at(6), End: at(10)}},
+			expected: []Range{{Start: at(5), End: at(5), Step: time.Minute}},
+		},
+		{
+			name:     "extent ending at start",
+			extents:  []Extent{{Start: at(-5), End: at(0)}},
+			expected: []Range{{Start: at(1), End: at(10), Step: time.Minute}},
+		},
+		{
+			name:     "extent starting at end",
+			extents:  []Extent{{Start: at(10), End: at(20)}},
+			expected: []Range{{Start: at(0), End: at(9), Step: time.Minute}},
+		},
+		{
+			name:     "extents outside",
+			extents:  []Extent{{Start: at(-10), End: at(-1)}, {Start: at(11), End: at(20)}},
+			expected: []Range{r},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, missingRanges(r, tc.extents))
+		})
+	}
+}
+
+func TestMergeExtents(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		extents  []Extent
+		expected []Extent
+	}{
+		{
+			name:     "single",
+			extents:  []Extent{{Start: at(0), End: at(3), Matrix: minuteMatrix(0, 3)}},
+			expected: []Extent{{Start: at(0), End: at(3), Matrix: minuteMatrix(0, 3)}},
+		},
+		{
+			name: "adjacent",
+			extents: []Extent{
+				{Start: at(4), End: at(6), Matrix: minuteMatrix(4, 6)},
+				{Start: at(0), End: at(3), Matrix: minuteMatrix(0, 3)},
+			},
+			expected: []Extent{{Start: at(0), End: at(6), Matrix: minuteMatrix(0, 6)}},
+		},
+		{
+			name: "one step apart",
+			extents: []Extent{
+				{Start: at(0), End: at(3), Matrix: minuteMatrix(0, 3)},
+				{Start: at(5), End: at(6), Matrix: minuteMatrix(5, 6)},
+			},
+			expected: []Extent{
+				{Start: at(0), End: at(3), Matrix: minuteMatrix(0, 3)},
+				{Start: at(5), End: at(6), Matrix: minuteMatrix(5, 6)},
+			},
+		},
+		{
+			name: "overlapping",
+			extents: []Extent{
+				{Start: at(0), End: at(5), Matrix: minuteMatrix(0, 5)},
+				{Start: at(3), End: at(8), Matrix: minuteMatrix(3, 8)},
+			},
+			expected: []Extent{{Start: at(0), End: at(8), Matrix: minuteMatrix(0, 8)}},
+		},
+		{
+			name: "contained",
+			extents: []Extent{
+				{Start: at(0), End: at(8), Matrix: minuteMatrix(0, 8)},
+				{Start: at(2), End: at(4), Matrix: minuteMatrix(2, 4)},
+				{Start: at(10), End: at(12), Matrix: minuteMatrix(10, 12)},
+			},
+			expected: []Extent{
+				{Start: at(0), End: at(8), Matrix: minuteMatrix(0, 8)},
+				{Start: at(10), End: at(12), Matrix: minuteMatrix(10, 12)},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, mergeExtents(tc.extents, time.Minute))
+		})
+	}
+}
+
+func TestTrimMatrix(t *testing.T) {
+	m := append(minuteMatrix(0, 10), &model.SampleStream{
+		Metric: model.Metric{"__name__": "late"},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnixNano(at(20).UnixNano()), Value: 1}},
+	}, &model.SampleStream{
+		Metric: model.Metric{"__name__": "hist"},
+		Histograms: []model.SampleHistogramPair{
+			{Timestamp: model.TimeFromUnixNano(at(2).UnixNano()), Histogram: &model.SampleHistogram{Count: 1}},
+			{Timestamp: model.TimeFromUnixNano(at(9).UnixNano()), Histogram: &model.SampleHistogram{Count: 2}},
+		},
+	})
+
+	// Both ends are inclusive, series without samples in between are dropped.
+	require.Equal(t, model.Matrix{
+		minuteMatrix(2, 5)[0],
+		{
+			Metric:     model.Metric{"__name__": "hist"},
+			Histograms: []model.SampleHistogramPair{{Timestamp: model.TimeFromUnixNano(at(2).UnixNano()), Histogram: &model.SampleHistogram{Count: 1}}},
+		},
+	}, trimMatrix(m, at(2), at(5)))
+	require.Empty(t, trimMatrix(m, at(11), at(19)))
+}
+
+func TestCachingAPI(t *testing.T) {
+	result := func(r Range) model.Matrix {
+		ss := &model.SampleStream{Metric: model.Metric{"__name__": "up"}}
+		for _, ts := range evalTimes(r) {
+			ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: model.SampleValue(ts.Unix())})
+		}
+		return model.Matrix{ss}
+	}
+	var (
+		mtx     sync.Mutex
+		fetched []Range
+	)
+	upstream := &rangeFuncAPI{fn: func(_ context.Context, r Range) (*QueryResult, error) {
+		mtx.Lock()
+		fetched = append(fetched, r)
+		mtx.Unlock()
+		return &QueryResult{Value: result(r)}, nil
+	}}
+	query := func(api API, r Range) {
+		t.Helper()
+		mtx.Lock()
+		fetched = nil
+		mtx.Unlock()
+
+		v, err := api.QueryRange(context.Background(), "up", r)
+		require.NoError(t, err)
+		require.Equal(t, result(r), v)
+	}
+
+	t.Run("sliding window", func(t *testing.T) {
+		api := NewCachingAPI(upstream, CacheConfig{})
+		r := Range{Start: at(0), End: at(60), Step: time.Minute}
+
+		query(api, r)
+		require.Equal(t, []Range{r}, fetched)
+
+		query(api, r)
+		require.Empty(t, fetched)
+
+		// Only the head and the tail missing from the cache are fetched.
+		query(api, Range{Start: at(-10), End: at(70), Step: time.Minute})
+		require.Equal(t, []Range{
+			{Start: at(-10), End: at(-1), Step: time.Minute},
+			{Start: at(61), End: at(70), Step: time.Minute},
+		}, fetched)
+
+		query(api, Range{Start: at(-5), End: at(65), Step: time.Minute})
+		require.Empty(t, fetched)
+	})
+
+	t.Run("different alignment", func(t *testing.T) {
+		api := NewCachingAPI(upstream, CacheConfig{})
+		r := Range{Start: at(0), End: at(60), Step: time.Minute}
+		query(api, r)
+
+		shifted := Range{Start: at(0).Add(30 * time.Second), End: at(60).Add(30 * time.Second), Step: time.Minute}
+		query(api, shifted)
+		require.Equal(t, []Range{shifted}, fetched)
+	})
+
+	t.Run("freshness cutoff", func(t *testing.T) {
+		api := NewCachingAPI(upstream, CacheConfig{MaxFreshness: 10 * time.Minute})
+		now := time.Now().Truncate(time.Minute)
+		r := Range{Start: now.Add(-time.Hour), End: now, Step: time.Minute}
+
+		query(api, r)
+		require.Equal(t, []Range{r}, fetched)
+
+		// The evaluation timestamps within MaxFreshness before now were not
+		// cached and are fetched again.
+		query(api, r)
+		require.Len(t, fetched, 1)
+		require.True(t, fetched[0].End.Equal(r.End))
+		require.True(t, fetched[0].Start.After(now.Add(-10*time.Minute)), "fetched %v", fetched[0])
+		require.False(t, fetched[0].Start.After(now.Add(-8*time.Minute)), "fetched %v", fetched[0])
+
+		// Ranges entirely within MaxFreshness are never cached.
+		fresh := Range{Start: now.Add(-5 * time.Minute), End: now, Step: time.Minute}
+		query(api, fresh)
+		query(api, fresh)
+		require.Equal(t, []Range{fresh}, fetched)
+	})
+
+	t.Run("options bypass the cache", func(t *testing.T) {
+		api := NewCachingAPI(upstream, CacheConfig{})
+		r := Range{Start: at(0), End: at(10), Step: time.Minute}
+		query(api, r)
+
+		_, err := api.QueryRangeDetailed(context.Background(), "up", r, WithStats())
+		require.NoError(t, err)
+		require.Equal(t, []Range{r}, fetched[1:])
+	})
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	ctx := context.Background()
+
+	c.Put(ctx, "a", []Extent{{Start: at(0)}})
+	c.Put(ctx, "b", []Extent{{Start: at(1)}})
+	_, ok := c.Get(ctx, "a")
+	require.True(t, ok)
+
+	// b is the least recently used key now.
+	c.Put(ctx, "c", []Extent{{Start: at(2)}})
+	_, ok = c.Get(ctx, "b")
+	require.False(t, ok)
+	e, ok := c.Get(ctx, "a")
+	require.True(t, ok)
+	require.Equal(t, []Extent{{Start: at(0)}}, e)
+}
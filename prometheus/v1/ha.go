@@ -0,0 +1,664 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liticer/gclients/prometheus"
+
+	"github.com/prometheus/common/model"
+)
+
+// HAConfig configures the API returned by NewHAAPI.
+type HAConfig struct {
+	// The label distinguishing the replicas of a HA pair, usually an
+	// external label. It is removed from all returned series and label
+	// names, and has no label values. Defaults to "replica".
+	ReplicaLabel string
+
+	// OnBackendError is called with the name and error of every backend that
+	// fails a merged call (Query, QueryRange, Labels, LabelValues and Series)
+	// while the call succeeds for other backends. It may be called
+	// concurrently by parallel calls.
+	OnBackendError func(backend string, err error)
+}
+
+// NewHAAPI returns an API querying all of the given clients concurrently,
+// e.g. the replicas of HA Prometheus pairs. A call only fails if it fails
+// for all clients, in which case the error of the first client is returned.
+//
+// Query, QueryRange, Labels, LabelValues and Series merge the results of all
+// clients. Series which only differ in the replica label are deduplicated:
+//   - For vectors, the sample of the first client returning the series is used.
+//   - For range query results, the samples of all replicas are merged, so
+//     that a gap of one replica is filled by another one. If replicas have a
+//     sample at the same timestamp, the one of the first client is used.
+//   - For range vectors of instant queries, the replica with the most samples
+//     is used, as the raw samples of different replicas are not aligned.
+//
+// The errors of the failed clients are added to the warnings of
+// QueryDetailed and QueryRangeDetailed, as are the results of clients
+// returning another value type than the first successful client. Labels,
+// LabelValues and Series have no warnings; their partial failures are only
+// reported through HAConfig.OnBackendError.
+//
+// All other calls return the result of the first client that succeeds.
+func NewHAAPI(clients []prometheus.Client, cfg HAConfig) API {
+	if cfg.ReplicaLabel == "" {
+		cfg.ReplicaLabel = "replica"
+	}
+	h := &haAPI{cfg: cfg}
+	for _, c := range clients {
+		h.backends = append(h.backends, haBackend{
+			name: c.URL("", nil).String(),
+			api:  &httpAPI{client: apiClient{c}, postThreshold: -1},
+		})
+	}
+	return h
+}
+
+type haAPI struct {
+	cfg      HAConfig
+	backends []haBackend
+}
+
+type haBackend struct {
+	name string
+	api  API
+}
+
+// all calls f for every backend concurrently and returns the errors by
+// backend. The result of a backend is stored by f at index i. An error is
+// returned if f failed for all backends, otherwise the errors of the failed
+// backends are passed to HAConfig.OnBackendError.
+func (h *haAPI) all(ctx context.Context, f func(ctx context.Context, i int, api API) error) ([]error, error) {
+	if len(h.backends) == 0 {
+		return nil, fmt.Errorf("no backends configured")
+	}
+
+	errs := make([]error, len(h.backends))
+	var wg sync.WaitGroup
+	for i, b := range h.backends {
+		wg.Add(1)
+		go func(i int, api API) {
+			defer wg.Done()
+			errs[i] = f(ctx, i, api)
+		}(i, b.api)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			h.reportErrors(errs)
+			return errs, nil
+		}
+	}
+	return errs, errs[0]
+}
+
+// reportErrors passes the errors of the failed backends to HAConfig.OnBackendError.
+func (h *haAPI) reportErrors(errs []error) {
+	if h.cfg.OnBackendError == nil {
+		return
+	}
+	for i, err := range errs {
+		if err != nil {
+			h.cfg.OnBackendError(h.backends[i].name, err)
+		}
+	}
+}
+
+// first calls f for every backend concurrently and returns the index of the
+// first backend f succeeds for. The calls for the other backends are canceled.
+// The context of the returned backend stays valid until release is called.
+// If f also succeeds for other backends before they are canceled, discard is
+// called with their index if it is non-nil.
+func (h *haAPI) first(ctx context.Context, f func(ctx context.Context, i int, api API) error, discard func(i int)) (winner int, release func(), err error) {
+	if len(h.backends) == 0 {
+		return 0, nil, fmt.Errorf("no backends configured")
+	}
+
+	type result struct {
+		i   int
+		err error
+	}
+	var (
+		results = make(chan result, len(h.backends))
+		cancels = make([]context.CancelFunc, len(h.backends))
+	)
+	for i, b := range h.backends {
+		var bctx context.Context
+		bctx, cancels[i] = context.WithCancel(ctx)
+		go func(i int, api API) {
+			results <- result{i: i, err: f(bctx, i, api)}
+		}(i, b.api)
+	}
+
+	var (
+		errs      = make([]error, len(h.backends))
+		succeeded []int
+	)
+	winner = -1
+	for range h.backends {
+		res := <-results
+		errs[res.i] = res.err
+		if res.err != nil {
+			continue
+		}
+		if winner < 0 {
+			winner = res.i
+			for i, cancel := range cancels {
+				if i != winner {
+					cancel()
+				}
+			}
+			continue
+		}
+		succeeded = append(succeeded, res.i)
+	}
+
+	if winner < 0 {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		return 0, nil, errs[0]
+	}
+	if discard != nil {
+		for _, i := range succeeded {
+			discard(i)
+		}
+	}
+	return winner, cancels[winner], nil
+}
+
+// warnings returns the errors of the failed backends as warnings.
+func (h *haAPI) warnings(errs []error) Warnings {
+	var ws Warnings
+	for i, err := range errs {
+		if err != nil {
+			ws = append(ws, fmt.Sprintf("backend %s: %s", h.backends[i].name, err))
+		}
+	}
+	return ws
+}
+
+func (h *haAPI) Health(ctx context.Context) (int, error) {
+	codes := make([]int, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		codes[i], err = api.Health(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	release()
+	return codes[i], nil
+}
+
+func (h *haAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	res, err := h.QueryDetailed(ctx, query, ts)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (h *haAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, error) {
+	res, err := h.QueryRangeDetailed(ctx, query, r)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (h *haAPI) QueryDetailed(ctx context.Context, query string, ts time.Time, opts ...Option) (*QueryResult, error) {
+	return h.query(ctx, false, func(ctx context.Context, api API) (*QueryResult, error) {
+		return api.QueryDetailed(ctx, query, ts, opts...)
+	})
+}
+
+func (h *haAPI) QueryRangeDetailed(ctx context.Context, query string, r Range, opts ...Option) (*QueryResult, error) {
+	return h.query(ctx, true, func(ctx context.Context, api API) (*QueryResult, error) {
+		return api.QueryRangeDetailed(ctx, query, r, opts...)
+	})
+}
+
+func (h *haAPI) query(ctx context.Context, aligned bool, f func(ctx context.Context, api API) (*QueryResult, error)) (*QueryResult, error) {
+	results := make([]*QueryResult, len(h.backends))
+	errs, err := h.all(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = f(ctx, api)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		merged  = &QueryResult{Warnings: h.warnings(errs)}
+		values  []model.Value
+		seenMsg = map[string]struct{}{}
+	)
+	for i, res := range results {
+		if res == nil {
+			continue
+		}
+		if len(values) > 0 && res.Value.Type() != values[0].Type() {
+			merged.Warnings = append(merged.Warnings, fmt.Sprintf("backend %s: unexpected result type %s, expected %s", h.backends[i].name, res.Value.Type(), values[0].Type()))
+			continue
+		}
+		values = append(values, res.Value)
+
+		for _, w := range res.Warnings {
+			if _, ok := seenMsg[w]; !ok {
+				seenMsg[w] = struct{}{}
+				merged.Warnings = append(merged.Warnings, w)
+			}
+		}
+		for _, info := range res.Infos {
+			if _, ok := seenMsg[info]; !ok {
+				seenMsg[info] = struct{}{}
+				merged.Infos = append(merged.Infos, info)
+			}
+		}
+		merged.Stats = mergeQueryStats(merged.Stats, res.Stats)
+	}
+	merged.Value = h.dedup(values, aligned)
+	return merged, nil
+}
+
+// dedup merges the values returned by the backends into one, deduplicating
+// the series of replicas. If aligned is set, the samples of matrices are
+// aligned to the steps of a range query.
+func (h *haAPI) dedup(values []model.Value, aligned bool) model.Value {
+	switch v := values[0].(type) {
+	case model.Vector:
+		var (
+			vec  = model.Vector{}
+			seen = map[model.Fingerprint]struct{}{}
+		)
+		for _, val := range values {
+			other, ok := val.(model.Vector)
+			if !ok {
+				continue
+			}
+			for _, s := range other {
+				m := h.stripReplica(s.Metric)
+				fp := m.Fingerprint()
+				if _, ok := seen[fp]; ok {
+					continue
+				}
+				seen[fp] = struct{}{}
+
+				sample := *s
+				sample.Metric = m
+				vec = append(vec, &sample)
+			}
+		}
+		return vec
+
+	case model.Matrix:
+		var (
+			mat    = model.Matrix{}
+			series = map[model.Fingerprint]*model.SampleStream{}
+		)
+		for _, val := range values {
+			other, ok := val.(model.Matrix)
+			if !ok {
+				continue
+			}
+			for _, ss := range other {
+				m := h.stripReplica(ss.Metric)
+				fp := m.Fingerprint()
+				cur, ok := series[fp]
+				switch {
+				case !ok:
+					cur = &model.SampleStream{Metric: m, Values: ss.Values, Histograms: ss.Histograms}
+					series[fp] = cur
+					mat = append(mat, cur)
+				case aligned:
+					cur.Values = mergeSamples(cur.Values, ss.Values)
+					cur.Histograms = mergeHistograms(cur.Histograms, ss.Histograms)
+				case len(ss.Values)+len(ss.Histograms) > len(cur.Values)+len(cur.Histograms):
+					cur.Values, cur.Histograms = ss.Values, ss.Histograms
+				}
+			}
+		}
+		sort.Sort(mat)
+		return mat
+
+	default:
+		return v
+	}
+}
+
+func (h *haAPI) stripReplica(m model.Metric) model.Metric {
+	if _, ok := m[model.LabelName(h.cfg.ReplicaLabel)]; !ok {
+		return m
+	}
+	res := m.Clone()
+	delete(res, model.LabelName(h.cfg.ReplicaLabel))
+	return res
+}
+
+// mergeSamples merges the sorted samples a and b, preferring the samples of a
+// for equal timestamps.
+func mergeSamples(a, b []model.SamplePair) []model.SamplePair {
+	if len(a) == 0 || len(b) == 0 {
+		if len(a) == 0 {
+			return b
+		}
+		return a
+	}
+	res := make([]model.SamplePair, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].Timestamp.Before(b[0].Timestamp):
+			res, a = append(res, a[0]), a[1:]
+		case b[0].Timestamp.Before(a[0].Timestamp):
+			res, b = append(res, b[0]), b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	return append(append(res, a...), b...)
+}
+
+// mergeHistograms merges the sorted histograms a and b, preferring the
+// histograms of a for equal timestamps.
+func mergeHistograms(a, b []model.SampleHistogramPair) []model.SampleHistogramPair {
+	if len(a) == 0 || len(b) == 0 {
+		if len(a) == 0 {
+			return b
+		}
+		return a
+	}
+	res := make([]model.SampleHistogramPair, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].Timestamp.Before(b[0].Timestamp):
+			res, a = append(res, a[0]), a[1:]
+		case b[0].Timestamp.Before(a[0].Timestamp):
+			res, b = append(res, b[0]), b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	return append(append(res, a...), b...)
+}
+
+func (h *haAPI) Labels(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error) {
+	results := make([]model.LabelValues, len(h.backends))
+	_, err := h.all(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Labels(ctx, matches, start, end, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := mergeLabelValues(results)
+	for i, n := range names {
+		if string(n) == h.cfg.ReplicaLabel {
+			names = append(names[:i], names[i+1:]...)
+			break
+		}
+	}
+	return names, nil
+}
+
+func (h *haAPI) LabelValues(ctx context.Context, label string, matches []string, start, end time.Time, opts ...Option) (model.LabelValues, error) {
+	if label == h.cfg.ReplicaLabel {
+		// The replica label is removed from all series.
+		return model.LabelValues{}, nil
+	}
+	results := make([]model.LabelValues, len(h.backends))
+	_, err := h.all(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.LabelValues(ctx, label, matches, start, end, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mergeLabelValues(results), nil
+}
+
+// mergeLabelValues returns the sorted union of the given label values.
+func mergeLabelValues(results []model.LabelValues) model.LabelValues {
+	var (
+		res  = model.LabelValues{}
+		seen = map[model.LabelValue]struct{}{}
+	)
+	for _, values := range results {
+		for _, v := range values {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				res = append(res, v)
+			}
+		}
+	}
+	sort.Sort(res)
+	return res
+}
+
+func (h *haAPI) Series(ctx context.Context, matches []string, start, end time.Time, opts ...Option) ([]model.Metric, error) {
+	results := make([][]model.Metric, len(h.backends))
+	_, err := h.all(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Series(ctx, matches, start, end, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		series = []model.Metric{}
+		seen   = map[model.Fingerprint]struct{}{}
+	)
+	for _, metrics := range results {
+		for _, m := range metrics {
+			m = h.stripReplica(m)
+			fp := m.Fingerprint()
+			if _, ok := seen[fp]; !ok {
+				seen[fp] = struct{}{}
+				series = append(series, m)
+			}
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Before(series[j]) })
+	return series, nil
+}
+
+func (h *haAPI) QueryRangeStream(ctx context.Context, query string, r Range, opts ...Option) (MatrixStream, error) {
+	streams := make([]MatrixStream, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		streams[i], err = api.QueryRangeStream(ctx, query, r, opts...)
+		return err
+	}, func(i int) {
+		streams[i].Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &releasingMatrixStream{MatrixStream: streams[i], release: release}, nil
+}
+
+// releasingMatrixStream releases the context of a stream when it is closed.
+type releasingMatrixStream struct {
+	MatrixStream
+	release func()
+}
+
+func (s *releasingMatrixStream) Close() error {
+	defer s.release()
+	return s.MatrixStream.Close()
+}
+
+func (h *haAPI) QueryExemplars(ctx context.Context, query string, start, end time.Time) ([]ExemplarQueryResult, error) {
+	results := make([][]ExemplarQueryResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.QueryExemplars(ctx, query, start, end)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Targets(ctx context.Context) (TargetsResult, error) {
+	results := make([]TargetsResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Targets(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return TargetsResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Rules(ctx context.Context) (RulesResult, error) {
+	results := make([]RulesResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Rules(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return RulesResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Alerts(ctx context.Context) (AlertsResult, error) {
+	results := make([]AlertsResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Alerts(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return AlertsResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]Metadata, error) {
+	results := make([]map[string][]Metadata, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Metadata(ctx, metric, limit)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Config(ctx context.Context) (ConfigResult, error) {
+	results := make([]ConfigResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Config(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return ConfigResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Flags(ctx context.Context) (FlagsResult, error) {
+	results := make([]FlagsResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Flags(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Buildinfo(ctx context.Context) (BuildinfoResult, error) {
+	results := make([]BuildinfoResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Buildinfo(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return BuildinfoResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) Runtimeinfo(ctx context.Context) (RuntimeinfoResult, error) {
+	results := make([]RuntimeinfoResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.Runtimeinfo(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return RuntimeinfoResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+func (h *haAPI) TSDB(ctx context.Context) (TSDBResult, error) {
+	results := make([]TSDBResult, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		results[i], err = api.TSDB(ctx)
+		return err
+	}, nil)
+	if err != nil {
+		return TSDBResult{}, err
+	}
+	release()
+	return results[i], nil
+}
+
+// Raw sends the request to all backends and returns the first response
+// without a transport error, regardless of its status code.
+func (h *haAPI) Raw(ctx context.Context, r prometheus.RawRequest) (*http.Response, error) {
+	if r.Body != nil && len(h.backends) > 1 {
+		return nil, fmt.Errorf("raw requests with a body cannot be sent to multiple backends")
+	}
+
+	responses := make([]*http.Response, len(h.backends))
+	i, release, err := h.first(ctx, func(ctx context.Context, i int, api API) (err error) {
+		responses[i], err = api.Raw(ctx, r)
+		return err
+	}, func(i int) {
+		responses[i].Body.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := responses[i]
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases the context of a response when its body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
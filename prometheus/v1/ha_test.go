@@ -0,0 +1,411 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+)
+
+// promBackend is a fake Prometheus answering the endpoints of the v1 API
+// with the response bodies registered for their paths.
+type promBackend struct {
+	mtx       sync.Mutex
+	responses map[string]string
+	requests  []string
+}
+
+func (b *promBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mtx.Lock()
+	b.requests = append(b.requests, r.URL.Path)
+	body, ok := b.responses[r.URL.Path]
+	b.mtx.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, body)
+}
+
+// success wraps data into a successful API response with the given warnings.
+func success(data string, warnings ...string) string {
+	if len(warnings) == 0 {
+		return `{"status":"success","data":` + data + `}`
+	}
+	return `{"status":"success","data":` + data + `,"warnings":["` + strings.Join(warnings, `","`) + `"]}`
+}
+
+// newHABackends starts a test server for every handler and returns their
+// clients. A nil handler is a backend that is down.
+func newHABackends(t *testing.T, handlers ...http.Handler) []prometheus.Client {
+	t.Helper()
+	var clients []prometheus.Client
+	for _, h := range handlers {
+		var srv *httptest.Server
+		if h == nil {
+			srv = httptest.NewServer(http.NotFoundHandler())
+			srv.Close()
+		} else {
+			srv = httptest.NewServer(h)
+			t.Cleanup(srv.Close)
+		}
+		c, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+		require.NoError(t, err)
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func TestHAQueryRange(t *testing.T) {
+	gap := &promBackend{responses: map[string]string{
+		epQueryRange: success(`{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","job":"x","replica":"a"},"values":[[100,"1"],[115,"1"],[145,"1"]]}
+		]}`, "partial data"),
+	}}
+	full := &promBackend{responses: map[string]string{
+		epQueryRange: success(`{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","job":"x","replica":"b"},"values":[[100,"2"],[115,"2"],[130,"2"],[145,"2"]]},
+			{"metric":{"__name__":"up","job":"y","replica":"b"},"values":[[100,"3"]]}
+		]}`, "partial data"),
+	}}
+	clients := newHABackends(t, gap, full, nil)
+	api := NewHAAPI(clients, HAConfig{})
+
+	res, err := api.QueryRangeDetailed(context.Background(), "up", Range{Start: time.Unix(100, 0), End: time.Unix(145, 0), Step: 15 * time.Second})
+	require.NoError(t, err)
+	// The gap of the first replica is filled by the second one.
+	require.Equal(t, model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "up", "job": "x"},
+			Values: []model.SamplePair{{Timestamp: 100000, Value: 1}, {Timestamp: 115000, Value: 1}, {Timestamp: 130000, Value: 2}, {Timestamp: 145000, Value: 1}},
+		},
+		{
+			Metric: model.Metric{"__name__": "up", "job": "y"},
+			Values: []model.SamplePair{{Timestamp: 100000, Value: 3}},
+		},
+	}, res.Value)
+
+	// The error of the backend that is down is a warning.
+	require.Len(t, res.Warnings, 2)
+	require.True(t, strings.HasPrefix(res.Warnings[0], "backend "+clients[2].URL("", nil).String()+": "), res.Warnings[0])
+	require.Equal(t, "partial data", res.Warnings[1])
+}
+
+func TestHAQuery(t *testing.T) {
+	vector := &promBackend{responses: map[string]string{
+		epQuery: success(`{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"x","replica":"a"},"value":[100,"1"]}
+		]}`),
+	}}
+	otherVector := &promBackend{responses: map[string]string{
+		epQuery: success(`{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"x","replica":"b"},"value":[100,"2"]},
+			{"metric":{"__name__":"up","job":"y","replica":"b"},"value":[100,"3"]}
+		]}`),
+	}}
+	matrix := &promBackend{responses: map[string]string{
+		epQuery: success(`{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","job":"z","replica":"c"},"values":[[100,"4"]]}
+		]}`),
+	}}
+	clients := newHABackends(t, vector, otherVector, matrix)
+	api := NewHAAPI(clients, HAConfig{})
+
+	res, err := api.QueryDetailed(context.Background(), "up", time.Unix(100, 0))
+	require.NoError(t, err)
+	// The sample of the first backend wins.
+	require.Equal(t, model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "x"}, Value: 1, Timestamp: 100000},
+		{Metric: model.Metric{"__name__": "up", "job": "y"}, Value: 3, Timestamp: 100000},
+	}, res.Value)
+	// The result of another type is left out with a warning.
+	require.Equal(t, Warnings{
+		"backend " + clients[2].URL("", nil).String() + ": unexpected result type matrix, expected vector",
+	}, res.Warnings)
+}
+
+func TestHAQueryRangeVector(t *testing.T) {
+	// The raw samples of range vectors are not aligned, the replica with
+	// the most samples is used.
+	few := &promBackend{responses: map[string]string{
+		epQuery: success(`{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","replica":"a"},"values":[[101,"1"],[131,"1"]]}
+		]}`),
+	}}
+	many := &promBackend{responses: map[string]string{
+		epQuery: success(`{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","replica":"b"},"values":[[103,"2"],[118,"2"],[133,"2"]]}
+		]}`),
+	}}
+	api := NewHAAPI(newHABackends(t, few, many), HAConfig{})
+
+	v, err := api.Query(context.Background(), "up[1m]", time.Unix(140, 0))
+	require.NoError(t, err)
+	require.Equal(t, model.Matrix{{
+		Metric: model.Metric{"__name__": "up"},
+		Values: []model.SamplePair{{Timestamp: 103000, Value: 2}, {Timestamp: 118000, Value: 2}, {Timestamp: 133000, Value: 2}},
+	}}, v)
+}
+
+func TestHALabelsAndSeries(t *testing.T) {
+	a := &promBackend{responses: map[string]string{
+		epLabels:                   success(`["__name__","dc","job"]`),
+		"/api/v1/label/job/values": success(`["x"]`),
+		"/api/v1/label/dc/values":  success(`["eu"]`),
+		epSeries:                   success(`[{"__name__":"up","job":"x","dc":"eu"}]`),
+	}}
+	b := &promBackend{responses: map[string]string{
+		epLabels:                   success(`["__name__","instance","job","dc"]`),
+		"/api/v1/label/job/values": success(`["y","x"]`),
+		epSeries:                   success(`[{"__name__":"up","job":"x","dc":"us"},{"__name__":"up","job":"y","dc":"us"}]`),
+	}}
+	api := NewHAAPI(newHABackends(t, a, b, nil), HAConfig{ReplicaLabel: "dc"})
+	ctx := context.Background()
+
+	names, err := api.Labels(ctx, nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelValues{"__name__", "instance", "job"}, names)
+
+	values, err := api.LabelValues(ctx, "job", nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelValues{"x", "y"}, values)
+
+	// The replica label is hidden from the label names, so it has no values either.
+	values, err = api.LabelValues(ctx, "dc", nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Empty(t, values)
+	require.NotContains(t, a.requests, "/api/v1/label/dc/values")
+
+	series, err := api.Series(ctx, []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []model.Metric{
+		{"__name__": "up", "job": "x"},
+		{"__name__": "up", "job": "y"},
+	}, series)
+}
+
+func TestHAAllDown(t *testing.T) {
+	api := NewHAAPI(newHABackends(t, nil, nil), HAConfig{})
+	ctx := context.Background()
+
+	_, err := api.Query(ctx, "up", time.Unix(100, 0))
+	require.Error(t, err)
+	_, err = api.Labels(ctx, nil, time.Time{}, time.Time{})
+	require.Error(t, err)
+	_, err = api.Buildinfo(ctx)
+	require.Error(t, err)
+
+	_, err = NewHAAPI(nil, HAConfig{}).Query(ctx, "up", time.Unix(100, 0))
+	require.EqualError(t, err, "no backends configured")
+}
+
+func TestHAFirstSuccess(t *testing.T) {
+	up := &promBackend{responses: map[string]string{
+		epBuildinfo:  success(`{"version":"2.53.0"}`),
+		epQueryRange: success(`{"resultType":"matrix","result":[{"metric":{"__name__":"up"},"values":[[100,"1"]]}]}`),
+	}}
+	api := NewHAAPI(newHABackends(t, nil, up), HAConfig{})
+	ctx := context.Background()
+
+	info, err := api.Buildinfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2.53.0", info.Version)
+
+	s, err := api.QueryRangeStream(ctx, "up", Range{Start: time.Unix(100, 0), End: time.Unix(100, 0), Step: time.Second})
+	require.NoError(t, err)
+	require.True(t, s.Next())
+	require.Equal(t, model.Metric{"__name__": "up"}, s.At().Metric)
+	require.False(t, s.Next())
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+
+	_, err = api.Raw(ctx, prometheus.RawRequest{Method: http.MethodPost, Path: "/api/v1/write", Body: strings.NewReader("x")})
+	require.EqualError(t, err, "raw requests with a body cannot be sent to multiple backends")
+}
+
+func TestHARawReleasesOnClose(t *testing.T) {
+	var (
+		slowGone   = make(chan struct{})
+		winnerGone = make(chan struct{})
+	)
+	winner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first part,")
+		w.(http.Flusher).Flush()
+		// The rest of the body is sent after the other backends were
+		// canceled, so the context of the winner must still be valid.
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "second part")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(winnerGone)
+	})
+	slow := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(slowGone)
+	})
+	api := NewHAAPI(newHABackends(t, winner, slow), HAConfig{})
+
+	resp, err := api.Raw(context.Background(), prometheus.RawRequest{Path: "/federate"})
+	require.NoError(t, err)
+	select {
+	case <-slowGone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow backend was not canceled")
+	}
+
+	buf := make([]byte, len("first part,second part"))
+	_, err = io.ReadFull(resp.Body, buf)
+	require.NoError(t, err)
+	require.Equal(t, "first part,second part", string(buf))
+
+	require.NoError(t, resp.Body.Close())
+	select {
+	case <-winnerGone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the body did not release the winner")
+	}
+}
+
+func TestHAFirst(t *testing.T) {
+	newHA := func(n int) *haAPI {
+		h := &haAPI{}
+		for i := 0; i < n; i++ {
+			h.backends = append(h.backends, haBackend{name: fmt.Sprint(i)})
+		}
+		return h
+	}
+	errBoom := errors.New("boom")
+
+	t.Run("cancels the others", func(t *testing.T) {
+		ctxs := make([]context.Context, 3)
+		winner, release, err := newHA(3).first(context.Background(), func(ctx context.Context, i int, _ API) error {
+			ctxs[i] = ctx
+			if i == 1 {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, winner)
+
+		require.Error(t, ctxs[0].Err())
+		require.Error(t, ctxs[2].Err())
+		// The context of the winner stays valid until it is released.
+		require.NoError(t, ctxs[1].Err())
+		release()
+		require.Error(t, ctxs[1].Err())
+	})
+
+	t.Run("discards late successes", func(t *testing.T) {
+		var (
+			mtx       sync.Mutex
+			discarded []int
+		)
+		winner, release, err := newHA(3).first(context.Background(), func(ctx context.Context, i int, _ API) error {
+			if i == 2 {
+				return nil
+			}
+			// Succeed although the call was canceled, as a response that
+			// arrived concurrently with the winning one would.
+			<-ctx.Done()
+			if i == 1 {
+				return ctx.Err()
+			}
+			return nil
+		}, func(i int) {
+			mtx.Lock()
+			discarded = append(discarded, i)
+			mtx.Unlock()
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, winner)
+		require.Equal(t, []int{0}, discarded)
+		release()
+	})
+
+	t.Run("skips failures", func(t *testing.T) {
+		winner, release, err := newHA(2).first(context.Background(), func(_ context.Context, i int, _ API) error {
+			if i == 0 {
+				return errBoom
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, winner)
+		release()
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		ctxs := make([]context.Context, 2)
+		_, release, err := newHA(2).first(context.Background(), func(ctx context.Context, i int, _ API) error {
+			ctxs[i] = ctx
+			if i == 0 {
+				time.Sleep(10 * time.Millisecond)
+				return errBoom
+			}
+			return errors.New("other")
+		}, nil)
+		require.Equal(t, errBoom, err)
+		require.Nil(t, release)
+		require.Error(t, ctxs[0].Err())
+		require.Error(t, ctxs[1].Err())
+	})
+}
+
+func TestHAOnBackendError(t *testing.T) {
+	up := &promBackend{responses: map[string]string{
+		epQuery:                    success(`{"resultType":"vector","result":[]}`),
+		epLabels:                   success(`["__name__"]`),
+		"/api/v1/label/job/values": success(`["x"]`),
+		epSeries:                   success(`[{"__name__":"up"}]`),
+	}}
+	clients := newHABackends(t, up, nil)
+	down := clients[1].URL("", nil).String()
+
+	var (
+		mtx    sync.Mutex
+		failed []string
+	)
+	api := NewHAAPI(clients, HAConfig{OnBackendError: func(backend string, err error) {
+		require.Error(t, err)
+		mtx.Lock()
+		failed = append(failed, backend)
+		mtx.Unlock()
+	}})
+	ctx := context.Background()
+
+	_, err := api.Labels(ctx, nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	_, err = api.LabelValues(ctx, "job", nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	_, err = api.Series(ctx, []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	res, err := api.QueryDetailed(ctx, "up", time.Unix(100, 0))
+	require.NoError(t, err)
+	require.Len(t, res.Warnings, 1)
+	require.Equal(t, []string{down, down, down, down}, failed)
+
+	// Calls failing for all backends return the error instead.
+	failed = nil
+	api = NewHAAPI(newHABackends(t, nil, nil), HAConfig{OnBackendError: func(backend string, _ error) {
+		failed = append(failed, backend)
+	}})
+	_, err = api.Labels(ctx, nil, time.Time{}, time.Time{})
+	require.Error(t, err)
+	require.Empty(t, failed)
+}
@@ -0,0 +1,318 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/model/timestamp"
+	"github.com/liticer/gclients/prometheus/remote"
+)
+
+// QueryableConfig configures the storage.Queryable returned by NewQueryable.
+type QueryableConfig struct {
+	// Reader reads the samples through the remote read endpoint of the
+	// server if set, instead of through range selector queries.
+	Reader *remote.Reader
+
+	// The longest range of a single range selector query. Longer time ranges
+	// are read with several queries, so that none exceeds the sample limit
+	// of the server. Defaults to 6h.
+	MaxRange time.Duration
+}
+
+// NewQueryable returns a storage.Queryable reading the raw samples of the
+// Prometheus server behind api, e.g. to evaluate PromQL locally against
+// production data.
+//
+// Select reads the samples with instant queries of a range selector over
+// the matchers, such as {job="api"}[6h] at the end of the range, as range
+// queries only return values evaluated at steps.
+//
+// Each Querier caches the samples it reads by matchers, so that selectors
+// with the same matchers over overlapping time ranges only fetch the missing
+// time ranges. Use a Querier per query evaluation, as the promql Engine does,
+// to not serve stale samples.
+func NewQueryable(api API, cfg QueryableConfig) storage.Queryable {
+	if cfg.MaxRange <= 0 {
+		cfg.MaxRange = 6 * time.Hour
+	}
+	return storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+		return &apiQuerier{
+			api:   api,
+			cfg:   cfg,
+			mint:  mint,
+			maxt:  maxt,
+			cache: map[string]*cachedSelect{},
+		}, nil
+	})
+}
+
+type apiQuerier struct {
+	api        API
+	cfg        QueryableConfig
+	mint, maxt int64
+
+	mtx   sync.Mutex               // Protects cache, not its entries.
+	cache map[string]*cachedSelect // By selector.
+}
+
+// cachedSelect holds the samples of the series matching a selector between
+// mint and maxt, both inclusive.
+//
+// Its mtx is held while fetching, so that concurrent selects of the same
+// selector wait for each other instead of fetching the same samples, while
+// selects of other selectors are not blocked.
+type cachedSelect struct {
+	mtx        sync.Mutex
+	loaded     bool
+	mint, maxt int64
+	series     []cachedSeries // Sorted by labels.
+	warnings   storage.Warnings
+}
+
+type cachedSeries struct {
+	lset    labels.Labels
+	samples []storage.Sample
+}
+
+// selector returns the PromQL vector selector for the given matchers.
+func selector(matchers []*labels.Matcher) string {
+	strs := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		strs = append(strs, m.String())
+	}
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+func (q *apiQuerier) Select(ctx context.Context, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = max(mint, hints.Start), min(maxt, hints.End)
+	}
+	if mint > maxt {
+		return storage.NewListSeriesSet(nil, nil)
+	}
+	sel := selector(matchers)
+
+	q.mtx.Lock()
+	c, ok := q.cache[sel]
+	if !ok {
+		c = &cachedSelect{}
+		q.cache[sel] = c
+	}
+	q.mtx.Unlock()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.loaded {
+		series, ws, err := q.fetch(ctx, sel, matchers, mint, maxt)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		c.loaded, c.mint, c.maxt, c.series, c.warnings = true, mint, maxt, series, ws
+	}
+	// Only fetch the time ranges missing from the cache.
+	if mint < c.mint {
+		series, ws, err := q.fetch(ctx, sel, matchers, mint, c.mint-1)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		c.mint, c.series, c.warnings = mint, mergeCachedSeries(series, c.series), append(c.warnings, ws...)
+	}
+	if maxt > c.maxt {
+		series, ws, err := q.fetch(ctx, sel, matchers, c.maxt+1, maxt)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		c.maxt, c.series, c.warnings = maxt, mergeCachedSeries(c.series, series), append(c.warnings, ws...)
+	}
+
+	res := make([]storage.Series, 0, len(c.series))
+	for _, s := range c.series {
+		i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp >= mint })
+		j := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp > maxt })
+		if i < j {
+			res = append(res, storage.NewListSeries(s.lset, s.samples[i:j:j]))
+		}
+	}
+	return storage.NewListSeriesSet(res, c.warnings)
+}
+
+// fetch reads the series matching the selector with their samples between
+// mint and maxt, both inclusive.
+func (q *apiQuerier) fetch(ctx context.Context, sel string, matchers []*labels.Matcher, mint, maxt int64) ([]cachedSeries, storage.Warnings, error) {
+	if q.cfg.Reader != nil {
+		return q.read(ctx, matchers, mint, maxt)
+	}
+
+	var (
+		res      []cachedSeries
+		warnings storage.Warnings
+		maxRange = q.cfg.MaxRange.Milliseconds()
+	)
+	for start := mint; start <= maxt; {
+		end := maxt
+		if maxt-start >= maxRange {
+			end = start + maxRange - 1
+		}
+
+		// The range selector covers (end-range, end], which is [start, end]
+		// for millisecond timestamps.
+		query := fmt.Sprintf("%s[%dms]", sel, end-start+1)
+		result, err := q.api.QueryDetailed(ctx, query, timestamp.Time(end))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, w := range result.Warnings {
+			warnings = append(warnings, errors.New(w))
+		}
+		matrix, ok := result.Value.(model.Matrix)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected result type %s for query %q", result.Value.Type(), query)
+		}
+		res = mergeCachedSeries(res, matrixToCachedSeries(matrix, start, end))
+
+		if end == maxt {
+			break
+		}
+		start = end + 1
+	}
+	return res, warnings, nil
+}
+
+// read reads the series matching the matchers through remote read.
+func (q *apiQuerier) read(ctx context.Context, matchers []*labels.Matcher, mint, maxt int64) ([]cachedSeries, storage.Warnings, error) {
+	set, err := q.cfg.Reader.Read(ctx, mint, maxt, matchers...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var res []cachedSeries
+	for set.Next() {
+		s := cachedSeries{lset: set.At().Labels()}
+		it := set.At().Iterator()
+		for typ := it.Next(); typ != storage.ValNone; typ = it.Next() {
+			if typ != storage.ValFloat {
+				continue
+			}
+			t, v := it.At()
+			if t >= mint && t <= maxt {
+				s.samples = append(s.samples, storage.Sample{Timestamp: t, Value: v})
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, nil, err
+		}
+		if len(s.samples) > 0 {
+			res = append(res, s)
+		}
+	}
+	if err := set.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(res, func(i, j int) bool { return labels.Compare(res[i].lset, res[j].lset) < 0 })
+	return res, set.Warnings(), nil
+}
+
+// matrixToCachedSeries returns the samples of m between start and end, both
+// inclusive, sorted by labels. Older servers include samples at the left
+// boundary of the range selector, which are dropped.
+func matrixToCachedSeries(m model.Matrix, start, end int64) []cachedSeries {
+	res := make([]cachedSeries, 0, len(m))
+	for _, ss := range m {
+		s := cachedSeries{lset: metricToLabels(ss.Metric)}
+		for _, p := range ss.Values {
+			if t := int64(p.Timestamp); t >= start && t <= end {
+				s.samples = append(s.samples, storage.Sample{Timestamp: t, Value: float64(p.Value)})
+			}
+		}
+		if len(s.samples) > 0 {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return labels.Compare(res[i].lset, res[j].lset) < 0 })
+	return res
+}
+
+func metricToLabels(m model.Metric) labels.Labels {
+	b := labels.NewScratchBuilder(len(m))
+	for name, value := range m {
+		b.Add(string(name), string(value))
+	}
+	b.Sort()
+	return b.Labels()
+}
+
+// mergeCachedSeries merges two lists of series sorted by labels, where the
+// samples of a come before the samples of b.
+func mergeCachedSeries(a, b []cachedSeries) []cachedSeries {
+	res := make([]cachedSeries, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch c := labels.Compare(a[0].lset, b[0].lset); {
+		case c < 0:
+			res, a = append(res, a[0]), a[1:]
+		case c > 0:
+			res, b = append(res, b[0]), b[1:]
+		default:
+			samples := make([]storage.Sample, 0, len(a[0].samples)+len(b[0].samples))
+			samples = append(append(samples, a[0].samples...), b[0].samples...)
+			res = append(res, cachedSeries{lset: a[0].lset, samples: samples})
+			a, b = a[1:], b[1:]
+		}
+	}
+	res = append(res, a...)
+	return append(res, b...)
+}
+
+func (q *apiQuerier) LabelValues(ctx context.Context, name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	values, err := q.api.LabelValues(ctx, name, q.matches(matchers), timestamp.Time(q.mint), timestamp.Time(q.maxt))
+	if err != nil {
+		return nil, nil, err
+	}
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		res = append(res, string(v))
+	}
+	sort.Strings(res)
+	return res, nil, nil
+}
+
+func (q *apiQuerier) LabelNames(ctx context.Context, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	names, err := q.api.Labels(ctx, q.matches(matchers), timestamp.Time(q.mint), timestamp.Time(q.maxt))
+	if err != nil {
+		return nil, nil, err
+	}
+	res := make([]string, 0, len(names))
+	for _, n := range names {
+		res = append(res, string(n))
+	}
+	sort.Strings(res)
+	return res, nil, nil
+}
+
+func (q *apiQuerier) matches(matchers []*labels.Matcher) []string {
+	if len(matchers) == 0 {
+		return nil
+	}
+	return []string{selector(matchers)}
+}
+
+func (q *apiQuerier) Close() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	clear(q.cache)
+	return nil
+}
@@ -0,0 +1,394 @@
+package v1_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/liticer/gclients/prometheus"
+	"github.com/liticer/gclients/prometheus/model/labels"
+	"github.com/liticer/gclients/prometheus/model/storage"
+	"github.com/liticer/gclients/prometheus/prometheustest"
+	"github.com/liticer/gclients/prometheus/remote"
+	v1 "github.com/liticer/gclients/prometheus/v1"
+)
+
+var queryableStart = time.Unix(1700000000, 0).UTC()
+
+// minute returns the timestamp of the n-th minute after queryableStart in
+// milliseconds.
+func minute(n int) int64 {
+	return queryableStart.Add(time.Duration(n) * time.Minute).UnixMilli()
+}
+
+// recordingAPI records the instant queries sent through it.
+type recordingAPI struct {
+	v1.API
+
+	mtx     sync.Mutex
+	queries []string
+}
+
+func (a *recordingAPI) QueryDetailed(ctx context.Context, query string, ts time.Time, opts ...v1.Option) (*v1.QueryResult, error) {
+	a.mtx.Lock()
+	a.queries = append(a.queries, fmt.Sprintf("%s @ %d", query, ts.UnixMilli()))
+	a.mtx.Unlock()
+	return a.API.QueryDetailed(ctx, query, ts, opts...)
+}
+
+func (a *recordingAPI) reset() []string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	queries := a.queries
+	a.queries = nil
+	return queries
+}
+
+func newQueryableServer(t *testing.T) (*prometheustest.Server, *recordingAPI) {
+	s := prometheustest.NewServer()
+	t.Cleanup(s.Close)
+
+	s.MustLoad(queryableStart, time.Minute,
+		`up{job="api", instance="a"} 0+1x59`,
+		// Only has samples during the first 15 minutes.
+		`up{job="api", instance="b"} 0+2x14`,
+		`up{job="api", instance="c"} 0+3x59`,
+		`up{job="db", instance="d"} 1x59`,
+	)
+	return s, &recordingAPI{API: s.API()}
+}
+
+type sample struct {
+	T int64
+	V float64
+}
+
+// selectAll returns the samples of every series selected, by labels.
+func selectAll(t *testing.T, q storage.Querier, hints *storage.SelectHints, matchers ...*labels.Matcher) map[string][]sample {
+	t.Helper()
+	res := map[string][]sample{}
+	var prev labels.Labels
+	set := q.Select(context.Background(), hints, matchers...)
+	for set.Next() {
+		lset := set.At().Labels()
+		require.Negative(t, labels.Compare(prev, lset), "series not sorted")
+		prev = lset
+
+		it := set.At().Iterator()
+		for it.Next() == storage.ValFloat {
+			ts, v := it.At()
+			res[lset.String()] = append(res[lset.String()], sample{T: ts, V: v})
+		}
+		require.NoError(t, it.Err())
+	}
+	require.NoError(t, set.Err())
+	return res
+}
+
+// linear returns the samples of a series valued factor*i at minute i, from
+// minute from to minute to.
+func linear(from, to int, factor float64) []sample {
+	var res []sample
+	for i := from; i <= to; i++ {
+		res = append(res, sample{T: minute(i), V: factor * float64(i)})
+	}
+	return res
+}
+
+var (
+	seriesA = `{__name__="up", instance="a", job="api"}`
+	seriesB = `{__name__="up", instance="b", job="api"}`
+	seriesC = `{__name__="up", instance="c", job="api"}`
+	apiJob  = labels.MustNewMatcher(labels.MatchEqual, "job", "api")
+)
+
+func TestQueryableMaxRange(t *testing.T) {
+	_, api := newQueryableServer(t)
+	q, err := v1.NewQueryable(api, v1.QueryableConfig{MaxRange: 20 * time.Minute}).Querier(minute(0), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.Equal(t, map[string][]sample{
+		seriesA: linear(0, 59, 1),
+		seriesB: linear(0, 14, 2),
+		seriesC: linear(0, 59, 3),
+	}, selectAll(t, q, nil, apiJob))
+
+	// Every query covers [start, end] exactly, the last one is shorter.
+	require.Equal(t, []string{
+		fmt.Sprintf(`{job="api"}[1200000ms] @ %d`, minute(20)-1),
+		fmt.Sprintf(`{job="api"}[1200000ms] @ %d`, minute(40)-1),
+		fmt.Sprintf(`{job="api"}[1140001ms] @ %d`, minute(59)),
+	}, api.reset())
+}
+
+func TestQueryableCache(t *testing.T) {
+	_, api := newQueryableServer(t)
+	q, err := v1.NewQueryable(api, v1.QueryableConfig{}).Querier(minute(0), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.Equal(t, map[string][]sample{
+		seriesA: linear(20, 30, 1),
+		seriesC: linear(20, 30, 3),
+	}, selectAll(t, q, &storage.SelectHints{Start: minute(20), End: minute(30)}, apiJob))
+	require.Equal(t, []string{fmt.Sprintf(`{job="api"}[600001ms] @ %d`, minute(30))}, api.reset())
+
+	// Only the head and the tail are fetched. Series b only has samples in
+	// the head and is merged in between the cached series.
+	require.Equal(t, map[string][]sample{
+		seriesA: linear(10, 40, 1),
+		seriesB: linear(10, 14, 2),
+		seriesC: linear(10, 40, 3),
+	}, selectAll(t, q, &storage.SelectHints{Start: minute(10), End: minute(40)}, apiJob))
+	require.Equal(t, []string{
+		fmt.Sprintf(`{job="api"}[600000ms] @ %d`, minute(20)-1),
+		fmt.Sprintf(`{job="api"}[600000ms] @ %d`, minute(40)),
+	}, api.reset())
+
+	require.Equal(t, map[string][]sample{
+		seriesA: linear(15, 35, 1),
+		seriesC: linear(15, 35, 3),
+	}, selectAll(t, q, &storage.SelectHints{Start: minute(15), End: minute(35)}, apiJob))
+	require.Empty(t, api.reset())
+
+	// The hints are limited to the time range of the querier.
+	require.Equal(t, map[string][]sample{
+		seriesA: linear(40, 59, 1),
+		seriesC: linear(40, 59, 3),
+	}, selectAll(t, q, &storage.SelectHints{Start: minute(40), End: minute(90)}, apiJob))
+	require.Equal(t, []string{fmt.Sprintf(`{job="api"}[1140000ms] @ %d`, minute(59))}, api.reset())
+}
+
+func TestQueryableError(t *testing.T) {
+	s, api := newQueryableServer(t)
+	q, err := v1.NewQueryable(api, v1.QueryableConfig{}).Querier(minute(0), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	s.SetError(prometheustest.EndpointQuery, &prometheustest.Error{Type: v1.ErrExec, Msg: "boom"})
+	set := q.Select(context.Background(), nil, apiJob)
+	require.False(t, set.Next())
+	require.ErrorContains(t, set.Err(), "boom")
+
+	// A failed select is not cached.
+	s.SetError(prometheustest.EndpointQuery, nil)
+	require.Len(t, selectAll(t, q, nil, apiJob), 3)
+}
+
+func TestQueryableConcurrentSelects(t *testing.T) {
+	s, _ := newQueryableServer(t)
+
+	// The query of the api job only returns once the query of the db job was
+	// sent, which deadlocks if selects of different selectors are serialized.
+	api := &blockingAPI{API: s.API(), blocked: make(chan struct{}), unblock: make(chan struct{})}
+	q, err := v1.NewQueryable(api, v1.QueryableConfig{}).Querier(minute(0), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	errc := make(chan error)
+	sel := func(m *labels.Matcher) {
+		set := q.Select(context.Background(), nil, m)
+		for set.Next() {
+		}
+		errc <- set.Err()
+	}
+	go sel(apiJob)
+	<-api.blocked
+	go sel(labels.MustNewMatcher(labels.MatchEqual, "job", "db"))
+
+	require.NoError(t, <-errc)
+	require.NoError(t, <-errc)
+}
+
+// blockingAPI blocks the queries of the api job until the db job is queried.
+type blockingAPI struct {
+	v1.API
+	blocked, unblock chan struct{}
+}
+
+func (a *blockingAPI) QueryDetailed(ctx context.Context, query string, ts time.Time, opts ...v1.Option) (*v1.QueryResult, error) {
+	if strings.HasPrefix(query, `{job="db"}`) {
+		close(a.unblock)
+	} else {
+		close(a.blocked)
+		select {
+		case <-a.unblock:
+		case <-time.After(2 * time.Second):
+			return nil, errors.New("timed out waiting for the other select")
+		}
+	}
+	return a.API.QueryDetailed(ctx, query, ts, opts...)
+}
+
+func TestQueryableLabels(t *testing.T) {
+	_, api := newQueryableServer(t)
+	ctx := context.Background()
+
+	q, err := v1.NewQueryable(api, v1.QueryableConfig{}).Querier(minute(0), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	names, _, err := q.LabelNames(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"__name__", "instance", "job"}, names)
+
+	values, _, err := q.LabelValues(ctx, "instance", apiJob)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, values)
+
+	values, _, err = q.LabelValues(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api", "db"}, values)
+
+	// Series without samples in the time range of the querier are left out.
+	q, err = v1.NewQueryable(api, v1.QueryableConfig{}).Querier(minute(30), minute(59))
+	require.NoError(t, err)
+	defer q.Close()
+
+	values, _, err = q.LabelValues(ctx, "instance", apiJob)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, values)
+}
+
+func TestQueryableRemoteRead(t *testing.T) {
+	var (
+		mtx         sync.Mutex
+		requests    [][2]int64
+		queryCalled bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/read" {
+			mtx.Lock()
+			queryCalled = true
+			mtx.Unlock()
+			http.NotFound(w, r)
+			return
+		}
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		mtx.Lock()
+		requests = append(requests, decodeReadRange(t, req))
+		mtx.Unlock()
+
+		// Remote read servers may return the series unsorted and with samples
+		// outside of the requested range.
+		resp := encodeReadResponse([]readSeries{
+			{lset: labels.FromStrings("__name__", "up", "instance", "b"), samples: []sample{{T: minute(0), V: 1}, {T: minute(1), V: 2}}},
+			{lset: labels.FromStrings("__name__", "up", "instance", "a"), samples: []sample{{T: minute(1), V: 3}, {T: minute(2), V: 4}, {T: minute(3), V: 5}}},
+		})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(snappy.Encode(nil, resp))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	reader := remote.NewReader(client, remote.ReadConfig{SamplesOnly: true})
+
+	q, err := v1.NewQueryable(v1.NewAPI(client), v1.QueryableConfig{Reader: reader}).Querier(minute(1), minute(2))
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.Equal(t, map[string][]sample{
+		`{__name__="up", instance="a"}`: {{T: minute(1), V: 3}, {T: minute(2), V: 4}},
+		`{__name__="up", instance="b"}`: {{T: minute(1), V: 2}},
+	}, selectAll(t, q, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")))
+	require.Equal(t, [][2]int64{{minute(1), minute(2)}}, requests)
+	require.False(t, queryCalled)
+}
+
+type readSeries struct {
+	lset    labels.Labels
+	samples []sample
+}
+
+// encodeReadResponse encodes a prometheus.ReadResponse with a single result.
+func encodeReadResponse(series []readSeries) []byte {
+	var result []byte
+	for _, s := range series {
+		var ts []byte
+		s.lset.Range(func(l labels.Label) {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		})
+		for _, smpl := range s.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(smpl.V))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(smpl.T))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+		result = protowire.AppendTag(result, 1, protowire.BytesType)
+		result = protowire.AppendBytes(result, ts)
+	}
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, result)
+}
+
+// decodeReadRange returns the time range of the first query of a
+// prometheus.ReadRequest.
+func decodeReadRange(t *testing.T, b []byte) [2]int64 {
+	var res [2]int64
+	query := consumeField(t, b, 1)
+	res[0] = int64(consumeVarint(t, query, 1))
+	res[1] = int64(consumeVarint(t, query, 2))
+	return res
+}
+
+func consumeField(t *testing.T, b []byte, num protowire.Number) []byte {
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, l, 0)
+			return v
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+	}
+	t.Fatalf("field %d not found", num)
+	return nil
+}
+
+func consumeVarint(t *testing.T, b []byte, num protowire.Number) uint64 {
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+		if n == num && typ == protowire.VarintType {
+			v, l := protowire.ConsumeVarint(b)
+			require.GreaterOrEqual(t, l, 0)
+			return v
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+	}
+	t.Fatalf("field %d not found", num)
+	return 0
+}
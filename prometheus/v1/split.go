@@ -0,0 +1,236 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// SplitConfig configures how range queries are split by NewSplitAPI.
+type SplitConfig struct {
+	// The length of the sub-ranges. Sub-ranges are aligned to multiples of
+	// Interval since the Unix epoch, so that e.g. 24h splits by UTC day.
+	// Defaults to 24h.
+	Interval time.Duration
+
+	// The maximum number of sub-queries in flight for a single range query.
+	// Defaults to 4.
+	MaxConcurrency int
+}
+
+// NewSplitAPI returns an API executing QueryRange and QueryRangeDetailed as
+// multiple sub-queries of at most cfg.Interval each, run in parallel, and
+// merging their results. This lets queries over long time ranges succeed
+// without raising the query timeout of the server. All other calls are
+// passed through to api.
+//
+// The merged QueryResult holds the warnings and infos of all sub-queries.
+// Its stats are accumulated over the sub-queries.
+func NewSplitAPI(api API, cfg SplitConfig) API {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = 4
+	}
+	return &splitAPI{API: api, cfg: cfg}
+}
+
+type splitAPI struct {
+	API
+	cfg SplitConfig
+}
+
+func (s *splitAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, error) {
+	res, err := s.QueryRangeDetailed(ctx, query, r)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (s *splitAPI) QueryRangeDetailed(ctx context.Context, query string, r Range, opts ...Option) (*QueryResult, error) {
+	ranges := splitRange(r, s.cfg.Interval)
+	if len(ranges) <= 1 {
+		return s.API.QueryRangeDetailed(ctx, query, r, opts...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results = make([]*QueryResult, len(ranges))
+		sem     = make(chan struct{}, s.cfg.MaxConcurrency)
+		wg      sync.WaitGroup
+
+		mtx      sync.Mutex
+		firstErr error
+	)
+	for i, sub := range ranges {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, sub Range) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res, err := s.API.QueryRangeDetailed(ctx, query, sub, opts...)
+			if err == nil && res.Value.Type() != model.ValMatrix {
+				err = fmt.Errorf("unexpected result type %s of range query", res.Value.Type())
+			}
+			if err != nil {
+				mtx.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mtx.Unlock()
+				return
+			}
+			results[i] = res
+		}(i, sub)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return mergeQueryResults(results), nil
+}
+
+// splitRange splits r into consecutive sub-ranges, each holding the
+// evaluation timestamps of r within one interval. The evaluation timestamps
+// of the sub-ranges are exactly those of r.
+func splitRange(r Range, interval time.Duration) []Range {
+	if r.Step <= 0 || !r.End.After(r.Start) {
+		return []Range{r}
+	}
+
+	var ranges []Range
+	for start := r.Start; !start.After(r.End); {
+		// The last evaluation timestamp before the end of the interval of start.
+		boundary := time.Unix(0, (start.UnixNano()/int64(interval)+1)*int64(interval))
+		end := start.Add((boundary.Sub(start) - 1) / r.Step * r.Step)
+		if end.After(r.End) {
+			end = r.End
+		}
+		ranges = append(ranges, Range{Start: start, End: end, Step: r.Step})
+		start = end.Add(r.Step)
+	}
+	return ranges
+}
+
+// mergeQueryResults merges the matrices of consecutive sub-queries into one,
+// dropping the samples of a series which are not after the last sample
+// already merged.
+func mergeQueryResults(results []*QueryResult) *QueryResult {
+	var (
+		merged  = &QueryResult{}
+		series  = map[model.Fingerprint]*model.SampleStream{}
+		matrix  model.Matrix
+		seenMsg = map[string]struct{}{}
+	)
+	for _, res := range results {
+		for _, ss := range res.Value.(model.Matrix) {
+			fp := ss.Metric.Fingerprint()
+			cur, ok := series[fp]
+			if !ok {
+				cur = &model.SampleStream{Metric: ss.Metric}
+				series[fp] = cur
+				matrix = append(matrix, cur)
+			}
+			cur.Values = appendSamples(cur.Values, ss.Values)
+			cur.Histograms = appendHistograms(cur.Histograms, ss.Histograms)
+		}
+
+		for _, w := range res.Warnings {
+			if _, ok := seenMsg[w]; !ok {
+				seenMsg[w] = struct{}{}
+				merged.Warnings = append(merged.Warnings, w)
+			}
+		}
+		for _, info := range res.Infos {
+			if _, ok := seenMsg[info]; !ok {
+				seenMsg[info] = struct{}{}
+				merged.Infos = append(merged.Infos, info)
+			}
+		}
+		merged.Stats = mergeQueryStats(merged.Stats, res.Stats)
+	}
+
+	sort.Sort(matrix)
+	merged.Value = matrix
+	return merged
+}
+
+func appendSamples(dst, src []model.SamplePair) []model.SamplePair {
+	for _, s := range src {
+		if len(dst) > 0 && !s.Timestamp.After(dst[len(dst)-1].Timestamp) {
+			continue
+		}
+		dst = append(dst, s)
+	}
+	return dst
+}
+
+func appendHistograms(dst, src []model.SampleHistogramPair) []model.SampleHistogramPair {
+	for _, h := range src {
+		if len(dst) > 0 && !h.Timestamp.After(dst[len(dst)-1].Timestamp) {
+			continue
+		}
+		dst = append(dst, h)
+	}
+	return dst
+}
+
+func mergeQueryStats(a, b *QueryStats) *QueryStats {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	res := &QueryStats{
+		Timings: QueryTimings{
+			EvalTotalTime:        a.Timings.EvalTotalTime + b.Timings.EvalTotalTime,
+			ResultSortTime:       a.Timings.ResultSortTime + b.Timings.ResultSortTime,
+			QueryPreparationTime: a.Timings.QueryPreparationTime + b.Timings.QueryPreparationTime,
+			InnerEvalTime:        a.Timings.InnerEvalTime + b.Timings.InnerEvalTime,
+			ExecQueueTime:        a.Timings.ExecQueueTime + b.Timings.ExecQueueTime,
+			ExecTotalTime:        a.Timings.ExecTotalTime + b.Timings.ExecTotalTime,
+		},
+		Samples: a.Samples,
+	}
+	if a.Samples != nil && b.Samples != nil {
+		res.Samples = &QuerySamples{
+			TotalQueryableSamplesPerStep: append(append([]StepStat(nil), a.Samples.TotalQueryableSamplesPerStep...), b.Samples.TotalQueryableSamplesPerStep...),
+			TotalQueryableSamples:        a.Samples.TotalQueryableSamples + b.Samples.TotalQueryableSamples,
+			PeakSamples:                  a.Samples.PeakSamples,
+		}
+		if b.Samples.PeakSamples > res.Samples.PeakSamples {
+			res.Samples.PeakSamples = b.Samples.PeakSamples
+		}
+	} else if a.Samples == nil {
+		res.Samples = b.Samples
+	}
+	return res
+}
@@ -0,0 +1,229 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeFuncAPI is an API whose QueryRangeDetailed calls fn.
+type rangeFuncAPI struct {
+	API
+	fn func(ctx context.Context, r Range) (*QueryResult, error)
+}
+
+func (a *rangeFuncAPI) QueryRangeDetailed(ctx context.Context, _ string, r Range, _ ...Option) (*QueryResult, error) {
+	return a.fn(ctx, r)
+}
+
+// evalTimes returns the evaluation timestamps of r.
+func evalTimes(r Range) []time.Time {
+	var ts []time.Time
+	for t := r.Start; !t.After(r.End); t = t.Add(r.Step) {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+func TestSplitRange(t *testing.T) {
+	base := time.Unix(1700000000, 0).Truncate(24 * time.Hour)
+
+	t.Run("unaligned start", func(t *testing.T) {
+		r := Range{
+			Start: base.Add(50*time.Minute + 17*time.Second),
+			End:   base.Add(3*time.Hour + 10*time.Minute),
+			Step:  7 * time.Minute,
+		}
+		require.Equal(t, []Range{
+			{Start: base.Add(50*time.Minute + 17*time.Second), End: base.Add(57*time.Minute + 17*time.Second), Step: r.Step},
+			{Start: base.Add(64*time.Minute + 17*time.Second), End: base.Add(113*time.Minute + 17*time.Second), Step: r.Step},
+			{Start: base.Add(120*time.Minute + 17*time.Second), End: base.Add(176*time.Minute + 17*time.Second), Step: r.Step},
+			// The last sub-range ends with r, there is no further evaluation timestamp.
+			{Start: base.Add(183*time.Minute + 17*time.Second), End: r.End, Step: r.Step},
+		}, splitRange(r, time.Hour))
+	})
+
+	for _, tc := range []struct {
+		name     string
+		r        Range
+		interval time.Duration
+	}{
+		{
+			name:     "aligned",
+			r:        Range{Start: base, End: base.Add(48 * time.Hour), Step: time.Hour},
+			interval: 24 * time.Hour,
+		},
+		{
+			name:     "step not dividing interval",
+			r:        Range{Start: base.Add(13 * time.Second), End: base.Add(5 * time.Hour), Step: 11 * time.Minute},
+			interval: time.Hour,
+		},
+		{
+			name:     "step longer than interval",
+			r:        Range{Start: base.Add(time.Minute), End: base.Add(10 * time.Hour), Step: 150 * time.Minute},
+			interval: time.Hour,
+		},
+		{
+			name:     "sub-second start",
+			r:        Range{Start: base.Add(1500 * time.Millisecond), End: base.Add(2*time.Hour + 30*time.Second), Step: 15 * time.Second},
+			interval: 30 * time.Minute,
+		},
+		{
+			name:     "end not on a step",
+			r:        Range{Start: base.Add(59 * time.Minute), End: base.Add(61*time.Minute + 30*time.Second), Step: time.Minute},
+			interval: time.Hour,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ranges := splitRange(tc.r, tc.interval)
+			require.NotEmpty(t, ranges)
+
+			var got []time.Time
+			for i, sub := range ranges {
+				require.Equal(t, tc.r.Step, sub.Step)
+				require.False(t, sub.End.Before(sub.Start))
+				// A sub-range never crosses an interval boundary.
+				require.Equal(t, sub.Start.UnixNano()/int64(tc.interval), sub.End.UnixNano()/int64(tc.interval), "sub-range %d crosses a boundary", i)
+				if i > 0 {
+					require.Equal(t, ranges[i-1].End.Add(tc.r.Step), sub.Start)
+				}
+				got = append(got, evalTimes(sub)...)
+			}
+			// Every evaluation timestamp is kept exactly once.
+			require.Equal(t, evalTimes(tc.r), got)
+		})
+	}
+
+	r := Range{Start: base, End: base, Step: time.Minute}
+	require.Equal(t, []Range{r}, splitRange(r, time.Hour))
+}
+
+func TestMergeQueryResults(t *testing.T) {
+	up := model.Metric{"__name__": "up", "job": "a"}
+	down := model.Metric{"__name__": "up", "job": "b"}
+
+	merged := mergeQueryResults([]*QueryResult{
+		{
+			Value: model.Matrix{
+				{Metric: up, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}}},
+			},
+			Warnings: Warnings{"w1"},
+			Stats: &QueryStats{
+				Timings: QueryTimings{EvalTotalTime: 1},
+				Samples: &QuerySamples{TotalQueryableSamples: 2, PeakSamples: 5},
+			},
+		},
+		{
+			Value: model.Matrix{
+				// The sample at 2000 was returned by the previous sub-query already.
+				{Metric: up, Values: []model.SamplePair{{Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 0}}},
+				{Metric: down, Values: []model.SamplePair{{Timestamp: 3000, Value: 1}}},
+			},
+			Warnings: Warnings{"w1", "w2"},
+			Infos:    []string{"i"},
+			Stats: &QueryStats{
+				Timings: QueryTimings{EvalTotalTime: 2},
+				Samples: &QuerySamples{TotalQueryableSamples: 3, PeakSamples: 7},
+			},
+		},
+		{
+			Value: model.Matrix{},
+		},
+	})
+
+	require.Equal(t, model.Matrix{
+		{Metric: up, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}, {Timestamp: 3000, Value: 0}}},
+		{Metric: down, Values: []model.SamplePair{{Timestamp: 3000, Value: 1}}},
+	}, merged.Value)
+	require.Equal(t, Warnings{"w1", "w2"}, merged.Warnings)
+	require.Equal(t, []string{"i"}, merged.Infos)
+	require.Equal(t, float64(3), merged.Stats.Timings.EvalTotalTime)
+	require.Equal(t, int64(5), merged.Stats.Samples.TotalQueryableSamples)
+	require.Equal(t, 7, merged.Stats.Samples.PeakSamples)
+}
+
+func TestSplitAPIQueryRange(t *testing.T) {
+	base := time.Unix(1700000000, 0).Truncate(time.Hour)
+	r := Range{Start: base.Add(30 * time.Minute), End: base.Add(150 * time.Minute), Step: 30 * time.Minute}
+
+	var (
+		mtx    sync.Mutex
+		ranges []Range
+	)
+	api := NewSplitAPI(&rangeFuncAPI{fn: func(_ context.Context, sub Range) (*QueryResult, error) {
+		mtx.Lock()
+		ranges = append(ranges, sub)
+		mtx.Unlock()
+
+		ss := &model.SampleStream{Metric: model.Metric{"__name__": "up"}}
+		for _, ts := range evalTimes(sub) {
+			ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+		}
+		return &QueryResult{Value: model.Matrix{ss}}, nil
+	}}, SplitConfig{Interval: time.Hour})
+
+	v, err := api.QueryRange(context.Background(), "up", r)
+	require.NoError(t, err)
+	require.Len(t, ranges, 3)
+
+	var got []time.Time
+	for _, s := range v.(model.Matrix)[0].Values {
+		got = append(got, s.Timestamp.Time())
+	}
+	require.Equal(t, evalTimes(r), got)
+}
+
+func TestSplitAPIError(t *testing.T) {
+	base := time.Unix(1700000000, 0).Truncate(time.Hour)
+	r := Range{Start: base, End: base.Add(4*time.Hour - time.Minute), Step: time.Minute}
+	errBoom := errors.New("boom")
+
+	t.Run("cancels running sub-queries", func(t *testing.T) {
+		var canceled atomic.Int32
+		api := NewSplitAPI(&rangeFuncAPI{fn: func(ctx context.Context, sub Range) (*QueryResult, error) {
+			if sub.Start.Equal(base.Add(2 * time.Hour)) {
+				return nil, errBoom
+			}
+			select {
+			case <-ctx.Done():
+				canceled.Add(1)
+				return nil, ctx.Err()
+			case <-time.After(10 * time.Second):
+				return &QueryResult{Value: model.Matrix{}}, nil
+			}
+		}}, SplitConfig{Interval: time.Hour, MaxConcurrency: 4})
+
+		start := time.Now()
+		_, err := api.QueryRange(context.Background(), "up", r)
+		require.Equal(t, errBoom, err)
+		require.Equal(t, int32(3), canceled.Load())
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("does not start further sub-queries", func(t *testing.T) {
+		var calls atomic.Int32
+		api := NewSplitAPI(&rangeFuncAPI{fn: func(context.Context, Range) (*QueryResult, error) {
+			calls.Add(1)
+			return nil, errBoom
+		}}, SplitConfig{Interval: time.Hour, MaxConcurrency: 1})
+
+		_, err := api.QueryRange(context.Background(), "up", r)
+		require.Equal(t, errBoom, err)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("non-matrix result", func(t *testing.T) {
+		api := NewSplitAPI(&rangeFuncAPI{fn: func(context.Context, Range) (*QueryResult, error) {
+			return &QueryResult{Value: model.Vector{}}, nil
+		}}, SplitConfig{Interval: time.Hour})
+
+		_, err := api.QueryRange(context.Background(), "up", r)
+		require.EqualError(t, err, "unexpected result type vector of range query")
+	})
+}
@@ -0,0 +1,311 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/prometheus/common/model"
+)
+
+// MatrixStream iterates over the series of a range query result while it is
+// being read from the wire. Only the current series is held in memory.
+type MatrixStream interface {
+	Next() bool
+	// At returns the current series. The returned series stays valid after Next is called.
+	At() *model.SampleStream
+	// The error that iteration has failed with.
+	// When an error occurs, the stream cannot continue to iterate.
+	Err() error
+	// Warnings returned by the server. They are only complete once Next returned false.
+	Warnings() Warnings
+	// Infos returned by the server. They are only complete once Next returned false.
+	Infos() []string
+	// Close releases the underlying response body. It must always be called.
+	Close() error
+}
+
+func (h *httpAPI) QueryRangeStream(ctx context.Context, query string, r Range, opts ...Option) (MatrixStream, error) {
+	u := h.client.URL(epQueryRange, nil)
+	q := u.Query()
+	setRangeParams(q, query, r)
+	newQueryOptions(opts).apply(q)
+	encoded := q.Encode()
+
+	var resp *http.Response
+	if h.usePost(encoded) {
+		req, err := newFormRequest(u, encoded)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = h.client.DoStream(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusMethodNotAllowed {
+			resp.Body.Close()
+			resp = nil
+		}
+	}
+	if resp == nil {
+		u.RawQuery = encoded
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = h.client.DoStream(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode/100 != 2 {
+		// Error responses are small, decode them the same way as Do does.
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = decodeResponse(resp, body); err == nil {
+			err = &Error{
+				Type: ErrBadResponse,
+				Msg:  fmt.Sprintf("bad response code %d", resp.StatusCode),
+			}
+		}
+		return nil, err
+	}
+
+	s := &matrixStream{body: resp.Body, dec: json.NewDecoder(resp.Body)}
+	if err := s.seekResult(); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// matrixStream decodes the envelope of a range query token by token and
+// the series inside of the result array one at a time.
+type matrixStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+
+	cur      *model.SampleStream
+	warnings Warnings
+	infos    []string
+	err      error
+	done     bool
+
+	// buffered holds the series if the result was sent before its type.
+	buffered   []*model.SampleStream
+	fromBuffer bool
+}
+
+func (s *matrixStream) Next() bool {
+	if s.err != nil || s.done {
+		return false
+	}
+	if s.fromBuffer {
+		if len(s.buffered) == 0 {
+			s.cur = nil
+			s.done = true
+			return false
+		}
+		s.cur, s.buffered = s.buffered[0], s.buffered[1:]
+		return true
+	}
+	if s.dec.More() {
+		var ss model.SampleStream
+		if err := s.dec.Decode(&ss); err != nil {
+			s.err = badResponse(err)
+			return false
+		}
+		s.cur = &ss
+		return true
+	}
+
+	s.cur = nil
+	s.done = true
+	if err := s.finish(); err != nil {
+		s.err = badResponse(err)
+	}
+	return false
+}
+
+func (s *matrixStream) At() *model.SampleStream { return s.cur }
+
+func (s *matrixStream) Err() error { return s.err }
+
+func (s *matrixStream) Warnings() Warnings { return s.warnings }
+
+func (s *matrixStream) Infos() []string { return s.infos }
+
+func (s *matrixStream) Close() error { return s.body.Close() }
+
+// seekResult advances the decoder to the first element of data.result.
+func (s *matrixStream) seekResult() error {
+	if err := s.expectDelim('{'); err != nil {
+		return badResponse(err)
+	}
+	found, err := s.readEnvelope(true)
+	if err != nil {
+		return badResponse(err)
+	}
+	if !found {
+		return badResponse(fmt.Errorf("missing data in response"))
+	}
+
+	if err := s.expectDelim('{'); err != nil {
+		return badResponse(err)
+	}
+	var (
+		resultType model.ValueType
+		result     json.RawMessage
+	)
+	for s.dec.More() {
+		key, err := s.readKey()
+		if err != nil {
+			return badResponse(err)
+		}
+		switch key {
+		case "resultType":
+			if err := s.dec.Decode(&resultType); err != nil {
+				return badResponse(err)
+			}
+		case "result":
+			if resultType == model.ValNone {
+				// The keys of an object are unordered. The type is not known
+				// yet, so the result has to be held until it is.
+				if err := s.dec.Decode(&result); err != nil {
+					return badResponse(err)
+				}
+				continue
+			}
+			if resultType != model.ValMatrix {
+				return badResponse(fmt.Errorf("unexpected value type %q", resultType))
+			}
+			if err := s.expectDelim('['); err != nil {
+				return badResponse(err)
+			}
+			return nil
+		default:
+			if err := s.skipValue(); err != nil {
+				return badResponse(err)
+			}
+		}
+	}
+	if result == nil {
+		return badResponse(fmt.Errorf("missing result in response"))
+	}
+	if resultType != model.ValMatrix {
+		return badResponse(fmt.Errorf("unexpected value type %q", resultType))
+	}
+	if err := json.Unmarshal(result, &s.buffered); err != nil {
+		return badResponse(err)
+	}
+	s.fromBuffer = true
+	// The result is in memory already, read the rest of the envelope now.
+	if err := s.expectDelim('}'); err != nil {
+		return badResponse(err)
+	}
+	if _, err := s.readEnvelope(false); err != nil {
+		return badResponse(err)
+	}
+	return nil
+}
+
+// finish consumes everything after the result array, picking up the
+// warnings and infos of the envelope on the way.
+func (s *matrixStream) finish() error {
+	if err := s.expectDelim(']'); err != nil {
+		return err
+	}
+	for s.dec.More() {
+		if _, err := s.readKey(); err != nil {
+			return err
+		}
+		if err := s.skipValue(); err != nil {
+			return err
+		}
+	}
+	if err := s.expectDelim('}'); err != nil {
+		return err
+	}
+	_, err := s.readEnvelope(false)
+	return err
+}
+
+// readEnvelope reads the keys of the top-level object. If untilData is set
+// it stops right before the value of the data key and reports whether it was found.
+func (s *matrixStream) readEnvelope(untilData bool) (bool, error) {
+	for s.dec.More() {
+		key, err := s.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case "data":
+			if untilData {
+				return true, nil
+			}
+			err = s.skipValue()
+		case "status":
+			var status string
+			if err = s.dec.Decode(&status); err == nil && status != "success" {
+				err = fmt.Errorf("unexpected status %q", status)
+			}
+		case "warnings":
+			err = s.dec.Decode(&s.warnings)
+		case "infos":
+			err = s.dec.Decode(&s.infos)
+		default:
+			err = s.skipValue()
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, s.expectDelim('}')
+}
+
+func (s *matrixStream) readKey() (string, error) {
+	t, err := s.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := t.(string)
+	if !ok {
+		return "", fmt.Errorf("expected object key, got %v", t)
+	}
+	return key, nil
+}
+
+func (s *matrixStream) skipValue() error {
+	var v json.RawMessage
+	return s.dec.Decode(&v)
+}
+
+func (s *matrixStream) expectDelim(want json.Delim) error {
+	t, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, t)
+	}
+	return nil
+}
+
+func badResponse(err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{
+		Type: ErrBadResponse,
+		Msg:  err.Error(),
+	}
+}
@@ -0,0 +1,172 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+var testRange = Range{
+	Start: time.Unix(1700000000, 0),
+	End:   time.Unix(1700000060, 0),
+	Step:  30 * time.Second,
+}
+
+func collectStream(t *testing.T, s MatrixStream) model.Matrix {
+	t.Helper()
+	var m model.Matrix
+	for s.Next() {
+		m = append(m, s.At())
+	}
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+	return m
+}
+
+const (
+	streamSeriesA = `{"metric":{"__name__":"up","job":"a"},"values":[[1700000000,"1"],[1700000030,"0"]]}`
+	streamSeriesB = `{"metric":{"__name__":"up","job":"b"},"values":[[1700000060,"1"]]}`
+)
+
+var streamMatrix = model.Matrix{
+	{
+		Metric: model.Metric{"__name__": "up", "job": "a"},
+		Values: []model.SamplePair{{Timestamp: 1700000000000, Value: 1}, {Timestamp: 1700000030000, Value: 0}},
+	},
+	{
+		Metric: model.Metric{"__name__": "up", "job": "b"},
+		Values: []model.SamplePair{{Timestamp: 1700000060000, Value: 1}},
+	},
+}
+
+func TestQueryRangeStream(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		body     string
+		warnings Warnings
+		infos    []string
+	}{
+		{
+			name: "ordered",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[` + streamSeriesA + `,` + streamSeriesB + `]}}`,
+		},
+		{
+			name:     "result before resultType",
+			body:     `{"status":"success","data":{"result":[` + streamSeriesA + `,` + streamSeriesB + `],"resultType":"matrix"},"warnings":["w"]}`,
+			warnings: Warnings{"w"},
+		},
+		{
+			name:     "warnings after data",
+			body:     `{"data":{"resultType":"matrix","result":[` + streamSeriesA + `,` + streamSeriesB + `],"stats":{}},"warnings":["w1","w2"],"infos":["i"],"status":"success"}`,
+			warnings: Warnings{"w1", "w2"},
+			infos:    []string{"i"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAPI(t, respondWith(http.StatusOK, tc.body))
+
+			s, err := api.QueryRangeStream(context.Background(), "up", testRange)
+			require.NoError(t, err)
+			require.Equal(t, streamMatrix, collectStream(t, s))
+			require.Equal(t, tc.warnings, s.Warnings())
+			require.Equal(t, tc.infos, s.Infos())
+		})
+	}
+}
+
+func TestQueryRangeStreamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		code    int
+		body    string
+		errType ErrorType
+		errMsg  string
+	}{
+		{
+			name:    "error envelope",
+			code:    statusAPIError,
+			body:    `{"status":"error","errorType":"execution","error":"query timed out"}`,
+			errType: ErrExec,
+			errMsg:  "query timed out",
+		},
+		{
+			name:    "server error",
+			code:    http.StatusInternalServerError,
+			body:    `oops`,
+			errType: ErrBadResponse,
+			errMsg:  "bad response code 500",
+		},
+		{
+			name:    "vector result",
+			code:    http.StatusOK,
+			body:    `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			errType: ErrBadResponse,
+			errMsg:  `unexpected value type "vector"`,
+		},
+		{
+			name:    "buffered vector result",
+			code:    http.StatusOK,
+			body:    `{"status":"success","data":{"result":[],"resultType":"vector"}}`,
+			errType: ErrBadResponse,
+			errMsg:  `unexpected value type "vector"`,
+		},
+		{
+			name:    "missing result",
+			code:    http.StatusOK,
+			body:    `{"status":"success","data":{"resultType":"matrix"}}`,
+			errType: ErrBadResponse,
+			errMsg:  "missing result in response",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAPI(t, respondWith(tc.code, tc.body))
+
+			_, err := api.QueryRangeStream(context.Background(), "up", testRange)
+			require.Error(t, err)
+			apiErr, ok := err.(*Error)
+			require.True(t, ok, "unexpected error %T: %v", err, err)
+			require.Equal(t, tc.errType, apiErr.Type)
+			require.Equal(t, tc.errMsg, apiErr.Msg)
+		})
+	}
+}
+
+func TestQueryRangeStreamTruncated(t *testing.T) {
+	api := newTestAPI(t, respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[`+streamSeriesA+`,{"metric":`))
+
+	s, err := api.QueryRangeStream(context.Background(), "up", testRange)
+	require.NoError(t, err)
+	require.True(t, s.Next())
+	require.False(t, s.Next())
+	require.Error(t, s.Err())
+	require.NoError(t, s.Close())
+}
+
+func TestQueryRangeStreamEarlyClose(t *testing.T) {
+	gone := make(chan struct{})
+	api := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[`+streamSeriesA)
+		w.(http.Flusher).Flush()
+		// Keep the response open until the client goes away.
+		<-r.Context().Done()
+		close(gone)
+	}))
+
+	s, err := api.QueryRangeStream(context.Background(), "up", testRange)
+	require.NoError(t, err)
+	require.True(t, s.Next())
+	require.Equal(t, streamMatrix[0], s.At())
+	require.NoError(t, s.Close())
+
+	select {
+	case <-gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the stream did not release the connection")
+	}
+}
@@ -0,0 +1,276 @@
+//go:build go1.7
+// +build go1.7
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/liticer/gclients/prometheus"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	epExport        = apiPrefix + "/export"
+	epExportNative  = apiPrefix + "/export/native"
+	epImport        = apiPrefix + "/import"
+	epImportNative  = apiPrefix + "/import/native"
+	epActiveQueries = apiPrefix + "/status/active_queries"
+	epSeriesCount   = apiPrefix + "/series/count"
+)
+
+// VMAPI provides bindings for the API extensions of VictoriaMetrics. The
+// queries of API accept the VictoriaMetrics options WithExtraLabel,
+// WithExtraFilters, WithNoCache and WithRoundDigits.
+type VMAPI interface {
+	// Export streams the raw samples of the series matching any of the given
+	// selectors within the given time range in the JSON line format.
+	Export(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (ExportStream, error)
+	// ExportNative returns the raw samples of the series matching any of the
+	// given selectors in the native format, which is only understood by
+	// ImportNative. The returned body must be closed.
+	ExportNative(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (io.ReadCloser, error)
+	// Import writes the given series. Only WithExtraLabel is applied.
+	Import(ctx context.Context, series []ExportedSeries, opts ...Option) error
+	// ImportNative writes series read from r in the native format. Only WithExtraLabel is applied.
+	ImportNative(ctx context.Context, r io.Reader, opts ...Option) error
+	// TSDBStatus returns the topN entries of the cardinality stats of the
+	// series matching any of the given selectors, or all series if there are
+	// none, for the given day. A zero date selects the current day. If
+	// focusLabel is set, the series count per value of this label is included.
+	TSDBStatus(ctx context.Context, topN int, date time.Time, matches []string, focusLabel string) (VMTSDBResult, error)
+	// ActiveQueries returns the queries currently being executed.
+	ActiveQueries(ctx context.Context) ([]ActiveQuery, error)
+	// SeriesCount returns the total number of series.
+	SeriesCount(ctx context.Context) (uint64, error)
+}
+
+// ExportedSeries is a series in the JSON line format of VictoriaMetrics.
+type ExportedSeries struct {
+	Metric model.Metric `json:"metric"`
+	Values []float64    `json:"values"`
+	// Timestamps in milliseconds, one for each value.
+	Timestamps []int64 `json:"timestamps"`
+}
+
+// ExportStream iterates over the series of an export while it is being read
+// from the wire.
+type ExportStream interface {
+	Next() bool
+	// At returns the current series. The returned series stays valid after Next is called.
+	At() *ExportedSeries
+	// The error that iteration has failed with.
+	Err() error
+	// Close releases the underlying response body. It must always be called.
+	Close() error
+}
+
+// VMTSDBResult models the cardinality stats of VictoriaMetrics.
+type VMTSDBResult struct {
+	TotalSeries                  uint64 `json:"totalSeries"`
+	TotalLabelValuePairs         uint64 `json:"totalLabelValuePairs"`
+	SeriesCountByMetricName      []Stat `json:"seriesCountByMetricName"`
+	SeriesCountByLabelName       []Stat `json:"seriesCountByLabelName"`
+	SeriesCountByFocusLabelValue []Stat `json:"seriesCountByFocusLabelValue"`
+	SeriesCountByLabelValuePair  []Stat `json:"seriesCountByLabelValuePair"`
+	LabelValueCountByLabelName   []Stat `json:"labelValueCountByLabelName"`
+}
+
+// ActiveQuery models a query being executed by VictoriaMetrics.
+type ActiveQuery struct {
+	ID         string `json:"id"`
+	Query      string `json:"query"`
+	RemoteAddr string `json:"remote_addr"`
+	// The time range and step of the query in milliseconds.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Step  int64 `json:"step"`
+	// The time the query has been running for, e.g. "0.103s".
+	Duration string `json:"duration"`
+}
+
+// NewVMAPI returns a new VMAPI for the client.
+//
+// It is safe to use the returned VMAPI from multiple goroutines.
+func NewVMAPI(c prometheus.Client) VMAPI {
+	return &httpVMAPI{
+		api: &httpAPI{client: apiClient{c}, postThreshold: -1},
+	}
+}
+
+type httpVMAPI struct {
+	api *httpAPI
+}
+
+func (h *httpVMAPI) Export(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (ExportStream, error) {
+	body, err := h.export(ctx, epExport, matches, start, end, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &exportStream{body: body, dec: json.NewDecoder(body)}, nil
+}
+
+func (h *httpVMAPI) ExportNative(ctx context.Context, matches []string, start, end time.Time, opts ...Option) (io.ReadCloser, error) {
+	return h.export(ctx, epExportNative, matches, start, end, opts)
+}
+
+func (h *httpVMAPI) export(ctx context.Context, ep string, matches []string, start, end time.Time, opts []Option) (io.ReadCloser, error) {
+	q := url.Values{}
+	setSeriesParams(q, matches, start, end)
+	newQueryOptions(opts).apply(q)
+
+	resp, err := h.api.client.Raw(ctx, prometheus.RawRequest{Path: ep, Query: q})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, rawError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (h *httpVMAPI) Import(ctx context.Context, series []ExportedSeries, opts ...Option) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range series {
+		if err := enc.Encode(&series[i]); err != nil {
+			return err
+		}
+	}
+	return h.importData(ctx, epImport, &buf, opts)
+}
+
+func (h *httpVMAPI) ImportNative(ctx context.Context, r io.Reader, opts ...Option) error {
+	return h.importData(ctx, epImportNative, r, opts)
+}
+
+func (h *httpVMAPI) importData(ctx context.Context, ep string, r io.Reader, opts []Option) error {
+	o := newQueryOptions(opts)
+	q := url.Values{}
+	for _, l := range o.extraLabels {
+		q.Add("extra_label", l)
+	}
+
+	resp, err := h.api.client.Raw(ctx, prometheus.RawRequest{
+		Method: http.MethodPost,
+		Path:   ep,
+		Query:  q,
+		Body:   r,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return rawError(resp)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func (h *httpVMAPI) TSDBStatus(ctx context.Context, topN int, date time.Time, matches []string, focusLabel string) (VMTSDBResult, error) {
+	u := h.api.client.URL(epTSDB, nil)
+	q := u.Query()
+	if topN > 0 {
+		q.Set("topN", strconv.Itoa(topN))
+	}
+	if !date.IsZero() {
+		q.Set("date", date.UTC().Format("2006-01-02"))
+	}
+	for _, m := range matches {
+		q.Add("match[]", m)
+	}
+	if focusLabel != "" {
+		q.Set("focusLabel", focusLabel)
+	}
+
+	_, result, err := h.api.doGetFallback(ctx, u, q)
+	if err != nil {
+		return VMTSDBResult{}, err
+	}
+	var res VMTSDBResult
+	err = json.Unmarshal(result.Data, &res)
+	return res, err
+}
+
+func (h *httpVMAPI) ActiveQueries(ctx context.Context) ([]ActiveQuery, error) {
+	u := h.api.client.URL(epActiveQueries, nil)
+
+	_, result, err := h.api.doGetFallback(ctx, u, u.Query())
+	if err != nil {
+		return nil, err
+	}
+	var res []ActiveQuery
+	err = json.Unmarshal(result.Data, &res)
+	return res, err
+}
+
+func (h *httpVMAPI) SeriesCount(ctx context.Context) (uint64, error) {
+	u := h.api.client.URL(epSeriesCount, nil)
+
+	_, result, err := h.api.doGetFallback(ctx, u, u.Query())
+	if err != nil {
+		return 0, err
+	}
+	var res []uint64
+	if err := json.Unmarshal(result.Data, &res); err != nil {
+		return 0, err
+	}
+	if len(res) != 1 {
+		return 0, &Error{
+			Type: ErrBadResponse,
+			Msg:  fmt.Sprintf("expected a single series count, got %d", len(res)),
+		}
+	}
+	return res[0], nil
+}
+
+// rawError returns the error of a non-2xx response to a raw request.
+// VictoriaMetrics answers these with plain text error messages.
+func rawError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{
+		Type: ErrBadResponse,
+		Msg:  fmt.Sprintf("bad response code %d: %s", resp.StatusCode, bytes.TrimSpace(body)),
+	}
+}
+
+type exportStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+
+	cur *ExportedSeries
+	err error
+}
+
+func (s *exportStream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	var es ExportedSeries
+	if err := s.dec.Decode(&es); err != nil {
+		if err != io.EOF {
+			s.err = badResponse(err)
+		}
+		return false
+	}
+	s.cur = &es
+	return true
+}
+
+func (s *exportStream) At() *ExportedSeries { return s.cur }
+
+func (s *exportStream) Err() error { return s.err }
+
+func (s *exportStream) Close() error { return s.body.Close() }
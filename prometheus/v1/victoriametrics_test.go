@@ -0,0 +1,221 @@
+package v1
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liticer/gclients/prometheus"
+)
+
+func newTestVMAPI(t *testing.T, h http.Handler) VMAPI {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := prometheus.NewClient(prometheus.Config{Address: srv.URL})
+	require.NoError(t, err)
+	return NewVMAPI(c)
+}
+
+var exportedSeries = []ExportedSeries{
+	{
+		Metric:     model.Metric{"__name__": "up", "job": "a"},
+		Values:     []float64{1, 0},
+		Timestamps: []int64{1700000000000, 1700000015000},
+	},
+	{
+		Metric:     model.Metric{"__name__": "up", "job": "b"},
+		Values:     []float64{1},
+		Timestamps: []int64{1700000000000},
+	},
+}
+
+func TestVMExport(t *testing.T) {
+	start, end := time.Unix(1700000000, 0).UTC(), time.Unix(1700003600, 0).UTC()
+
+	var query url.Values
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, epExport, r.URL.Path)
+		query = r.URL.Query()
+		fmt.Fprintln(w, `{"metric":{"__name__":"up","job":"a"},"values":[1,0],"timestamps":[1700000000000,1700000015000]}`)
+		fmt.Fprintln(w, `{"metric":{"__name__":"up","job":"b"},"values":[1],"timestamps":[1700000000000]}`)
+	}))
+
+	s, err := api.Export(context.Background(), []string{`up{job="a"}`, `up{job="b"}`}, start, end, WithExtraLabel("tenant", "x"))
+	require.NoError(t, err)
+
+	var got []ExportedSeries
+	for s.Next() {
+		got = append(got, *s.At())
+	}
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+	require.Equal(t, exportedSeries, got)
+	require.Equal(t, url.Values{
+		"match[]":     {`up{job="a"}`, `up{job="b"}`},
+		"start":       {"2023-11-14T22:13:20Z"},
+		"end":         {"2023-11-14T23:13:20Z"},
+		"extra_label": {"tenant=x"},
+	}, query)
+}
+
+func TestVMExportEmpty(t *testing.T) {
+	api := newTestVMAPI(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	s, err := api.Export(context.Background(), []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.False(t, s.Next())
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+}
+
+func TestVMExportCorrupted(t *testing.T) {
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, `{"metric":{"__name__":"up"},"values":[1],"timestamps":[1700000000000]}`)
+		fmt.Fprintln(w, `{"metric":{"__name__":"up"},"values":[1],"timestam`)
+	}))
+
+	s, err := api.Export(context.Background(), []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.True(t, s.Next())
+	require.False(t, s.Next())
+	var apiErr *Error
+	require.ErrorAs(t, s.Err(), &apiErr)
+	require.Equal(t, ErrorType(ErrBadResponse), apiErr.Type)
+	require.NoError(t, s.Close())
+}
+
+func TestVMExportNative(t *testing.T) {
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, epExportNative, r.URL.Path)
+		io.WriteString(w, "\x00\x01native")
+	}))
+
+	body, err := api.ExportNative(context.Background(), []string{"up"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.Equal(t, "\x00\x01native", string(b))
+}
+
+func TestVMImport(t *testing.T) {
+	var (
+		got   []ExportedSeries
+		query url.Values
+	)
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, epImport, r.URL.Path)
+		query = r.URL.Query()
+
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var es ExportedSeries
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &es))
+			got = append(got, es)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	require.NoError(t, api.Import(context.Background(), exportedSeries, WithExtraLabel("source", "backfill"), WithNoCache()))
+	require.Equal(t, exportedSeries, got)
+	// Only the extra labels apply to imports.
+	require.Equal(t, url.Values{"extra_label": {"source=backfill"}}, query)
+}
+
+func TestVMImportNative(t *testing.T) {
+	var got string
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, epImportNative, r.URL.Path)
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	require.NoError(t, api.ImportNative(context.Background(), strings.NewReader("native")))
+	require.Equal(t, "native", got)
+}
+
+func TestVMRawErrors(t *testing.T) {
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "missing `match[]` arg", http.StatusBadRequest)
+	}))
+	ctx := context.Background()
+
+	check := func(err error) {
+		t.Helper()
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, ErrorType(ErrBadResponse), apiErr.Type)
+		require.Equal(t, "bad response code 400: missing `match[]` arg", apiErr.Msg)
+	}
+
+	_, err := api.Export(ctx, nil, time.Time{}, time.Time{})
+	check(err)
+	_, err = api.ExportNative(ctx, nil, time.Time{}, time.Time{})
+	check(err)
+	check(api.Import(ctx, exportedSeries))
+	check(api.ImportNative(ctx, strings.NewReader("native")))
+}
+
+func TestVMRawErrorTruncated(t *testing.T) {
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, strings.Repeat("x", 10000))
+	}))
+
+	err := api.Import(context.Background(), exportedSeries)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "bad response code 503: "+strings.Repeat("x", 4096), apiErr.Msg)
+}
+
+func TestVMStatus(t *testing.T) {
+	var tsdbQuery url.Values
+	api := newTestVMAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case epTSDB:
+			tsdbQuery = r.URL.Query()
+			io.WriteString(w, `{"status":"success","data":{"totalSeries":3,"seriesCountByMetricName":[{"name":"up","value":3}]}}`)
+		case epSeriesCount:
+			io.WriteString(w, `{"status":"success","data":[42]}`)
+		case epActiveQueries:
+			io.WriteString(w, `{"status":"ok","data":[{"id":"1","query":"up","remote_addr":"10.0.0.1:1234","start":1,"end":2,"step":1,"duration":"0.1s"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ctx := context.Background()
+
+	res, err := api.TSDBStatus(ctx, 5, time.Date(2024, 3, 1, 23, 0, 0, 0, time.FixedZone("", -3600)), []string{"up"}, "job")
+	require.NoError(t, err)
+	require.Equal(t, VMTSDBResult{TotalSeries: 3, SeriesCountByMetricName: []Stat{{Name: "up", Value: 3}}}, res)
+	require.Equal(t, url.Values{
+		"topN":       {"5"},
+		"date":       {"2024-03-02"},
+		"match[]":    {"up"},
+		"focusLabel": {"job"},
+	}, tsdbQuery)
+
+	n, err := api.SeriesCount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), n)
+
+	queries, err := api.ActiveQueries(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []ActiveQuery{{ID: "1", Query: "up", RemoteAddr: "10.0.0.1:1234", Start: 1, End: 2, Step: 1, Duration: "0.1s"}}, queries)
+}